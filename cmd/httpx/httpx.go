@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/signal"
 
@@ -9,6 +10,24 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "store" {
+		if err := runner.RunStoreCommand(os.Args[2:]); err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		// the flags of serve are the ones of the scan
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		options := runner.ParseOptions()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := runner.Serve(ctx, options); err != nil {
+			gologger.Fatal().Msgf("Could not serve: %s\n", err)
+		}
+		return
+	}
+
 	// Parse the command line flags and read config files
 	options := runner.ParseOptions()
 
@@ -17,24 +36,44 @@ func main() {
 		gologger.Fatal().Msgf("Could not create runner: %s\n", err)
 	}
 
-	// Setup graceful exits
+	// Setup graceful exits: the first CTRL+C stops taking new input and lets
+	// in-flight requests complete, the second one exits right away
+	inputCtx, stopInput := context.WithCancel(context.Background())
+	defer stopInput()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	go func() {
-		for range c {
-			gologger.Info().Msgf("CTRL+C pressed: Exiting\n")
-			httpxRunner.Close()
-			if options.ShouldSaveResume() {
-				gologger.Info().Msgf("Creating resume file: %s\n", runner.DefaultResumeFile)
-				err := httpxRunner.SaveResumeConfig()
-				if err != nil {
-					gologger.Error().Msgf("Couldn't create resume file: %s\n", err)
-				}
+		<-c
+		gologger.Info().Msgf("CTRL+C pressed: Exiting gracefully (press again to force exit)\n")
+		stopInput()
+		<-c
+		gologger.Info().Msgf("CTRL+C pressed again: Exiting\n")
+		cancel()
+		// the requests in flight are probed again when resuming
+		if options.ShouldSaveResume() {
+			if err := httpxRunner.SaveResumeConfig(); err != nil {
+				gologger.Error().Msgf("Couldn't save resume file: %s\n", err)
 			}
-			os.Exit(1)
 		}
+		os.Exit(1)
 	}()
 
-	httpxRunner.RunEnumeration()
+	if err := httpxRunner.RunEnumerationWithContexts(inputCtx, ctx); err != nil {
+		gologger.Fatal().Msgf("Could not run enumeration: %s\n", err)
+	}
+
+	interrupted := inputCtx.Err() != nil
+	if interrupted && options.ShouldSaveResume() {
+		gologger.Info().Msgf("Saving resume file: %s\n", options.ResumeFile)
+		err := httpxRunner.SaveResumeConfig()
+		if err != nil {
+			gologger.Error().Msgf("Couldn't create resume file: %s\n", err)
+		}
+	}
 	httpxRunner.Close()
+	if interrupted {
+		os.Exit(1)
+	}
 }
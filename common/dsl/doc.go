@@ -0,0 +1,2 @@
+// Package dsl contains a small expression language used to match and filter results
+package dsl
@@ -0,0 +1,62 @@
+package dsl
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Expression is a compiled expression ready to be evaluated against a set of variables
+type Expression struct {
+	source    string
+	root      node
+	variables []string
+}
+
+// Compile parses an expression such as:
+//
+//	status_code >= 200 && status_code < 300 && contains(title, "Login") && !cdn
+func Compile(expression string) (*Expression, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, variables: make(map[string]struct{})}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s", t)
+	}
+
+	compiled := &Expression{source: expression, root: root}
+	for variable := range p.variables {
+		compiled.variables = append(compiled.variables, variable)
+	}
+	sort.Strings(compiled.variables)
+	return compiled, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Variables returns the names of the variables referenced by the expression
+func (e *Expression) Variables() []string {
+	return e.variables
+}
+
+// Evaluate the expression and return its value
+func (e *Expression) Evaluate(vars map[string]interface{}) (interface{}, error) {
+	return e.root.eval(vars)
+}
+
+// Match evaluates the expression and returns its boolean interpretation
+func (e *Expression) Match(vars map[string]interface{}) (bool, error) {
+	value, err := e.Evaluate(vars)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
@@ -0,0 +1,167 @@
+package dsl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	vars := map[string]interface{}{
+		"status_code":    200,
+		"content_length": 0,
+		"title":          "Admin Login",
+		"port":           "443",
+		"cdn":            false,
+		"technologies":   []string{"nginx", "PHP"},
+		"chain":          []interface{}{map[string]interface{}{"status_code": 301.0}, map[string]interface{}{"status_code": 200.0}},
+		"hashes":         map[string]string{"body-md5": "abc"},
+		"tls_grab":       map[string]interface{}{"subject_cn": "example.com", "subject_an": []interface{}{"a.example.com"}},
+		"cert_days":      (*int)(nil),
+	}
+
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		// precedence: ! binds tighter than comparisons, && tighter than ||
+		{`status_code == 200 || status_code == 404 && false`, true},
+		{`(status_code == 200 || status_code == 404) && false`, false},
+		{`!cdn && status_code == 200`, true},
+		{`!cdn == false`, false},
+		{`!(status_code == 200)`, false},
+		{`false || false || status_code >= 200 && status_code < 300`, true},
+
+		// indexing
+		{`chain[0]["status_code"] == 301`, true},
+		{`chain[5] == nil`, true},
+		{`hashes["body-md5"] == "abc"`, true},
+		{`tls_grab["subject_an"][0] == "a.example.com"`, true},
+		{`hashes["missing"] == null`, true},
+		{`technologies[1] == "PHP"`, true},
+
+		// type coercion
+		{`port == 443`, true},
+		{`port > 442`, true},
+		{`port == "443"`, true},
+		{`status_code == "200"`, true},
+		{`content_length == 0`, true},
+		{`content_length`, false},
+		{`title`, true},
+		{`technologies`, true},
+		{`missing`, false},
+		{`missing == nil`, true},
+		{`missing > 1`, false},
+		{`cert_days == nil`, true},
+		{`title < "B"`, true},
+
+		// functions
+		{`contains(title, "Login")`, true},
+		{`contains(technologies, "nginx")`, true},
+		{`contains(missing, "x")`, false},
+		{`icontains(title, "admin")`, true},
+		{`starts_with(title, "Admin") && ends_with(title, "Login")`, true},
+		{`regex("^adm", to_lower(title))`, true},
+		{`regex('(?i)LOGIN$', title)`, true},
+		{`to_upper(title) == "ADMIN LOGIN"`, true},
+		{`len(technologies) == 2 && len(title) == 11 && len(missing) == 0`, true},
+		{`in(status_code, 301, 302, 200)`, true},
+		{`in(status_code, 301, 302)`, false},
+		{`between(status_code, 200, 299)`, true},
+		{`between(missing, 200, 299)`, false},
+		{`-1 < 0 && .5 < 1`, true},
+	}
+	for _, test := range tests {
+		compiled, err := Compile(test.expression)
+		if err != nil {
+			t.Errorf("Compile(%q) returned error: %s", test.expression, err)
+			continue
+		}
+		got, err := compiled.Match(vars)
+		if err != nil {
+			t.Errorf("Match(%q) returned error: %s", test.expression, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Match(%q) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{`status_code ==`, "unexpected end of expression"},
+		{`status_code == 200)`, `unexpected ")" at position 18`},
+		{`(status_code == 200`, `expected ")"`},
+		{`title == "open`, "unterminated string"},
+		{`status_code = 200`, `unexpected character '='`},
+		{`unknown(title)`, "unknown function"},
+		{`contains(title)`, "wrong number of arguments"},
+		{`between(1, 2)`, "wrong number of arguments"},
+		{`regex("[", title)`, "invalid regex"},
+		{`regex(1, title)`, "regex pattern must be a string"},
+		{`chain[0`, `expected "]"`},
+		{`chain[0].url`, `unexpected character '.'`},
+		{`status_code == 200 == 300`, "unexpected"},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.expression)
+		if err == nil {
+			t.Errorf("Compile(%q) succeeded, want error containing %q", test.expression, test.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Compile(%q) error = %q, want error containing %q", test.expression, err, test.err)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	vars := map[string]interface{}{
+		"title":  "Login",
+		"tags":   []string{"a"},
+		"hashes": map[string]string{"md5": "abc"},
+		"flag":   true,
+	}
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{`contains(title, 1)`, "contains: arguments must be strings"},
+		{`contains(flag, "x")`, "contains: unsupported haystack"},
+		{`starts_with(title, tags)`, "starts_with: arguments must be strings"},
+		{`between(1, "a", 3)`, "between: range bounds must be numbers"},
+		{`tags["a"] == 1`, "slice index must be a number"},
+		{`hashes[0] == 1`, "map index must be a string"},
+		{`title > tags`, "cannot compare"},
+	}
+	for _, test := range tests {
+		compiled, err := Compile(test.expression)
+		if err != nil {
+			t.Errorf("Compile(%q) returned error: %s", test.expression, err)
+			continue
+		}
+		_, err = compiled.Match(vars)
+		if err == nil {
+			t.Errorf("Match(%q) succeeded, want error containing %q", test.expression, test.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Match(%q) error = %q, want error containing %q", test.expression, err, test.err)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	compiled, err := Compile(`status_code == 200 && contains(to_lower(title), "x") || !cdn && chain[0]["url"] == title && true && null == nil`)
+	if err != nil {
+		t.Fatalf("Compile returned error: %s", err)
+	}
+	want := []string{"cdn", "chain", "status_code", "title"}
+	if got := compiled.Variables(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Variables() = %v, want %v", got, want)
+	}
+}
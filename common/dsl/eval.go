@@ -0,0 +1,293 @@
+package dsl
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+type node interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(_ map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+// eval returns nil for missing variables so that optional fields simply don't match
+func (n *variableNode) eval(vars map[string]interface{}) (interface{}, error) {
+	return normalize(vars[n.name]), nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+type logicalNode struct {
+	operator    string
+	left, right node
+}
+
+func (n *logicalNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	// short circuit
+	if n.operator == "&&" && !truthy(left) {
+		return false, nil
+	}
+	if n.operator == "||" && truthy(left) {
+		return true, nil
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(right), nil
+}
+
+type comparisonNode struct {
+	operator    string
+	left, right node
+}
+
+func (n *comparisonNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.operator {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	}
+	// ordering against a missing value is always false
+	if left == nil || right == nil {
+		return false, nil
+	}
+	if leftNumber, rightNumber, ok := bothNumbers(left, right); ok {
+		return compare(n.operator, leftNumber-rightNumber), nil
+	}
+	leftStr, leftOk := left.(string)
+	rightStr, rightOk := right.(string)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("cannot compare %v %s %v", left, n.operator, right)
+	}
+	switch {
+	case leftStr < rightStr:
+		return compare(n.operator, -1), nil
+	case leftStr > rightStr:
+		return compare(n.operator, 1), nil
+	}
+	return compare(n.operator, 0), nil
+}
+
+func compare(operator string, diff float64) bool {
+	switch operator {
+	case "<":
+		return diff < 0
+	case "<=":
+		return diff <= 0
+	case ">":
+		return diff > 0
+	case ">=":
+		return diff >= 0
+	}
+	return false
+}
+
+type indexNode struct {
+	value, index node
+}
+
+func (n *indexNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.value.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("map index must be a string: %v", index)
+		}
+		return normalize(v[key]), nil
+	case []interface{}:
+		position, ok := toNumber(index)
+		if !ok {
+			return nil, fmt.Errorf("slice index must be a number: %v", index)
+		}
+		if int(position) < 0 || int(position) >= len(v) {
+			return nil, nil
+		}
+		return normalize(v[int(position)]), nil
+	}
+	return nil, nil
+}
+
+type callNode struct {
+	name  string
+	fn    function
+	args  []node
+	regex *regexp.Regexp
+}
+
+func (n *callNode) eval(vars map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	if n.regex != nil {
+		args[0] = n.regex
+	}
+	result, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", n.name, err)
+	}
+	return result, nil
+}
+
+// normalize converts go values to the restricted set of types used during evaluation:
+// nil, bool, float64, string, []interface{} and map[string]interface{}
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, float64, string, []interface{}, map[string]interface{}, *regexp.Regexp:
+		return v
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case []string:
+		values := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			values = append(values, item)
+		}
+		return values
+	case []int:
+		values := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			values = append(values, float64(item))
+		}
+		return values
+	case map[string]string:
+		values := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			values[key] = item
+		}
+		return values
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if reflected.IsNil() {
+			return nil
+		}
+		return normalize(reflected.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		values := make([]interface{}, 0, reflected.Len())
+		for i := 0; i < reflected.Len(); i++ {
+			values = append(values, reflected.Index(i).Interface())
+		}
+		return values
+	}
+	return fmt.Sprint(value)
+}
+
+// truthy returns the boolean interpretation of a value
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// bothNumbers converts both values to numbers, strings holding numbers are accepted
+// when compared against a number (eg. port == 443)
+func bothNumbers(left, right interface{}) (float64, float64, bool) {
+	_, leftIsNumber := left.(float64)
+	_, rightIsNumber := right.(float64)
+	if !leftIsNumber && !rightIsNumber {
+		return 0, 0, false
+	}
+	leftNumber, leftOk := toNumber(left)
+	rightNumber, rightOk := toNumber(right)
+	return leftNumber, rightNumber, leftOk && rightOk
+}
+
+func equal(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	if leftNumber, rightNumber, ok := bothNumbers(left, right); ok {
+		return leftNumber == rightNumber
+	}
+	switch l := left.(type) {
+	case string, bool:
+		return l == right
+	}
+	return reflect.DeepEqual(left, right)
+}
@@ -0,0 +1,146 @@
+package dsl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type function struct {
+	minArgs int
+	// maxArgs is -1 for variadic functions
+	maxArgs int
+	call    func(args []interface{}) (interface{}, error)
+}
+
+var errStringArgs = errors.New("arguments must be strings")
+
+// functions available within expressions
+var functions = map[string]function{
+	// contains(haystack, needle) works on strings (substring) and lists (membership)
+	"contains": {minArgs: 2, maxArgs: 2, call: func(args []interface{}) (interface{}, error) {
+		switch haystack := args[0].(type) {
+		case nil:
+			return false, nil
+		case string:
+			needle, ok := args[1].(string)
+			if !ok {
+				return nil, errStringArgs
+			}
+			return strings.Contains(haystack, needle), nil
+		case []interface{}:
+			for _, item := range haystack {
+				if equal(normalize(item), args[1]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return nil, fmt.Errorf("unsupported haystack %v", args[0])
+	}},
+	"icontains": {minArgs: 2, maxArgs: 2, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		haystack, needle, err := twoStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle)), nil
+	}},
+	"starts_with": {minArgs: 2, maxArgs: 2, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		s, prefix, err := twoStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasPrefix(s, prefix), nil
+	}},
+	"ends_with": {minArgs: 2, maxArgs: 2, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		s, suffix, err := twoStrings(args)
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasSuffix(s, suffix), nil
+	}},
+	// regex(pattern, value)
+	"regex": {minArgs: 2, maxArgs: 2, call: func(args []interface{}) (interface{}, error) {
+		if args[1] == nil {
+			return false, nil
+		}
+		value, ok := args[1].(string)
+		if !ok {
+			return nil, errStringArgs
+		}
+		switch pattern := args[0].(type) {
+		case *regexp.Regexp:
+			return pattern.MatchString(value), nil
+		case string:
+			return regexp.MatchString(pattern, value)
+		}
+		return nil, errStringArgs
+	}},
+	"to_lower": {minArgs: 1, maxArgs: 1, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return strings.ToLower(fmt.Sprint(args[0])), nil
+	}},
+	"to_upper": {minArgs: 1, maxArgs: 1, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return strings.ToUpper(fmt.Sprint(args[0])), nil
+	}},
+	"len": {minArgs: 1, maxArgs: 1, call: func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return float64(len(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		}
+		return float64(0), nil
+	}},
+	// in(value, candidate1, candidate2, ...)
+	"in": {minArgs: 2, maxArgs: -1, call: func(args []interface{}) (interface{}, error) {
+		for _, candidate := range args[1:] {
+			if equal(args[0], candidate) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}},
+	// between(value, low, high) checks low <= value <= high
+	"between": {minArgs: 3, maxArgs: 3, call: func(args []interface{}) (interface{}, error) {
+		value, ok := toNumber(args[0])
+		if !ok {
+			return false, nil
+		}
+		low, lowOk := toNumber(args[1])
+		high, highOk := toNumber(args[2])
+		if !lowOk || !highOk {
+			return nil, errors.New("range bounds must be numbers")
+		}
+		return value >= low && value <= high, nil
+	}},
+}
+
+func twoStrings(args []interface{}) (string, string, error) {
+	first, ok := args[0].(string)
+	if !ok {
+		return "", "", errStringArgs
+	}
+	second, ok := args[1].(string)
+	if !ok {
+		return "", "", errStringArgs
+	}
+	return first, second, nil
+}
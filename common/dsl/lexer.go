@@ -0,0 +1,107 @@
+package dsl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q at position %d", t.value, t.pos)
+}
+
+// operators sorted so that the longest ones are tried first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","}
+
+// tokenize splits the expression into tokens
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		c := rune(expression[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'' || c == '`':
+			end := i + 1
+			for end < len(expression) && rune(expression[end]) != c {
+				if expression[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expression) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			literal := expression[i : end+1]
+			if c == '\'' {
+				// single quoted strings follow the same escaping rules as double quoted ones
+				literal = `"` + strings.ReplaceAll(strings.ReplaceAll(literal[1:len(literal)-1], `\'`, `'`), `"`, `\"`) + `"`
+			}
+			value, err := strconv.Unquote(literal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %s", i, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value, pos: i})
+			i = end + 1
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(expression) && unicode.IsDigit(rune(expression[i+1]))):
+			end := i
+			for end < len(expression) && (unicode.IsDigit(rune(expression[end])) || expression[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: expression[i:end], pos: i})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(expression) && (unicode.IsLetter(rune(expression[end])) || unicode.IsDigit(rune(expression[end])) || expression[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: expression[i:end], pos: i})
+			i = end
+		default:
+			matched := false
+			for _, operator := range operators {
+				if strings.HasPrefix(expression[i:], operator) {
+					tokens = append(tokens, token{kind: tokenOperator, value: operator, pos: i})
+					i += len(operator)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				// a leading minus is only valid in front of numbers
+				if c == '-' && i+1 < len(expression) && unicode.IsDigit(rune(expression[i+1])) {
+					end := i + 1
+					for end < len(expression) && (unicode.IsDigit(rune(expression[end])) || expression[end] == '.') {
+						end++
+					}
+					tokens = append(tokens, token{kind: tokenNumber, value: expression[i:end], pos: i})
+					i = end
+					continue
+				}
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(expression)})
+	return tokens, nil
+}
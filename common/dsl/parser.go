@@ -0,0 +1,211 @@
+package dsl
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+type parser struct {
+	tokens    []token
+	pos       int
+	variables map[string]struct{}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOperator(values ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return false
+	}
+	for _, value := range values {
+		if t.value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(value string) error {
+	if t := p.next(); t.kind != tokenOperator || t.value != value {
+		return fmt.Errorf("expected %q but got %s", value, t)
+	}
+	return nil
+}
+
+// parseOr := parseAnd ('||' parseAnd)*
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{operator: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd := parseComparison ('&&' parseComparison)*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{operator: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseComparison := parseUnary (comparison-operator parseUnary)?
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOperator("==", "!=", "<", "<=", ">", ">=") {
+		operator := p.next().value
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &comparisonNode{operator: operator, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+// parseUnary := '!' parseUnary | parsePostfix
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("!") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+// parsePostfix := parsePrimary ('[' parseOr ']')*
+func (p *parser) parsePostfix() (node, error) {
+	value, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("[") {
+		p.next()
+		index, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		value = &indexNode{value: value, index: index}
+	}
+	return value, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		number, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t)
+		}
+		return &literalNode{value: number}, nil
+	case tokenString:
+		return &literalNode{value: t.value}, nil
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+		if p.isOperator("(") {
+			return p.parseCall(t)
+		}
+		p.variables[t.value] = struct{}{}
+		return &variableNode{name: t.value}, nil
+	case tokenOperator:
+		if t.value == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s", t)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.value]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	p.next() // consume '('
+	var args []node
+	for !p.isOperator(")") {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.isOperator(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments for function %s", name)
+	}
+	call := &callNode{name: name.value, fn: fn, args: args}
+	// regex patterns known at compile time are validated and cached once
+	if name.value == "regex" {
+		if pattern, ok := args[0].(*literalNode); ok {
+			patternStr, ok := pattern.value.(string)
+			if !ok {
+				return nil, fmt.Errorf("regex pattern must be a string %s", name)
+			}
+			compiled, err := regexp.Compile(patternStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex %q: %s", patternStr, err)
+			}
+			call.regex = compiled
+		}
+	}
+	return call, nil
+}
@@ -0,0 +1,3 @@
+// Package extractor extracts named values from the responses with regexes, css selectors
+// and xpath expressions over html, jsonpath expressions over json, headers and cookies
+package extractor
@@ -0,0 +1,211 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// Types of extractors
+const (
+	Regex    = "regex"
+	CSS      = "css"
+	XPath    = "xpath"
+	JSONPath = "jsonpath"
+	Header   = "header"
+	Cookie   = "cookie"
+)
+
+// Types are the supported types of extractors
+var Types = []string{Regex, CSS, XPath, JSONPath, Header, Cookie}
+
+var (
+	nameRegex = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+	// cssAttributeRegex splits the attribute to extract from a css selector (eg input[name=csrf]@value)
+	cssAttributeRegex = regexp.MustCompile(`^(.+)@([A-Za-z_:][A-Za-z0-9_:.\-]*)$`)
+)
+
+// Extractor extracts the values of an expression from the responses under a name
+type Extractor struct {
+	Name string
+	Type string
+	Expr string
+
+	regex     *regexp.Regexp
+	selector  cascadia.Selector
+	attribute string
+	xpath     *xpathQuery
+	jsonpath  []jsonStep
+}
+
+// Parse parses an extractor in the name:type:expr format
+func Parse(value string) (*Extractor, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, fmt.Errorf("invalid extractor %q, expected name:type:expr", value)
+	}
+	e := &Extractor{Name: parts[0], Type: strings.ToLower(parts[1]), Expr: parts[2]}
+	if !nameRegex.MatchString(e.Name) {
+		return nil, fmt.Errorf("invalid extractor name %q", e.Name)
+	}
+
+	var err error
+	switch e.Type {
+	case Regex:
+		e.regex, err = regexp.Compile(e.Expr)
+	case CSS:
+		expr := e.Expr
+		if match := cssAttributeRegex.FindStringSubmatch(expr); match != nil && !strings.HasSuffix(match[1], "[") {
+			expr, e.attribute = match[1], match[2]
+		}
+		e.selector, err = cascadia.Compile(expr)
+	case XPath:
+		e.xpath, err = compileXPath(e.Expr)
+	case JSONPath:
+		e.jsonpath, err = compileJSONPath(e.Expr)
+	case Header, Cookie:
+	default:
+		return nil, fmt.Errorf("invalid extractor type %q, supported: %s", e.Type, strings.Join(Types, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s expression %q: %s", e.Type, e.Expr, err)
+	}
+	return e, nil
+}
+
+// Response is the part of a response the extractors work on, the body is parsed once for all of them
+type Response struct {
+	Headers map[string][]string
+	Body    []byte
+
+	document    *goquery.Document
+	documentErr error
+	json        interface{}
+	jsonErr     error
+	parsed      struct{ document, json bool }
+}
+
+// Extract returns the values extracted by each extractor, keyed by name. The names without values are omitted.
+func Extract(extractors []*Extractor, headers map[string][]string, body []byte) map[string][]string {
+	resp := &Response{Headers: headers, Body: body}
+	extracts := make(map[string][]string)
+	for _, e := range extractors {
+		for _, value := range e.Extract(resp) {
+			if !contains(extracts[e.Name], value) {
+				extracts[e.Name] = append(extracts[e.Name], value)
+			}
+		}
+	}
+	if len(extracts) == 0 {
+		return nil
+	}
+	return extracts
+}
+
+// Extract returns the values of the expression in the response
+func (e *Extractor) Extract(resp *Response) []string {
+	switch e.Type {
+	case Regex:
+		return e.extractRegex(resp.Body)
+	case CSS:
+		doc, err := resp.htmlDocument()
+		if err != nil {
+			return nil
+		}
+		var values []string
+		doc.FindMatcher(e.selector).Each(func(_ int, s *goquery.Selection) {
+			value := strings.TrimSpace(s.Text())
+			if e.attribute != "" {
+				value, _ = s.Attr(e.attribute)
+			}
+			if value != "" {
+				values = append(values, value)
+			}
+		})
+		return values
+	case XPath:
+		doc, err := resp.htmlDocument()
+		if err != nil {
+			return nil
+		}
+		var root *html.Node
+		if len(doc.Nodes) > 0 {
+			root = doc.Nodes[0]
+		}
+		return e.xpath.evaluate(root)
+	case JSONPath:
+		value, err := resp.jsonValue()
+		if err != nil {
+			return nil
+		}
+		return evaluateJSONPath(e.jsonpath, value)
+	case Header:
+		var values []string
+		for name, headerValues := range resp.Headers {
+			if strings.EqualFold(name, e.Expr) {
+				values = append(values, headerValues...)
+			}
+		}
+		return values
+	case Cookie:
+		var values []string
+		for _, cookie := range (&http.Response{Header: http.Header(resp.Headers)}).Cookies() {
+			if cookie.Name == e.Expr && cookie.Value != "" {
+				values = append(values, cookie.Value)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// extractRegex returns the capture groups of the matches, or the whole matches if the regex has none
+func (e *Extractor) extractRegex(body []byte) []string {
+	var values []string
+	for _, match := range e.regex.FindAllSubmatch(body, -1) {
+		if len(match) == 1 {
+			values = append(values, string(match[0]))
+			continue
+		}
+		for _, group := range match[1:] {
+			if len(group) > 0 {
+				values = append(values, string(group))
+			}
+		}
+	}
+	return values
+}
+
+func (resp *Response) htmlDocument() (*goquery.Document, error) {
+	if !resp.parsed.document {
+		resp.parsed.document = true
+		resp.document, resp.documentErr = goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
+	}
+	return resp.document, resp.documentErr
+}
+
+func (resp *Response) jsonValue() (interface{}, error) {
+	if !resp.parsed.json {
+		resp.parsed.json = true
+		decoder := json.NewDecoder(bytes.NewReader(resp.Body))
+		decoder.UseNumber()
+		resp.jsonErr = decoder.Decode(&resp.json)
+	}
+	return resp.json, resp.jsonErr
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
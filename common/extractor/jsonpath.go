@@ -0,0 +1,406 @@
+package extractor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonStep is a step of a jsonpath expression, the supported subset is: $, .name, ['name'], [n], [start:end:step],
+// [*], .*, ..name, ..* and the [?(@.path)] and [?(@.path op value)] filters with the ==, !=, <, <=, > and >=
+// operators. The unions, script expressions and filters combining conditions are rejected.
+type jsonStep struct {
+	// recursive applies the step to the value and all its descendants (..)
+	recursive bool
+	key       string
+	wildcard  bool
+	index     *int
+	slice     *jsonSlice
+	filter    *jsonFilter
+}
+
+// jsonSlice is an array slice, the bounds are nil when omitted
+type jsonSlice struct {
+	start, end *int
+	step       int
+}
+
+type jsonFilter struct {
+	path []string
+	// operator is empty when the filter only checks that the path exists
+	operator string
+	value    string
+}
+
+// jsonFilterOperators are the supported filter operators, the two characters ones first
+var jsonFilterOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func compileJSONPath(expr string) ([]jsonStep, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "$") {
+		if !strings.HasPrefix(expr, ".") && !strings.HasPrefix(expr, "[") {
+			expr = "." + expr
+		}
+		expr = "$" + expr
+	}
+
+	var steps []jsonStep
+	for i := 1; i < len(expr); {
+		var step jsonStep
+		switch {
+		case strings.HasPrefix(expr[i:], ".."):
+			step.recursive = true
+			i += 2
+			if i < len(expr) && expr[i] == '[' {
+				break
+			}
+			name, next := jsonName(expr, i)
+			if name == "" {
+				return nil, fmt.Errorf("missing name after .. at %d", i)
+			}
+			step.key, step.wildcard = name, name == "*"
+			steps = append(steps, step)
+			i = next
+			continue
+		case expr[i] == '.':
+			name, next := jsonName(expr, i+1)
+			if name == "" {
+				return nil, fmt.Errorf("missing name after . at %d", i)
+			}
+			step.key, step.wildcard = name, name == "*"
+			steps = append(steps, step)
+			i = next
+			continue
+		case expr[i] != '[':
+			return nil, fmt.Errorf("unexpected %q at %d", expr[i], i)
+		}
+
+		end := jsonBracketEnd(expr, i)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated [ at %d", i)
+		}
+		content := strings.TrimSpace(expr[i+1 : end])
+		i = end + 1
+		switch {
+		case content == "*":
+			step.wildcard = true
+		case len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && strings.IndexByte(content[1:], content[0]) == len(content)-2:
+			step.key = content[1 : len(content)-1]
+		case strings.HasPrefix(content, "?(") && strings.HasSuffix(content, ")"):
+			filter, err := compileJSONFilter(content[2 : len(content)-1])
+			if err != nil {
+				return nil, err
+			}
+			step.filter = filter
+		case strings.HasPrefix(content, "("):
+			return nil, fmt.Errorf("unsupported script expression [%s]", content)
+		case strings.Contains(content, ","):
+			return nil, fmt.Errorf("unsupported union [%s]", content)
+		case strings.Contains(content, ":"):
+			slice, err := compileJSONSlice(content)
+			if err != nil {
+				return nil, err
+			}
+			step.slice = slice
+		default:
+			index, err := strconv.Atoi(content)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subscript [%s]", content)
+			}
+			step.index = &index
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// jsonName returns the member name starting at i and the position following it
+func jsonName(expr string, i int) (string, int) {
+	start := i
+	for i < len(expr) && expr[i] != '.' && expr[i] != '[' {
+		i++
+	}
+	return expr[start:i], i
+}
+
+// jsonBracketEnd returns the position of the bracket closing the one at i, skipping the quoted strings
+func jsonBracketEnd(expr string, i int) int {
+	var quote byte
+	depth := 0
+	for ; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// compileJSONSlice parses the start:end:step slices, the step must be positive
+func compileJSONSlice(content string) (*jsonSlice, error) {
+	parts := strings.Split(content, ":")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid slice [%s]", content)
+	}
+	slice := &jsonSlice{step: 1}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slice [%s]", content)
+		}
+		switch i {
+		case 0:
+			slice.start = &value
+		case 1:
+			slice.end = &value
+		default:
+			if value <= 0 {
+				return nil, fmt.Errorf("unsupported slice step %d in [%s]", value, content)
+			}
+			slice.step = value
+		}
+	}
+	return slice, nil
+}
+
+func compileJSONFilter(expr string) (*jsonFilter, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.Contains(expr, "&&") || strings.Contains(expr, "||") {
+		return nil, fmt.Errorf("unsupported filter %q, only a single condition is supported", expr)
+	}
+	filter := &jsonFilter{}
+	for _, operator := range jsonFilterOperators {
+		if position := strings.Index(expr, operator); position > 0 {
+			filter.operator = operator
+			filter.value = strings.TrimSpace(expr[position+len(operator):])
+			if len(filter.value) >= 2 && (filter.value[0] == '\'' || filter.value[0] == '"') && filter.value[len(filter.value)-1] == filter.value[0] {
+				filter.value = filter.value[1 : len(filter.value)-1]
+			}
+			expr = strings.TrimSpace(expr[:position])
+			break
+		}
+	}
+	if expr != "@" && !strings.HasPrefix(expr, "@.") {
+		return nil, errors.New("filters must start with @")
+	}
+	if expr != "@" {
+		filter.path = strings.Split(expr[2:], ".")
+	}
+	for _, key := range filter.path {
+		if key == "" || strings.ContainsAny(key, " []()'\"=!<>") {
+			return nil, fmt.Errorf("unsupported filter %q", expr)
+		}
+	}
+	if (filter.operator == "<" || filter.operator == "<=" || filter.operator == ">" || filter.operator == ">=") && !isJSONNumber(filter.value) {
+		return nil, fmt.Errorf("the %s operator expects a number, got %q", filter.operator, filter.value)
+	}
+	return filter, nil
+}
+
+func isJSONNumber(value string) bool {
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// evaluateJSONPath returns the values selected by the steps, formatted as strings
+func evaluateJSONPath(steps []jsonStep, root interface{}) []string {
+	current := []interface{}{root}
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range current {
+			if step.recursive {
+				for _, descendant := range jsonDescendants(value, nil) {
+					next = append(next, step.apply(descendant)...)
+				}
+				continue
+			}
+			next = append(next, step.apply(value)...)
+		}
+		current = next
+	}
+
+	var values []string
+	for _, value := range current {
+		if formatted, ok := formatJSONValue(value); ok {
+			values = append(values, formatted)
+		}
+	}
+	return values
+}
+
+func (step jsonStep) apply(value interface{}) []interface{} {
+	switch {
+	case step.wildcard:
+		return jsonChildren(value)
+	case step.index != nil:
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		index := *step.index
+		if index < 0 {
+			index += len(array)
+		}
+		if index < 0 || index >= len(array) {
+			return nil
+		}
+		return []interface{}{array[index]}
+	case step.slice != nil:
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		start, end := step.slice.bounds(len(array))
+		var selected []interface{}
+		for i := start; i < end; i += step.slice.step {
+			selected = append(selected, array[i])
+		}
+		return selected
+	case step.filter != nil:
+		var matched []interface{}
+		for _, child := range jsonChildren(value) {
+			if step.filter.match(child) {
+				matched = append(matched, child)
+			}
+		}
+		return matched
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if child, ok := object[step.key]; ok {
+		return []interface{}{child}
+	}
+	return nil
+}
+
+// bounds returns the start and end of the slice in an array of the given length, negative
+// bounds counting from the end
+func (slice *jsonSlice) bounds(length int) (int, int) {
+	bound := func(value *int, fallback int) int {
+		if value == nil {
+			return fallback
+		}
+		position := *value
+		if position < 0 {
+			position += length
+		}
+		if position < 0 {
+			return 0
+		}
+		if position > length {
+			return length
+		}
+		return position
+	}
+	return bound(slice.start, 0), bound(slice.end, length)
+}
+
+func (filter *jsonFilter) match(value interface{}) bool {
+	for _, key := range filter.path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = object[key]; !ok {
+			return false
+		}
+	}
+	formatted, _ := formatJSONValue(value)
+	if value == nil {
+		formatted = "null"
+	}
+	switch filter.operator {
+	case "":
+		return true
+	case "==":
+		return formatted == filter.value
+	case "!=":
+		return formatted != filter.value
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return false
+	}
+	left, err := number.Float64()
+	if err != nil {
+		return false
+	}
+	right, _ := strconv.ParseFloat(filter.value, 64)
+	switch filter.operator {
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	}
+	return left >= right
+}
+
+// jsonChildren returns the elements of an array or the values of an object, sorted by key
+func jsonChildren(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		children := make([]interface{}, 0, len(v))
+		for _, key := range keys {
+			children = append(children, v[key])
+		}
+		return children
+	}
+	return nil
+}
+
+// jsonDescendants returns the value followed by all its descendants
+func jsonDescendants(value interface{}, descendants []interface{}) []interface{} {
+	descendants = append(descendants, value)
+	for _, child := range jsonChildren(value) {
+		descendants = jsonDescendants(child, descendants)
+	}
+	return descendants
+}
+
+// formatJSONValue returns the scalars as is and the objects and arrays as compact json, null is skipped
+func formatJSONValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,133 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const jsonDocument = `{
+	"version": "2.4.1",
+	"debug": false,
+	"count": 3,
+	"owner": null,
+	"meta": {"name": "api", "tags": ["a", "b"]},
+	"dotted.key": "dotted",
+	"items": [
+		{"id": 1, "name": "one", "price": 10, "active": true},
+		{"id": 2, "name": "two", "price": 25.5, "active": false, "meta": {"name": "nested"}},
+		{"id": 3, "name": "three", "price": 40, "active": true, "owner": null}
+	]
+}`
+
+func TestJSONPath(t *testing.T) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(jsonDocument)))
+	decoder.UseNumber()
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		t.Fatalf("could not parse document: %s", err)
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		// members
+		{`$.version`, []string{"2.4.1"}},
+		{`version`, []string{"2.4.1"}},
+		{`.version`, []string{"2.4.1"}},
+		{`$['version']`, []string{"2.4.1"}},
+		{`$["dotted.key"]`, []string{"dotted"}},
+		{`$.meta.name`, []string{"api"}},
+		{`$.debug`, []string{"false"}},
+		{`$.count`, []string{"3"}},
+		{`$.owner`, nil},
+		{`$.missing`, nil},
+		{`$.meta`, []string{`{"name":"api","tags":["a","b"]}`}},
+		{`$.meta.tags`, []string{`["a","b"]`}},
+
+		// indexes and wildcards
+		{`$.items[0].name`, []string{"one"}},
+		{`$.items[-1].name`, []string{"three"}},
+		{`$.items[5].name`, nil},
+		{`$.meta.tags[*]`, []string{"a", "b"}},
+		{`$.meta.*`, []string{"api", `["a","b"]`}},
+		{`$.items[*].id`, []string{"1", "2", "3"}},
+
+		// slices
+		{`$.items[-1:].name`, []string{"three"}},
+		{`$.items[:2].name`, []string{"one", "two"}},
+		{`$.items[1:].name`, []string{"two", "three"}},
+		{`$.items[0:3:2].name`, []string{"one", "three"}},
+		{`$.items[::2].id`, []string{"1", "3"}},
+		{`$.items[-2:-1].name`, []string{"two"}},
+		{`$.items[5:].name`, nil},
+		{`$.items[:-5].name`, nil},
+
+		// recursive descent
+		{`$..name`, []string{"one", "two", "nested", "three", "api"}},
+		{`$..tags[0]`, []string{"a"}},
+		{`$..*.id`, []string{"1", "2", "3"}},
+
+		// filters
+		{`$.items[?(@.meta)].id`, []string{"2"}},
+		{`$.items[?(@.name == 'two')].price`, []string{"25.5"}},
+		{`$.items[?(@.name != "two")].id`, []string{"1", "3"}},
+		{`$.items[?(@.active == true)].name`, []string{"one", "three"}},
+		{`$.items[?(@.owner == null)].id`, []string{"3"}},
+		{`$.items[?(@.meta.name == 'nested')].id`, []string{"2"}},
+		{`$.items[?(@.price > 20)].name`, []string{"two", "three"}},
+		{`$.items[?(@.price >= 40)].name`, []string{"three"}},
+		{`$.items[?(@.price < 25.5)].name`, []string{"one"}},
+		{`$.items[?(@.price <= 25.5)].name`, []string{"one", "two"}},
+		{`$.items[?(@.name > 1)].name`, nil},
+		{`$.meta.tags[?(@ == 'b')]`, []string{"b"}},
+	}
+	for _, test := range tests {
+		steps, err := compileJSONPath(test.expr)
+		if err != nil {
+			t.Errorf("compileJSONPath(%q) returned error: %s", test.expr, err)
+			continue
+		}
+		if got := evaluateJSONPath(steps, root); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("evaluateJSONPath(%q) = %q, want %q", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestJSONPathErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{`$.`, "missing name after ."},
+		{`$..`, "missing name after .."},
+		{`$.items[0`, "unterminated ["},
+		{`$.items[a]`, "invalid subscript [a]"},
+		{`$x`, `unexpected 'x'`},
+		{`$.items[0,1]`, "unsupported union [0,1]"},
+		{`$['a','b']`, "unsupported union"},
+		{`$.items[(@.length-1)]`, "unsupported script expression"},
+		{`$.items[1:2:0]`, "unsupported slice step 0"},
+		{`$.items[::-1]`, "unsupported slice step -1"},
+		{`$.items[1:2:3:4]`, "invalid slice"},
+		{`$.items[a:]`, "invalid slice"},
+		{`$.items[?(name == 'x')]`, "filters must start with @"},
+		{`$.items[?(@.a == 1 && @.b == 2)]`, "only a single condition is supported"},
+		{`$.items[?(@.a || @.b)]`, "only a single condition is supported"},
+		{`$.items[?(@.a =~ /x/)]`, "unsupported filter"},
+		{`$.items[?(@.price > 'x')]`, "the > operator expects a number"},
+	}
+	for _, test := range tests {
+		_, err := compileJSONPath(test.expr)
+		if err == nil {
+			t.Errorf("compileJSONPath(%q) succeeded, want error containing %q", test.expr, test.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("compileJSONPath(%q) error = %q, want error containing %q", test.expr, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,729 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// xpathQuery is a compiled xpath expression. The supported subset is made of the location paths with the child (/),
+// descendant (//), self (.), parent (..) and attribute (@) steps on element names, *, text() and node(), the grouped
+// paths such as (//li)[1], predicates on positions, comparisons (=, !=) and the and, or, not, contains, starts-with,
+// normalize-space, position, last and count functions. The other axes, operators and functions are rejected.
+type xpathQuery struct {
+	expr xpathNode
+}
+
+// xpathExpr is a compiled xpath location path
+type xpathExpr struct {
+	absolute bool
+	steps    []*xpathStep
+}
+
+type xpathStep struct {
+	// descendant is set for the steps following //
+	descendant bool
+	axis       string
+	// test is an element or attribute name, * or the text() and node() node tests
+	test       string
+	predicates []xpathNode
+}
+
+const (
+	axisChild     = "child"
+	axisAttribute = "attribute"
+	axisSelf      = "self"
+	axisParent    = "parent"
+)
+
+// xpathItem is a node selected by a path, either an element, a text node or an attribute of an element
+type xpathItem struct {
+	node *html.Node
+	attr *html.Attribute
+}
+
+// xpathContext is the node a predicate is evaluated on, along with its position among the selected nodes
+type xpathContext struct {
+	item           xpathItem
+	position, size int
+}
+
+// xpathNode is a node of the predicates expressions, evaluating to a bool, a float64, a string or a []xpathItem
+type xpathNode interface {
+	eval(ctx xpathContext) interface{}
+}
+
+func compileXPath(expr string) (*xpathQuery, error) {
+	tokens, err := xpathTokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	p := &xpathParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return &xpathQuery{expr: node}, nil
+}
+
+// evaluate returns the string values of the nodes selected from the document root, or the value
+// of the expression if it isn't a node set (eg count(//a))
+func (q *xpathQuery) evaluate(root *html.Node) []string {
+	if root == nil {
+		return nil
+	}
+	value := q.expr.eval(xpathContext{item: xpathItem{node: root}, position: 1, size: 1})
+	items, ok := value.([]xpathItem)
+	if !ok {
+		if value := xpathString(value); value != "" {
+			return []string{value}
+		}
+		return nil
+	}
+	var values []string
+	for _, item := range items {
+		if value := strings.TrimSpace(item.stringValue()); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// selectItems returns the items selected by the path from the context item, in document order
+func (x *xpathExpr) selectItems(context xpathItem) []xpathItem {
+	current := []xpathItem{context}
+	if x.absolute {
+		root := context.node
+		for root.Parent != nil {
+			root = root.Parent
+		}
+		current = []xpathItem{{node: root}}
+	}
+	for _, step := range x.steps {
+		var next []xpathItem
+		for _, item := range current {
+			contexts := []xpathItem{item}
+			if step.descendant && item.attr == nil {
+				contexts = descendantsOrSelf(item.node, nil)
+			}
+			for _, c := range contexts {
+				next = append(next, step.apply(c)...)
+			}
+		}
+		current = sortDocumentOrder(next)
+	}
+	return current
+}
+
+func (step *xpathStep) apply(context xpathItem) []xpathItem {
+	var candidates []xpathItem
+	switch step.axis {
+	case axisSelf:
+		if step.matches(context) {
+			candidates = append(candidates, context)
+		}
+	case axisParent:
+		parent := xpathItem{node: context.node}
+		if context.attr == nil {
+			parent.node = context.node.Parent
+		}
+		if parent.node != nil && step.matches(parent) {
+			candidates = append(candidates, parent)
+		}
+	case axisAttribute:
+		if context.attr != nil || context.node.Type != html.ElementNode {
+			break
+		}
+		for i := range context.node.Attr {
+			attr := &context.node.Attr[i]
+			if step.test == "*" || step.test == "node()" || strings.EqualFold(attr.Key, step.test) {
+				candidates = append(candidates, xpathItem{node: context.node, attr: attr})
+			}
+		}
+	default:
+		if context.attr != nil {
+			break
+		}
+		for child := context.node.FirstChild; child != nil; child = child.NextSibling {
+			if item := (xpathItem{node: child}); step.matches(item) {
+				candidates = append(candidates, item)
+			}
+		}
+	}
+
+	return filterItems(candidates, step.predicates)
+}
+
+// filterItems returns the items matching the predicates, a number matching the position of the item
+func filterItems(items []xpathItem, predicates []xpathNode) []xpathItem {
+	for _, predicate := range predicates {
+		var kept []xpathItem
+		for i, item := range items {
+			ctx := xpathContext{item: item, position: i + 1, size: len(items)}
+			value := predicate.eval(ctx)
+			if number, ok := value.(float64); ok {
+				if int(number) == ctx.position {
+					kept = append(kept, item)
+				}
+			} else if xpathBool(value) {
+				kept = append(kept, item)
+			}
+		}
+		items = kept
+	}
+	return items
+}
+
+func (step *xpathStep) matches(item xpathItem) bool {
+	if item.attr != nil {
+		return step.test == "node()" || step.test == "*"
+	}
+	switch step.test {
+	case "node()":
+		return true
+	case "text()":
+		return item.node.Type == html.TextNode
+	case "*":
+		return item.node.Type == html.ElementNode
+	}
+	return item.node.Type == html.ElementNode && strings.EqualFold(item.node.Data, step.test)
+}
+
+// stringValue returns the value of an attribute or the text content of a node
+func (item xpathItem) stringValue() string {
+	if item.attr != nil {
+		return item.attr.Val
+	}
+	if item.node.Type == html.TextNode {
+		return item.node.Data
+	}
+	var builder strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			builder.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(item.node)
+	return builder.String()
+}
+
+func descendantsOrSelf(node *html.Node, nodes []xpathItem) []xpathItem {
+	nodes = append(nodes, xpathItem{node: node})
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		nodes = descendantsOrSelf(child, nodes)
+	}
+	return nodes
+}
+
+// sortDocumentOrder removes the duplicates and sorts the items in document order
+func sortDocumentOrder(items []xpathItem) []xpathItem {
+	if len(items) < 2 {
+		return items
+	}
+	root := items[0].node
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	order := make(map[*html.Node]int)
+	for i, item := range descendantsOrSelf(root, nil) {
+		order[item.node] = i
+	}
+	seen := make(map[xpathItem]struct{})
+	unique := items[:0]
+	for _, item := range items {
+		if _, ok := seen[item]; !ok {
+			seen[item] = struct{}{}
+			unique = append(unique, item)
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		a, b := unique[i], unique[j]
+		if a.node != b.node {
+			return order[a.node] < order[b.node]
+		}
+		// the element comes before its attributes
+		return a.attr == nil && b.attr != nil
+	})
+	return unique
+}
+
+type xpathLiteral struct {
+	value interface{}
+}
+
+func (n *xpathLiteral) eval(_ xpathContext) interface{} {
+	return n.value
+}
+
+type xpathPath struct {
+	path *xpathExpr
+}
+
+func (n *xpathPath) eval(ctx xpathContext) interface{} {
+	return n.path.selectItems(ctx.item)
+}
+
+// xpathFilter is a grouped expression followed by predicates and steps, such as (//li)[1]/a
+type xpathFilter struct {
+	expr       xpathNode
+	predicates []xpathNode
+	// path is relative to the filtered nodes, if any
+	path *xpathExpr
+}
+
+func (n *xpathFilter) eval(ctx xpathContext) interface{} {
+	items, _ := n.expr.eval(ctx).([]xpathItem)
+	items = filterItems(items, n.predicates)
+	if n.path == nil {
+		return items
+	}
+	var selected []xpathItem
+	for _, item := range items {
+		selected = append(selected, n.path.selectItems(item)...)
+	}
+	return sortDocumentOrder(selected)
+}
+
+type xpathLogical struct {
+	operator    string
+	left, right xpathNode
+}
+
+func (n *xpathLogical) eval(ctx xpathContext) interface{} {
+	left := xpathBool(n.left.eval(ctx))
+	if n.operator == "and" {
+		return left && xpathBool(n.right.eval(ctx))
+	}
+	return left || xpathBool(n.right.eval(ctx))
+}
+
+type xpathComparison struct {
+	operator    string
+	left, right xpathNode
+}
+
+func (n *xpathComparison) eval(ctx xpathContext) interface{} {
+	return xpathCompare(n.operator, n.left.eval(ctx), n.right.eval(ctx))
+}
+
+type xpathCall struct {
+	name string
+	args []xpathNode
+}
+
+func (n *xpathCall) eval(ctx xpathContext) interface{} {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		args = append(args, arg.eval(ctx))
+	}
+	switch n.name {
+	case "contains":
+		return strings.Contains(xpathString(args[0]), xpathString(args[1]))
+	case "starts-with":
+		return strings.HasPrefix(xpathString(args[0]), xpathString(args[1]))
+	case "not":
+		return !xpathBool(args[0])
+	case "normalize-space":
+		value := ctx.item.stringValue()
+		if len(args) > 0 {
+			value = xpathString(args[0])
+		}
+		return strings.Join(strings.Fields(value), " ")
+	case "position":
+		return float64(ctx.position)
+	case "last":
+		return float64(ctx.size)
+	case "count":
+		items, _ := args[0].([]xpathItem)
+		return float64(len(items))
+	}
+	return nil
+}
+
+// xpathFunctions are the supported functions with their minimum and maximum number of arguments
+var xpathFunctions = map[string][2]int{
+	"contains":        {2, 2},
+	"starts-with":     {2, 2},
+	"not":             {1, 1},
+	"normalize-space": {0, 1},
+	"position":        {0, 0},
+	"last":            {0, 0},
+	"count":           {1, 1},
+}
+
+func xpathBool(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []xpathItem:
+		return len(v) > 0
+	}
+	return false
+}
+
+// xpathString returns the string value of the first node of a node set
+func xpathString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []xpathItem:
+		if len(v) > 0 {
+			return v[0].stringValue()
+		}
+	}
+	return ""
+}
+
+// xpathCompare compares the values with the = or != operator. The comparison of a node set is true
+// if it holds for any of its nodes, so an empty node set is neither equal nor different to a value
+func xpathCompare(operator string, left, right interface{}) bool {
+	if items, ok := left.([]xpathItem); ok {
+		for _, item := range items {
+			if xpathCompare(operator, item.stringValue(), right) {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := right.([]xpathItem); ok {
+		return xpathCompare(operator, right, left)
+	}
+	return xpathEqual(left, right) == (operator == "=")
+}
+
+// xpathEqual compares two values which are not node sets
+func xpathEqual(left, right interface{}) bool {
+	if number, ok := right.(float64); ok {
+		value, err := strconv.ParseFloat(strings.TrimSpace(xpathString(left)), 64)
+		return err == nil && value == number
+	}
+	if number, ok := left.(float64); ok {
+		return xpathEqual(right, number)
+	}
+	return xpathString(left) == xpathString(right)
+}
+
+type xpathParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *xpathParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *xpathParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *xpathParser) expect(token string) error {
+	if got := p.next(); got != token {
+		return fmt.Errorf("expected %q, got %q", token, got)
+	}
+	return nil
+}
+
+func (p *xpathParser) parsePath() (*xpathExpr, error) {
+	path := &xpathExpr{}
+	descendant := false
+	switch p.peek() {
+	case "/":
+		path.absolute = true
+		p.next()
+		// a lone / selects the document
+		if p.peek() == "" || p.peek() == "]" || p.peek() == ")" {
+			return path, nil
+		}
+	case "//":
+		path.absolute = true
+		descendant = true
+		p.next()
+	}
+	return path, p.parseSteps(path, descendant)
+}
+
+// parseSteps appends the steps of a path to path, the first one following / or // if descendant is set
+func (p *xpathParser) parseSteps(path *xpathExpr, descendant bool) error {
+	for {
+		step, err := p.parseStep()
+		if err != nil {
+			return err
+		}
+		step.descendant = descendant
+		path.steps = append(path.steps, step)
+		switch p.peek() {
+		case "/":
+			descendant = false
+		case "//":
+			descendant = true
+		default:
+			return nil
+		}
+		p.next()
+	}
+}
+
+func (p *xpathParser) parseStep() (*xpathStep, error) {
+	step := &xpathStep{axis: axisChild}
+	token := p.next()
+	switch {
+	case token == ".":
+		step.axis, step.test = axisSelf, "node()"
+	case token == "..":
+		step.axis, step.test = axisParent, "node()"
+	case token == "@":
+		step.axis = axisAttribute
+		step.test = p.next()
+		if !isXPathName(step.test) && step.test != "*" {
+			return nil, fmt.Errorf("invalid attribute name %q", step.test)
+		}
+	case token == "*":
+		step.test = token
+	case (token == "text" || token == "node") && p.peek() == "(":
+		p.next()
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		step.test = token + "()"
+	case strings.Contains(token, "::"):
+		return nil, fmt.Errorf("unsupported axis %q", token[:strings.Index(token, "::")])
+	case isXPathName(token):
+		step.test = token
+	default:
+		return nil, fmt.Errorf("unexpected %q", token)
+	}
+	var err error
+	step.predicates, err = p.parsePredicates()
+	return step, err
+}
+
+func (p *xpathParser) parsePredicates() ([]xpathNode, error) {
+	var predicates []xpathNode
+	for p.peek() == "[" {
+		p.next()
+		predicate, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, predicate)
+	}
+	return predicates, nil
+}
+
+func (p *xpathParser) parseOr() (xpathNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &xpathLogical{operator: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *xpathParser) parseAnd() (xpathNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &xpathLogical{operator: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *xpathParser) parseComparison() (xpathNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if operator := p.peek(); operator == "=" || operator == "!=" {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &xpathComparison{operator: operator, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *xpathParser) parseOperand() (xpathNode, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, errors.New("unexpected end of expression")
+	case token == "(":
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next != "[" && next != "/" && next != "//" {
+			return node, nil
+		}
+		if !isNodeSet(node) {
+			return nil, errors.New("only node sets can be filtered")
+		}
+		filter := &xpathFilter{expr: node}
+		if filter.predicates, err = p.parsePredicates(); err != nil {
+			return nil, err
+		}
+		if separator := p.peek(); separator == "/" || separator == "//" {
+			p.next()
+			filter.path = &xpathExpr{}
+			if err := p.parseSteps(filter.path, separator == "//"); err != nil {
+				return nil, err
+			}
+		}
+		return filter, nil
+	case token[0] == '\'' || token[0] == '"':
+		p.next()
+		return &xpathLiteral{value: token[1 : len(token)-1]}, nil
+	case token[0] >= '0' && token[0] <= '9':
+		p.next()
+		number, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token)
+		}
+		return &xpathLiteral{value: number}, nil
+	}
+	isCall := p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == "("
+	if _, ok := xpathFunctions[token]; !ok && isCall && token != "text" && token != "node" {
+		return nil, fmt.Errorf("unsupported function %s()", token)
+	}
+	if limits, ok := xpathFunctions[token]; ok && isCall {
+		p.pos += 2
+		call := &xpathCall{name: token}
+		for p.peek() != ")" {
+			if len(call.args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+		p.next()
+		if len(call.args) < limits[0] || len(call.args) > limits[1] {
+			return nil, fmt.Errorf("invalid number of arguments for %s()", token)
+		}
+		if token == "count" && !isNodeSet(call.args[0]) {
+			return nil, errors.New("count() expects a node set")
+		}
+		return call, nil
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return &xpathPath{path: path}, nil
+}
+
+// isNodeSet reports whether the expression evaluates to a node set
+func isNodeSet(node xpathNode) bool {
+	switch node.(type) {
+	case *xpathPath, *xpathFilter:
+		return true
+	}
+	return false
+}
+
+func isXPathName(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i, c := range token {
+		isLetter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || (c != '-' && c != '.' && c != ':' && (c < '0' || c > '9'))) {
+			return false
+		}
+	}
+	return true
+}
+
+// xpathTokenize splits the expression in operators, names, numbers and quoted strings
+func xpathTokenize(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.HasPrefix(expr[i:], "//"), strings.HasPrefix(expr[i:], ".."), strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case strings.ContainsRune("<>|+$", rune(c)):
+			return nil, fmt.Errorf("unsupported operator %q at %d", c, i)
+		case strings.ContainsRune("/[]()@,=*", rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		case c == '.' && (i+1 == len(expr) || expr[i+1] < '0' || expr[i+1] > '9'):
+			tokens = append(tokens, ".")
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\n/[]()@,=!*'\"<>|+$", rune(expr[i])) {
+				i++
+			}
+			if start == i {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, expr[start:i])
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,125 @@
+package extractor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const xpathDocument = `<html><head><title>Shop</title><meta name="generator" content="WordPress 6.1"></head>
+<body>
+<div id="nav" class="menu"><a href="/home">Home</a> <a href="/about" rel="nofollow">About</a></div>
+<ul>
+<li class="item">one</li>
+<li class="item special">two <a href="/two">link</a></li>
+<li>  three   items  </li>
+</ul>
+<ol><li>first</li><li>second</li></ol>
+<form><input name="csrf" value="token123"><input name="user" value=""></form>
+</body></html>`
+
+func TestXPath(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(xpathDocument))
+	if err != nil {
+		t.Fatalf("could not parse document: %s", err)
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		// paths
+		{`/html/head/title`, []string{"Shop"}},
+		{`//title`, []string{"Shop"}},
+		{`//TITLE`, []string{"Shop"}},
+		{`//ul/li`, []string{"one", "two link", "three   items"}},
+		{`//div/*`, []string{"Home", "About"}},
+		{`//div//text()`, []string{"Home", "About"}},
+		{`//li/a/..`, []string{"two link"}},
+		{`//title/.`, []string{"Shop"}},
+		{`//li//a/@href`, []string{"/two"}},
+		{`//div/a/@*`, []string{"/home", "/about", "nofollow"}},
+		{`//ul/li[1]/node()`, []string{"one"}},
+		{`//missing`, nil},
+
+		// attributes and comparisons
+		{`//meta[@name='generator']/@content`, []string{"WordPress 6.1"}},
+		{`//input[@name="csrf"]/@value`, []string{"token123"}},
+		{`//input[@name='user']/@value`, nil},
+		{`//a[@rel]`, []string{"About"}},
+		{`//a[not(@rel)]/@href`, []string{"/home", "/two"}},
+		{`//li[@class != 'item']`, []string{"two link"}},
+		{`//div[@id='nav' and @class='menu']/a[2]`, []string{"About"}},
+		{`//a[@href='/home' or @href='/two']`, []string{"Home", "link"}},
+		{`//li[(@class='item' or @class='x') and position()=1]`, []string{"one"}},
+		{`//li[a = 'link']`, []string{"two link"}},
+
+		// positions
+		{`//ul/li[2]`, []string{"two link"}},
+		{`//ul/li[last()]`, []string{"three   items"}},
+		{`//ul/li[position() != 1]`, []string{"two link", "three   items"}},
+		{`//li[1]`, []string{"one", "first"}},
+		{`(//li)[1]`, []string{"one"}},
+		{`(//li)[last()]`, []string{"second"}},
+		{`(//li)[2]/a/@href`, []string{"/two"}},
+		{`(//ul)//a`, []string{"link"}},
+
+		// functions
+		{`//li[contains(@class, 'special')]`, []string{"two link"}},
+		{`//a[starts-with(@href, '/a')]`, []string{"About"}},
+		{`//li[normalize-space() = 'three items']`, []string{"three   items"}},
+		{`//li[normalize-space(.) = 'three items']`, []string{"three   items"}},
+		{`count(//li)`, []string{"5"}},
+		{`count(//ul/li[@class])`, []string{"2"}},
+		{`count(//missing)`, []string{"0"}},
+		{`normalize-space(//ul/li[3])`, []string{"three items"}},
+		{`contains(//title, 'Sh')`, []string{"true"}},
+	}
+	for _, test := range tests {
+		query, err := compileXPath(test.expr)
+		if err != nil {
+			t.Errorf("compileXPath(%q) returned error: %s", test.expr, err)
+			continue
+		}
+		if got := query.evaluate(root); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("evaluate(%q) = %q, want %q", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestXPathErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{``, "empty expression"},
+		{`//li[`, "unexpected end of expression"},
+		{`//li[1`, `expected "]"`},
+		{`//a[@href='x]`, "unterminated string"},
+		{`//@`, "invalid attribute name"},
+		{`//li)`, `unexpected ")"`},
+		{`//ul/li | //ol/li`, `unsupported operator '|'`},
+		{`//li[position() < 3]`, `unsupported operator '<'`},
+		{`//li[position() > 1]`, `unsupported operator '>'`},
+		{`//li[$n]`, `unsupported operator '$'`},
+		{`//child::li`, `unsupported axis "child"`},
+		{`//li/following-sibling::li`, `unsupported axis "following-sibling"`},
+		{`string(//title)`, "unsupported function string()"},
+		{`//li[string-length(.) = 3]`, "unsupported function string-length()"},
+		{`//li[contains(.)]`, "invalid number of arguments for contains()"},
+		{`count('a')`, "count() expects a node set"},
+		{`('a')[1]`, "only node sets can be filtered"},
+	}
+	for _, test := range tests {
+		_, err := compileXPath(test.expr)
+		if err == nil {
+			t.Errorf("compileXPath(%q) succeeded, want error containing %q", test.expr, test.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("compileXPath(%q) error = %q, want error containing %q", test.expr, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+// Package har writes http exchanges as HAR 1.2 (HTTP Archive) files
+package har
@@ -0,0 +1,159 @@
+package har
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewRequest builds a HAR request from the dump of an http request sent to rawURL
+func NewRequest(rawURL string, dump []byte) (Request, error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(dump)))
+	if err != nil {
+		return Request{}, err
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	headers, headersSize := parseHeaders(dump)
+	return newRequest(rawURL, req, body, headers, headersSize), nil
+}
+
+// NewRequestFromHTTP builds a HAR request from the fields of the http request sent to rawURL,
+// for the dumps that can't be parsed back such as the ones of unsafe requests. The size of
+// the header block is unknown and set to -1
+func NewRequestFromHTTP(rawURL string, req *http.Request, body []byte) Request {
+	headers := []NameValue{}
+	if _, ok := req.Header["Host"]; !ok && req.Host != "" {
+		headers = append(headers, NameValue{Name: "Host", Value: req.Host})
+	}
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			headers = append(headers, NameValue{Name: name, Value: strings.TrimSpace(value)})
+		}
+	}
+	return newRequest(rawURL, req, body, headers, -1)
+}
+
+func newRequest(rawURL string, req *http.Request, body []byte, headers []NameValue, headersSize int) Request {
+	proto := req.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	request := Request{
+		Method:      req.Method,
+		URL:         rawURL,
+		HTTPVersion: proto,
+		Cookies:     []Cookie{},
+		Headers:     headers,
+		QueryString: []NameValue{},
+		HeadersSize: headersSize,
+		BodySize:    len(body),
+	}
+	for _, cookie := range req.Cookies() {
+		request.Cookies = append(request.Cookies, Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		for name, values := range u.Query() {
+			for _, value := range values {
+				request.QueryString = append(request.QueryString, NameValue{Name: name, Value: value})
+			}
+		}
+	}
+	if len(body) > 0 {
+		request.PostData = &PostData{MimeType: req.Header.Get("Content-Type"), Text: string(body)}
+	}
+	return request
+}
+
+// NewResponse builds a HAR response from the dump of the http response received for
+// requestURL. The body is read from the dump when nil
+func NewResponse(requestURL string, dump, body []byte) (Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), nil)
+	if err != nil {
+		return Response{}, err
+	}
+	bodySize := len(body)
+	if body == nil {
+		body, _ = ioutil.ReadAll(resp.Body)
+		bodySize = len(body)
+		// redirect bodies are drained by the client and missing from the dump
+		if bodySize == 0 && resp.ContentLength > 0 {
+			bodySize = int(resp.ContentLength)
+		}
+	}
+	headers, headersSize := parseHeaders(dump)
+
+	response := Response{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Cookies:     []Cookie{},
+		Headers:     headers,
+		Content: Content{
+			Size:     len(body),
+			MimeType: resp.Header.Get("Content-Type"),
+		},
+		HeadersSize: headersSize,
+		BodySize:    bodySize,
+	}
+	if utf8.Valid(body) {
+		response.Content.Text = string(body)
+	} else {
+		response.Content.Text = base64.StdEncoding.EncodeToString(body)
+		response.Content.Encoding = "base64"
+	}
+	for _, cookie := range resp.Cookies() {
+		harCookie := Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if !cookie.Expires.IsZero() {
+			harCookie.Expires = FormatTime(cookie.Expires)
+		}
+		response.Cookies = append(response.Cookies, harCookie)
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		response.RedirectURL = location
+		if base, err := url.Parse(requestURL); err == nil {
+			if next, err := base.Parse(location); err == nil {
+				response.RedirectURL = next.String()
+			}
+		}
+	}
+	return response, nil
+}
+
+// parseHeaders returns the headers of a dump in their original order and the size of
+// the header block, start line and blank line included
+func parseHeaders(dump []byte) ([]NameValue, int) {
+	headers := []NameValue{}
+	block := dump
+	size := len(dump)
+	if end := bytes.Index(dump, []byte("\r\n\r\n")); end >= 0 {
+		block, size = dump[:end], end+4
+	}
+	lines := strings.Split(string(block), "\r\n")
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		headers = append(headers, NameValue{Name: parts[0], Value: strings.TrimSpace(parts[1])})
+	}
+	return headers, size
+}
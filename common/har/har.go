@@ -0,0 +1,182 @@
+package har
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Version is the HAR format version
+const Version = "1.2"
+
+// Creator is the application that created the log
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is a request and its response
+type Entry struct {
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	ServerIPAddress string   `json:"serverIPAddress,omitempty"`
+	Comment         string   `json:"comment,omitempty"`
+}
+
+// Request is the request of an entry
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// Response is the response of an entry
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// NameValue is a header or a query string parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie is a cookie sent or set
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// PostData is the body of a request
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// Content is the body of a response
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Timings are the phases of a request in milliseconds, -1 when not applicable.
+// The ssl time is included in the connect time
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Total returns the time of the request, the sum of the applicable phases but ssl
+func (t Timings) Total() float64 {
+	var total float64
+	for _, phase := range []float64{t.Blocked, t.DNS, t.Connect, t.Send, t.Wait, t.Receive} {
+		if phase > 0 {
+			total += phase
+		}
+	}
+	return total
+}
+
+// Milliseconds converts a duration to HAR milliseconds, -1 for negative durations
+func Milliseconds(d time.Duration) float64 {
+	if d < 0 {
+		return -1
+	}
+	return float64(d.Microseconds()) / 1000
+}
+
+// FormatTime formats the start time of an entry
+func FormatTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// Writer streams the entries to a HAR file, which is completed on Close
+type Writer struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries int
+}
+
+// New creates the HAR file at path
+func New(path string, creator Creator) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	creatorJSON, err := json.Marshal(creator)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.WriteString(`{"log":{"version":"` + Version + `","creator":` + string(creatorJSON) + `,"pages":[],"entries":[`); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Writer{file: file}, nil
+}
+
+// Write appends the entries to the log
+func (w *Writer) Write(entries ...Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if w.entries > 0 {
+			data = append([]byte(",\n"), data...)
+		} else {
+			data = append([]byte("\n"), data...)
+		}
+		if _, err := w.file.Write(data); err != nil {
+			return err
+		}
+		w.entries++
+	}
+	return nil
+}
+
+// Close completes the log and closes the file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.WriteString("\n]}}\n"); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"strconv"
 
 	"github.com/mfonda/simhash"
 	"github.com/spaolacci/murmur3"
@@ -63,3 +64,16 @@ func Simhash(data []byte) string {
 	hash := simhash.Simhash(simhash.NewWordFeatureSet(data))
 	return fmt.Sprintf("%d", hash)
 }
+
+// SimhashDistance returns the number of differing bits between two hashes returned by Simhash
+func SimhashDistance(a, b string) (int, error) {
+	x, err := strconv.ParseUint(a, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	y, err := strconv.ParseUint(b, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int(simhash.Compare(x, y)), nil
+}
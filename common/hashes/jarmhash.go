@@ -1,6 +1,7 @@
 package hashes
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/url"
@@ -19,36 +20,58 @@ var DefualtBackoff = func(r, m int) time.Duration {
 	return time.Second
 }
 
+// TakeFunc waits until a connection can be opened and returns the function releasing it
+type TakeFunc func(ctx context.Context) (release func(), err error)
+
 type target struct {
 	Host    string
 	Port    int
 	Retries int
 	Backoff func(r, m int) time.Duration
+	Dialer  proxy.Dialer
+	Take    TakeFunc
 }
 
 // fingerprint probes a single host/port
-func fingerprint(t target, duration int) string {
+func fingerprint(ctx context.Context, t target, duration int) string {
 	timeout := time.Duration(duration) * time.Second
 	results := []string{}
 	for _, probe := range jarm.GetProbes(t.Host, t.Port) {
-		dialer := proxy.FromEnvironmentUsing(&net.Dialer{Timeout: timeout})
+		dialer := t.Dialer
+		if dialer == nil {
+			dialer = proxy.FromEnvironmentUsing(&net.Dialer{Timeout: timeout})
+		}
 		addr := net.JoinHostPort(t.Host, fmt.Sprintf("%d", t.Port))
 		c := net.Conn(nil)
 		n := 0
+		release := func() {}
 		for c == nil && n <= t.Retries {
+			// each connection goes through the rate limits
+			if t.Take != nil {
+				var err error
+				if release, err = t.Take(ctx); err != nil {
+					return ""
+				}
+			}
 			// Ignoring error since error message was already being dropped.
 			// Also, if theres an error, c == nil.
-			if c, _ = dialer.Dial("tcp", addr); c != nil || t.Retries == 0 {
+			if c, _ = dialContext(ctx, dialer, addr, timeout); c != nil || t.Retries == 0 {
 				break
 			}
+			release()
 			bo := t.Backoff
 			if bo == nil {
 				bo = DefualtBackoff
 			}
-			time.Sleep(bo(n, t.Retries))
+			select {
+			case <-time.After(bo(n, t.Retries)):
+			case <-ctx.Done():
+				return ""
+			}
 			n++
 		}
 		if c == nil {
+			release()
 			return ""
 		}
 		data := jarm.BuildProbe(probe)
@@ -57,12 +80,14 @@ func fingerprint(t target, duration int) string {
 		if err != nil {
 			results = append(results, "")
 			c.Close()
+			release()
 			continue
 		}
 		_ = c.SetReadDeadline(time.Now().Add(timeout))
 		buff := make([]byte, 1484)
 		_, _ = c.Read(buff)
 		c.Close()
+		release()
 		ans, err := jarm.ParseServerHello(buff, probe)
 		if err != nil {
 			results = append(results, "")
@@ -72,8 +97,21 @@ func fingerprint(t target, duration int) string {
 	}
 	return jarm.RawHashToFuzzyHash(strings.Join(results, ","))
 }
-func Jarm(host string, duration int) string {
-	t := target{}
+
+// dialContext uses the context aware dialer if available
+func dialContext(ctx context.Context, dialer proxy.Dialer, addr string, timeout time.Duration) (net.Conn, error) {
+	if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return contextDialer.DialContext(ctx, "tcp", addr)
+	}
+	return dialer.Dial("tcp", addr)
+}
+
+// Jarm fingerprints the tls server of host, dialing through dialer if set. If take is not nil
+// it is called before each connection to apply the rate limits.
+func Jarm(ctx context.Context, dialer proxy.Dialer, host string, duration int, take TakeFunc) string {
+	t := target{Dialer: dialer, Take: take}
 	if u, err := url.Parse(host); err == nil {
 		if u.Scheme == "http" {
 			return ""
@@ -85,7 +123,7 @@ func Jarm(host string, duration int) string {
 	if t.Port == 0 {
 		t.Port = defaultPort
 	}
-	hash := fingerprint(t, duration)
+	hash := fingerprint(ctx, t, duration)
 	if regexhelper.JarmHashRegex.MatchString(hash) {
 		return ""
 	}
@@ -0,0 +1,2 @@
+// Package hostlimit contains the per host rate limiting and concurrency caps
+package hostlimit
@@ -0,0 +1,192 @@
+package hostlimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bluele/gcache"
+)
+
+const (
+	// DefaultSize is the default number of hosts tracked at the same time
+	DefaultSize = 10000
+	// DefaultBackoff is the first delay applied to a throttling host without Retry-After
+	DefaultBackoff = time.Second
+	// DefaultMaxBackoff is the default maximum delay applied to a throttling host
+	DefaultMaxBackoff = time.Minute
+
+	// a burst of connection resets within the window is considered throttling
+	resetBurst       = 3
+	resetBurstWindow = 10 * time.Second
+)
+
+// Options of the per host limiter
+type Options struct {
+	// RateLimit is the maximum number of requests sent to a host within Per, zero means unlimited
+	RateLimit int
+	Per       time.Duration
+	// MaxConcurrent is the maximum number of in-flight requests to a host, zero means unlimited
+	MaxConcurrent int
+	// Backoff is the first delay applied to a throttling host, doubled at each throttling event up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Size is the number of hosts tracked, the least recently used ones are evicted
+	Size int
+}
+
+// Limiter enforces the rate limit, the concurrency cap and the backoff of each host
+type Limiter struct {
+	options Options
+	hosts   gcache.Cache
+}
+
+// host holds the limits of a single host, bursts are not allowed to avoid tripping WAFs
+type host struct {
+	ratelimiter *Rate
+	slots       chan struct{}
+
+	mu         sync.Mutex
+	notBefore  time.Time
+	backoff    time.Duration
+	resets     int
+	resetsFrom time.Time
+}
+
+// New creates a new per host limiter
+func New(options Options) *Limiter {
+	if options.Per <= 0 {
+		options.Per = time.Second
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = DefaultBackoff
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = DefaultMaxBackoff
+	}
+	if options.Size <= 0 {
+		options.Size = DefaultSize
+	}
+	l := &Limiter{options: options}
+	l.hosts = gcache.New(options.Size).
+		LRU().
+		LoaderFunc(func(key interface{}) (interface{}, error) {
+			return l.newHost(), nil
+		}).
+		Build()
+	return l
+}
+
+func (l *Limiter) newHost() *host {
+	h := &host{}
+	h.ratelimiter = NewRate(l.options.RateLimit, l.options.Per)
+	if l.options.MaxConcurrent > 0 {
+		h.slots = make(chan struct{}, l.options.MaxConcurrent)
+	}
+	return h
+}
+
+func (l *Limiter) host(key string) *host {
+	value, err := l.hosts.Get(key)
+	if err != nil {
+		return l.newHost()
+	}
+	return value.(*host)
+}
+
+// Enabled returns true if any per host rate limit or concurrency cap is set
+func (l *Limiter) Enabled() bool {
+	return l.options.RateLimit > 0 || l.options.MaxConcurrent > 0
+}
+
+// Take blocks until a request to the host is allowed. The returned function
+// must be called once the request completes to free the concurrency slot
+func (l *Limiter) Take(ctx context.Context, key string) (release func(), err error) {
+	h := l.host(key)
+
+	// wait for the backoff of a throttling host to expire
+	h.mu.Lock()
+	wait := time.Until(h.notBefore)
+	h.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := h.ratelimiter.Take(ctx); err != nil {
+		if h.slots != nil {
+			<-h.slots
+		}
+		return nil, err
+	}
+	return func() {
+		if h.slots != nil {
+			<-h.slots
+		}
+	}, nil
+}
+
+// Throttle records a throttling event for the host and delays its next requests.
+// The delay is retryAfter if set, otherwise it grows exponentially with each event
+func (l *Limiter) Throttle(key string, retryAfter time.Duration) time.Duration {
+	h := l.host(key)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.backoff == 0 {
+		h.backoff = l.options.Backoff
+	} else {
+		h.backoff *= 2
+	}
+	if h.backoff > l.options.MaxBackoff {
+		h.backoff = l.options.MaxBackoff
+	}
+	delay := h.backoff
+	if retryAfter > 0 {
+		delay = retryAfter
+	}
+	if delay > l.options.MaxBackoff {
+		delay = l.options.MaxBackoff
+	}
+	if notBefore := time.Now().Add(delay); notBefore.After(h.notBefore) {
+		h.notBefore = notBefore
+	}
+	return delay
+}
+
+// Recover resets the backoff of the host after a successful request
+func (l *Limiter) Recover(key string) {
+	h := l.host(key)
+	h.mu.Lock()
+	h.backoff = 0
+	h.resets = 0
+	h.mu.Unlock()
+}
+
+// ConnectionReset records a connection reset by the host and returns true
+// if the resets came in a burst, which is a sign of throttling
+func (l *Limiter) ConnectionReset(key string) bool {
+	h := l.host(key)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.resetsFrom) > resetBurstWindow {
+		h.resets = 0
+		h.resetsFrom = now
+	}
+	h.resets++
+	return h.resets >= resetBurst
+}
@@ -0,0 +1,61 @@
+package hostlimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Rate spaces the requests evenly within a period, bursts are not allowed to avoid tripping WAFs.
+// A nil Rate is unlimited.
+type Rate struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRate creates a limiter allowing rate requests per period, it returns nil if rate isn't positive
+func NewRate(rate int, per time.Duration) *Rate {
+	if rate <= 0 {
+		return nil
+	}
+	if per <= 0 {
+		per = time.Second
+	}
+	return &Rate{interval: per / time.Duration(rate)}
+}
+
+// Take blocks until the next request is allowed or the context is canceled
+func (r *Rate) Take(ctx context.Context) error {
+	if r == nil {
+		return ctx.Err()
+	}
+	r.mu.Lock()
+	now := time.Now()
+	at := r.next
+	if at.Before(now) {
+		at = now
+	}
+	r.next = at.Add(r.interval)
+	r.mu.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// give the slot back if no later request reserved one
+		r.mu.Lock()
+		if r.next.Equal(at.Add(r.interval)) {
+			r.next = at
+		}
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,55 @@
+package hostlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateSpacing(t *testing.T) {
+	rate := NewRate(20, time.Second)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := rate.Take(context.Background()); err != nil {
+			t.Fatalf("Take returned error: %s", err)
+		}
+	}
+	// the first request isn't delayed, the next ones are 50ms apart
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("5 requests at 20/s took %s, want at least 200ms", elapsed)
+	}
+	if NewRate(0, time.Second) != nil {
+		t.Errorf("NewRate(0) isn't unlimited")
+	}
+}
+
+func TestTakeCanceled(t *testing.T) {
+	limiter := New(Options{RateLimit: 1, Per: time.Hour, MaxConcurrent: 1})
+	release, err := limiter.Take(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Take returned error: %s", err)
+	}
+	release()
+
+	// the next request is an hour away, canceling the context unblocks it
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := limiter.Take(ctx, "example.com")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Take succeeded within the rate limit")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Take wasn't unblocked by the context")
+	}
+
+	// the concurrency slot is given back when the rate limit fails
+	if slots := len(limiter.host("example.com").slots); slots != 0 {
+		t.Errorf("%d concurrency slots held after a canceled request", slots)
+	}
+}
@@ -0,0 +1,153 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/dsa" //nolint
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	// minimum key sizes below which a key is reported as weak
+	minRSAKeySize   = 2048
+	minECDSAKeySize = 256
+)
+
+// CertValidation is the outcome of the validation of the certificate chain presented by a server
+type CertValidation struct {
+	Trusted            bool
+	Error              string
+	HostnameMismatch   bool
+	SelfSigned         bool
+	Expired            bool
+	NotYetValid        bool
+	DaysToExpiry       int
+	SignatureAlgorithm string
+	WeakSignature      bool
+	KeyAlgorithm       string
+	KeySize            int
+	WeakKey            bool
+}
+
+// LoadCABundle reads the pem encoded certificates of a CA bundle into a pool
+func LoadCABundle(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read ca bundle: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in ca bundle '%s'", path)
+	}
+	return pool, nil
+}
+
+// ValidateCertificate validates the chain of the connection against the configured CA bundle
+// or the system roots and reports the hostname, expiry and strength issues of the leaf
+func (h *HTTPX) ValidateCertificate(state *tls.ConnectionState, hostname string) *CertValidation {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := state.PeerCertificates[0]
+	now := time.Now()
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	// the hostname is checked separately to tell a mismatch from a trust error
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         h.rootCAs,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+
+	validation := &CertValidation{
+		Trusted:            err == nil,
+		HostnameMismatch:   leaf.VerifyHostname(hostname) != nil,
+		SelfSigned:         isSelfSigned(leaf),
+		Expired:            now.After(leaf.NotAfter),
+		NotYetValid:        now.Before(leaf.NotBefore),
+		DaysToExpiry:       int(leaf.NotAfter.Sub(now).Hours() / 24),
+		SignatureAlgorithm: leaf.SignatureAlgorithm.String(),
+	}
+	if err != nil {
+		validation.Error = err.Error()
+	}
+	for _, cert := range state.PeerCertificates {
+		// the signature of a trust anchor isn't relevant
+		if cert != leaf && isSelfSigned(cert) {
+			continue
+		}
+		if isWeakSignature(cert.SignatureAlgorithm) {
+			validation.WeakSignature = true
+		}
+	}
+	validation.KeyAlgorithm, validation.KeySize, validation.WeakKey = keyStrength(leaf)
+	return validation
+}
+
+// Issues summarizes the validation outcome
+func (v *CertValidation) Issues() []string {
+	var issues []string
+	if v.Trusted {
+		issues = append(issues, "trusted")
+	} else {
+		issues = append(issues, "untrusted")
+	}
+	flags := []struct {
+		set  bool
+		name string
+	}{
+		{v.SelfSigned, "self-signed"},
+		{v.HostnameMismatch, "hostname-mismatch"},
+		{v.Expired, "expired"},
+		{v.NotYetValid, "not-yet-valid"},
+		{v.WeakSignature, "weak-signature"},
+		{v.WeakKey, "weak-key"},
+	}
+	for _, flag := range flags {
+		if flag.set {
+			issues = append(issues, flag.name)
+		}
+	}
+	return append(issues, fmt.Sprintf("%dd", v.DaysToExpiry))
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+func isWeakSignature(algorithm x509.SignatureAlgorithm) bool {
+	switch algorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
+
+// keyStrength returns the algorithm and size of the certificate public key and whether it's weak
+func keyStrength(cert *x509.Certificate) (algorithm string, size int, weak bool) {
+	algorithm = strings.ToLower(cert.PublicKeyAlgorithm.String())
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		size = key.N.BitLen()
+		return algorithm, size, size < minRSAKeySize
+	case *ecdsa.PublicKey:
+		size = key.Curve.Params().BitSize
+		return algorithm, size, size < minECDSAKeySize
+	case ed25519.PublicKey:
+		return algorithm, 256, false
+	case *dsa.PublicKey:
+		// dsa is deprecated whatever the size
+		return algorithm, key.P.BitLen(), true
+	}
+	return algorithm, 0, false
+}
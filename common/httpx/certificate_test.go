@@ -0,0 +1,70 @@
+package httpx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateCertificateValidity(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		notBefore   time.Time
+		notAfter    time.Time
+		expired     bool
+		notYetValid bool
+		issues      []string
+	}{
+		{"valid", now.Add(-time.Hour), now.Add(48 * time.Hour), false, false, []string{"untrusted", "self-signed", "1d"}},
+		{"expired", now.Add(-48 * time.Hour), now.Add(-time.Hour), true, false, []string{"untrusted", "self-signed", "expired", "0d"}},
+		{"not yet valid", now.Add(time.Hour), now.Add(48 * time.Hour), false, true, []string{"untrusted", "self-signed", "not-yet-valid", "1d"}},
+	}
+	for _, test := range tests {
+		cert := selfSignedCertificate(t, test.notBefore, test.notAfter)
+		validation := (&HTTPX{}).ValidateCertificate(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, "example.com")
+		if validation.Trusted {
+			t.Errorf("%s: self-signed certificate reported as trusted", test.name)
+		}
+		if validation.Expired != test.expired || validation.NotYetValid != test.notYetValid {
+			t.Errorf("%s: expired = %v, not yet valid = %v, want %v and %v", test.name, validation.Expired, validation.NotYetValid, test.expired, test.notYetValid)
+		}
+		if issues := validation.Issues(); !reflect.DeepEqual(issues, test.issues) {
+			t.Errorf("%s: issues = %v, want %v", test.name, issues, test.issues)
+		}
+	}
+}
+
+func selfSignedCertificate(t *testing.T, notBefore, notAfter time.Time) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		// a self-signed certificate signs itself
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("could not parse certificate: %s", err)
+	}
+	return cert
+}
@@ -0,0 +1,169 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"sync"
+
+	"github.com/projectdiscovery/fastdialer/fastdialer"
+)
+
+// Phases of a request, in order
+const (
+	PhaseDNS     = "dns"
+	PhaseConnect = "connect"
+	PhaseTLS     = "tls"
+	PhaseHTTP    = "http"
+)
+
+// RequestError is a failed request along with the phase it failed in
+type RequestError struct {
+	Phase string
+	Err   error
+}
+
+func (e *RequestError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error
+func (e *RequestError) Unwrap() error { return e.Err }
+
+// ConnectError is the failure to connect to a host which was resolved, which the
+// dialer only reports as an address not found. Err is the error of the last connection
+// attempt, when the request was traced
+type ConnectError struct {
+	Addr string
+	Err  error
+}
+
+func (e *ConnectError) Error() string {
+	var opErr *net.OpError
+	if errors.As(e.Err, &opErr) {
+		return opErr.Error()
+	}
+	return "dial tcp " + e.Addr + ": " + e.Err.Error()
+}
+
+// Timeout reports whether the connection timed out
+func (e *ConnectError) Timeout() bool {
+	netErr, ok := e.Err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// Temporary is part of the net.Error interface
+func (e *ConnectError) Temporary() bool { return e.Timeout() }
+
+// Unwrap returns the cause of the failure
+func (e *ConnectError) Unwrap() error { return e.Err }
+
+// connectError returns a ConnectError if the dialer failed to connect to the resolved host,
+// with the error of the last attempt recorded by the progress of the request if any
+func connectError(ctx context.Context, addr string, err error) error {
+	if err != fastdialer.NoAddressFoundError {
+		return err
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if p, ok := ctx.Value(requestProgressKey{}).(*requestProgress); ok {
+		p.mu.Lock()
+		if p.connectErr != nil {
+			err = p.connectErr
+		}
+		p.mu.Unlock()
+	}
+	return &ConnectError{Addr: addr, Err: err}
+}
+
+// dnsError returns the failure to resolve host as a net.DNSError
+func dnsError(host string, err error) error {
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		return dnsErr
+	}
+	if err == nil {
+		return &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	netErr, ok := err.(net.Error)
+	return &net.DNSError{Err: err.Error(), Name: host, IsTimeout: ok && netErr.Timeout()}
+}
+
+// requestProgress records how far a request went, to tell the phase it failed in
+// when the transport gives up on a connection because of the timeout, and why the
+// connection failed, which the dialer doesn't report
+type requestProgress struct {
+	mu          sync.Mutex
+	resolving   bool
+	resolved    bool
+	connected   bool
+	handshaking bool
+	handshaked  bool
+	// connectErr is the error of the last connection attempt, which the dialer doesn't return
+	connectErr error
+}
+
+// requestProgressKey is the context key of the progress of a request
+type requestProgressKey struct{}
+
+// withContext returns ctx with the progress recorded and available to the dialer
+func (p *requestProgress) withContext(ctx context.Context) context.Context {
+	return context.WithValue(httptrace.WithClientTrace(ctx, p.clientTrace()), requestProgressKey{}, p)
+}
+
+func (p *requestProgress) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			p.mu.Lock()
+			p.resolving, p.resolved = true, false
+			p.mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			p.mu.Lock()
+			p.resolved = info.Err == nil
+			p.mu.Unlock()
+		},
+		ConnectStart: func(_, _ string) {
+			p.mu.Lock()
+			p.connected, p.connectErr = false, nil
+			p.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			p.mu.Lock()
+			p.connected, p.connectErr = err == nil, err
+			p.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			p.mu.Lock()
+			p.handshaking, p.handshaked = true, false
+			p.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			p.mu.Lock()
+			p.handshaked = err == nil
+			p.mu.Unlock()
+		},
+	}
+}
+
+// wrap returns err as a RequestError with the phase the request failed in
+func (p *requestProgress) wrap(err error) error {
+	if p == nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var phase string
+	switch {
+	case p.resolving && !p.resolved:
+		phase = PhaseDNS
+	case !p.connected:
+		phase = PhaseConnect
+	case p.handshaking && !p.handshaked:
+		phase = PhaseTLS
+	default:
+		phase = PhaseHTTP
+	}
+	return &RequestError{Phase: phase, Err: err}
+}
@@ -23,10 +23,11 @@ const (
 )
 
 // SupportHTTP2 checks if the target host supports HTTP2
-func (h *HTTPX) SupportHTTP2(protocol, method, targetURL string) bool {
+func (h *HTTPX) SupportHTTP2(ctx context.Context, protocol, method, targetURL string) bool {
+	ctx = h.WithProxy(ctx)
 	// http => supports HTTP1.1 => HTTP/2 (H2C)
 	if protocol == HTTP {
-		req, err := retryablehttp.NewRequest(method, targetURL, nil)
+		req, err := retryablehttp.NewRequestWithContext(ctx, method, targetURL, nil)
 		if err != nil {
 			return false
 		}
@@ -48,7 +49,7 @@ func (h *HTTPX) SupportHTTP2(protocol, method, targetURL string) bool {
 	}
 
 	// attempts a direct http2 connection
-	req, err := http.NewRequestWithContext(context.Background(), method, targetURL, nil)
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, nil)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,110 @@
+package httpx
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// AltSvc is an alternative service advertised by the Alt-Svc header
+type AltSvc struct {
+	Protocol string
+	Host     string
+	Port     string
+}
+
+// ParseAltSvc parses the Alt-Svc header values (RFC 7838), skipping the malformed entries
+func ParseAltSvc(values []string) []AltSvc {
+	var services []AltSvc
+	for _, value := range values {
+		for _, entry := range splitQuoted(value, ',') {
+			// the parameters (ma, persist) follow the alternative
+			alternative := strings.TrimSpace(splitQuoted(entry, ';')[0])
+			if alternative == "" || strings.EqualFold(alternative, "clear") {
+				continue
+			}
+			parts := strings.SplitN(alternative, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			authority := strings.Trim(strings.TrimSpace(parts[1]), `"`)
+			host, port, err := net.SplitHostPort(authority)
+			if err != nil || port == "" {
+				continue
+			}
+			services = append(services, AltSvc{Protocol: strings.TrimSpace(parts[0]), Host: host, Port: port})
+		}
+	}
+	return services
+}
+
+// splitQuoted splits s on sep outside of double quotes
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// SupportHTTP3 checks if the HTTP3 endpoints advertised in the response Alt-Svc header
+// accept a QUIC handshake and returns the negotiated protocols
+func (h *HTTPX) SupportHTTP3(ctx context.Context, host string, resp *Response) []string {
+	// udp can't go through the proxies, probing directly would leak the scanner address
+	if h.proxies != nil || resp == nil {
+		return nil
+	}
+
+	endpoints := make(map[string][]string)
+	var order []string
+	for _, service := range ParseAltSvc(resp.Headers["Alt-Svc"]) {
+		if !strings.HasPrefix(service.Protocol, "h3") {
+			continue
+		}
+		serviceHost := service.Host
+		if serviceHost == "" {
+			serviceHost = host
+		}
+		addr := net.JoinHostPort(serviceHost, service.Port)
+		if _, ok := endpoints[addr]; !ok {
+			order = append(order, addr)
+		}
+		endpoints[addr] = append(endpoints[addr], service.Protocol)
+	}
+
+	var versions []string
+	seen := make(map[string]struct{})
+	for _, addr := range order {
+		version, err := h.probeHTTP3(ctx, host, addr, endpoints[addr])
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[version]; !ok {
+			seen[version] = struct{}{}
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+func (h *HTTPX) probeHTTP3(ctx context.Context, serverName, addr string, alpn []string) (string, error) {
+	if h.Options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Options.Timeout)
+		defer cancel()
+	}
+	conn, err := h.Dialer.Dial(ctx, "udp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return quicHandshake(ctx, conn, serverName, alpn)
+}
@@ -2,11 +2,12 @@ package httpx
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
+	"net/http/httptrace"
 	"strconv"
 	"strings"
 	"time"
@@ -34,6 +35,8 @@ type HTTPX struct {
 	CustomHeaders map[string]string
 	cdn           *cdncheck.Client
 	Dialer        *fastdialer.Dialer
+	proxies       *proxyPool
+	rootCAs       *x509.CertPool
 }
 
 // New httpx instance
@@ -55,6 +58,12 @@ func New(options *Options) (*HTTPX, error) {
 
 	httpx.Options = options
 
+	if options.CABundle != "" {
+		if httpx.rootCAs, err = LoadCABundle(options.CABundle); err != nil {
+			return nil, err
+		}
+	}
+
 	httpx.Options.parseCustomCookies()
 
 	var retryablehttpOptions = retryablehttp.DefaultOptionsSpraying
@@ -103,8 +112,18 @@ func New(options *Options) (*HTTPX, error) {
 		}
 	}
 
+	if options.RedirectFilter != nil {
+		followRedirect := redirectFunc
+		redirectFunc = func(redirectedRequest *http.Request, previousRequests []*http.Request) error {
+			if !options.RedirectFilter(redirectedRequest.URL) {
+				return http.ErrUseLastResponse
+			}
+			return followRedirect(redirectedRequest, previousRequests)
+		}
+	}
+
 	transport := &http.Transport{
-		DialContext:         httpx.Dialer.Dial,
+		DialContext:         httpx.dialContext,
 		MaxIdleConnsPerHost: -1,
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
@@ -112,12 +131,12 @@ func New(options *Options) (*HTTPX, error) {
 		DisableKeepAlives: true,
 	}
 
-	if httpx.Options.HTTPProxy != "" {
-		proxyURL, parseErr := url.Parse(httpx.Options.HTTPProxy)
-		if parseErr != nil {
-			return nil, parseErr
-		}
-		transport.Proxy = http.ProxyURL(proxyURL)
+	httpx.proxies, err = newProxyPool(httpx.Options)
+	if err != nil {
+		return nil, err
+	}
+	if httpx.proxies != nil {
+		transport.Proxy = httpx.proxyForRequest
 	}
 
 	httpx.client = retryablehttp.NewWithHTTPClient(&http.Client{
@@ -126,14 +145,18 @@ func New(options *Options) (*HTTPX, error) {
 		CheckRedirect: redirectFunc,
 	}, retryablehttpOptions)
 
-	httpx.client2 = &http.Client{
-		Transport: &http2.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			AllowHTTP: true,
+	transport2 := &http2.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
 		},
-		Timeout: httpx.Options.Timeout,
+		AllowHTTP: true,
+	}
+	httpx.client2 = &http.Client{
+		Transport: transport2,
+		Timeout:   httpx.Options.Timeout,
+	}
+	if httpx.proxies != nil {
+		httpx.client2.Transport = &proxyHTTP2Transport{h: httpx, transport: transport2}
 	}
 
 	httpx.htmlPolicy = bluemonday.NewPolicy()
@@ -152,11 +175,22 @@ func New(options *Options) (*HTTPX, error) {
 func (h *HTTPX) Do(req *retryablehttp.Request, unsafeOptions UnsafeOptions) (*Response, error) {
 	timeStart := time.Now()
 
+	var trace *requestTrace
+	if h.Options.Trace && !h.Options.Unsafe {
+		trace = &requestTrace{}
+		req.Request = req.Request.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	}
+	var progress *requestProgress
+	if !h.Options.Unsafe {
+		progress = &requestProgress{}
+		req.Request = req.Request.WithContext(progress.withContext(req.Context()))
+	}
+
 	var gzipRetry bool
 get_response:
 	httpresp, err := h.getResponse(req, unsafeOptions)
 	if err != nil {
-		return nil, err
+		return nil, progress.wrap(err)
 	}
 
 	var shouldIgnoreErrors, shouldIgnoreBodyErrors bool
@@ -178,6 +212,9 @@ get_response:
 		if !gzipRetry && strings.Contains(err.Error(), "gzip: invalid header") {
 			gzipRetry = true
 			req.Header.Set("Accept-Encoding", "identity")
+			if trace != nil {
+				trace.reset()
+			}
 			goto get_response
 		}
 		if !shouldIgnoreErrors {
@@ -191,9 +228,14 @@ get_response:
 	// websockets don't have a readable body
 	if httpresp.StatusCode != http.StatusSwitchingProtocols {
 		var err error
-		respbody, err = ioutil.ReadAll(io.LimitReader(httpresp.Body, h.Options.MaxResponseBodySizeToRead))
+		// one more byte is read to know if the body is truncated
+		respbody, err = ioutil.ReadAll(io.LimitReader(httpresp.Body, h.Options.MaxResponseBodySizeToRead+1))
 		if err != nil && !shouldIgnoreBodyErrors {
-			return nil, err
+			return nil, progress.wrap(err)
+		}
+		if int64(len(respbody)) > h.Options.MaxResponseBodySizeToRead {
+			respbody = respbody[:h.Options.MaxResponseBodySizeToRead]
+			resp.BodyTruncated = true
 		}
 	}
 
@@ -201,6 +243,9 @@ get_response:
 	if closeErr != nil && !shouldIgnoreBodyErrors {
 		return nil, closeErr
 	}
+	if trace != nil {
+		resp.Timings = trace.done()
+	}
 
 	respbodystr := string(respbody)
 
@@ -237,6 +282,10 @@ get_response:
 		resp.TLSData = h.TLSGrab(httpresp)
 	}
 
+	if !h.Options.Unsafe && h.Options.CertValidate && httpresp.TLS != nil {
+		resp.CertValidation = h.ValidateCertificate(httpresp.TLS, httpresp.Request.URL.Hostname())
+	}
+
 	resp.CSPData = h.CSPGrab(&resp)
 
 	// build the redirect flow by reverse cycling the response<-request chain
@@ -260,6 +309,11 @@ type UnsafeOptions struct {
 
 // getResponse returns response from safe / unsafe request
 func (h *HTTPX) getResponse(req *retryablehttp.Request, unsafeOptions UnsafeOptions) (*http.Response, error) {
+	// bind the proxy to the request so that redirects go through the same one
+	if h.proxies != nil {
+		req.Request = req.Request.WithContext(h.WithProxy(req.Context()))
+	}
+
 	if h.Options.Unsafe {
 		return h.doUnsafeWithOptions(req, unsafeOptions)
 	}
@@ -275,6 +329,10 @@ func (h *HTTPX) doUnsafeWithOptions(req *retryablehttp.Request, unsafeOptions Un
 	body := req.Body
 	options := rawhttp.DefaultOptions
 	options.Timeout = h.Options.Timeout
+	// rawhttp dials directly, so proxied requests are sent on our own connections
+	if h.proxies != nil {
+		return h.doRawThroughProxy(req.Context(), method, targetURL, unsafeOptions.URIPath, headers, body, options)
+	}
 	return rawhttp.DoRawWithOptions(method, targetURL, unsafeOptions.URIPath, headers, body, options)
 }
 
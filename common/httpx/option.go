@@ -2,6 +2,7 @@ package httpx
 
 import (
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -39,7 +40,14 @@ type Options struct {
 	MaxResponseBodySizeToRead int64
 	UnsafeURI                 string
 	Resolvers                 []string
+	Proxies                   []string
+	ProxyRotation             string
+	CertValidate              bool
+	CABundle                  string
+	Trace                     bool
 	customCookies             []*http.Cookie
+	// RedirectFilter returns false for the redirect locations which must not be followed
+	RedirectFilter func(*url.URL) bool
 }
 
 // DefaultOptions contains the default options
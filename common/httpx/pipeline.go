@@ -1,6 +1,7 @@
 package httpx
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
@@ -10,7 +11,7 @@ import (
 
 // SupportPipeline checks if the target host supports HTTP1.1 pipelining by sending x probes
 // and reading back responses expecting at least 2 with HTTP/1.1 or HTTP/1.0
-func (h *HTTPX) SupportPipeline(protocol, method, host string, port int) bool {
+func (h *HTTPX) SupportPipeline(ctx context.Context, protocol, method, host string, port int) bool {
 	addr := host
 	if port == 0 {
 		port = 80
@@ -23,10 +24,21 @@ func (h *HTTPX) SupportPipeline(protocol, method, host string, port int) bool {
 	}
 	// dummy method while awaiting for full rawhttp implementation
 	dummyReq := fmt.Sprintf("%s / HTTP/1.1\nHost: %s\n\n", method, addr)
-	conn, err := pipelineDial(protocol, addr)
+	conn, err := h.pipelineDial(ctx, protocol, addr)
 	if err != nil {
 		return false
 	}
+	defer conn.Close()
+	// unblock pending reads and writes if the context is canceled
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
 	// send some probes
 	nprobes := 10
 	for i := 0; i < nprobes; i++ {
@@ -58,12 +70,12 @@ func (h *HTTPX) SupportPipeline(protocol, method, host string, port int) bool {
 	return gotReplies >= 2 //nolint
 }
 
-func pipelineDial(protocol, addr string) (net.Conn, error) {
+func (h *HTTPX) pipelineDial(ctx context.Context, protocol, addr string) (net.Conn, error) {
 	// http
 	if protocol == "http" {
-		return net.Dial("tcp", addr)
+		return h.DialContext(ctx, "tcp", addr)
 	}
 
 	// https
-	return tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	return h.dialTLS(ctx, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
 }
@@ -0,0 +1,351 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/projectdiscovery/fastdialer/fastdialer"
+	"github.com/projectdiscovery/iputil"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// ProxyRoundRobin rotates the proxies in order
+	ProxyRoundRobin = "round-robin"
+	// ProxyRandom picks a random proxy for each request
+	ProxyRandom = "random"
+)
+
+type proxyContextKey struct{}
+
+// proxyPool holds the proxies the requests are rotated through
+type proxyPool struct {
+	proxies []*url.URL
+	random  bool
+	next    uint32
+}
+
+// newProxyPool collects the http, socks and listed proxies, returning nil if none is set
+func newProxyPool(options *Options) (*proxyPool, error) {
+	pool := &proxyPool{random: options.ProxyRotation == ProxyRandom}
+	add := func(value, defaultScheme string) error {
+		value = strings.TrimSpace(value)
+		if value == "" || strings.HasPrefix(value, "#") {
+			return nil
+		}
+		proxyURL, err := ParseProxy(value, defaultScheme)
+		if err != nil {
+			return err
+		}
+		pool.proxies = append(pool.proxies, proxyURL)
+		return nil
+	}
+	if err := add(options.HTTPProxy, "http"); err != nil {
+		return nil, err
+	}
+	if err := add(options.SocksProxy, "socks5"); err != nil {
+		return nil, err
+	}
+	for _, value := range options.Proxies {
+		if err := add(value, "http"); err != nil {
+			return nil, err
+		}
+	}
+	if len(pool.proxies) == 0 {
+		return nil, nil
+	}
+	return pool, nil
+}
+
+// ParseProxy parses a proxy url, using defaultScheme when the scheme is missing.
+// The supported schemes are http, https, socks5 and socks5h
+func ParseProxy(value, defaultScheme string) (*url.URL, error) {
+	if !strings.Contains(value, "://") {
+		value = defaultScheme + "://" + value
+	}
+	proxyURL, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy '%s': %s", value, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%s'", proxyURL.Scheme)
+	}
+	if proxyURL.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy '%s': missing host", value)
+	}
+	return proxyURL, nil
+}
+
+func (p *proxyPool) pick() *url.URL {
+	if p == nil {
+		return nil
+	}
+	if p.random {
+		return p.proxies[rand.Intn(len(p.proxies))] //nolint
+	}
+	return p.proxies[int(atomic.AddUint32(&p.next, 1)-1)%len(p.proxies)]
+}
+
+// WithProxy binds the next proxy of the rotation to the context, so that all the
+// connections of a single request go through the same proxy
+func (h *HTTPX) WithProxy(ctx context.Context) context.Context {
+	if h.proxies == nil {
+		return ctx
+	}
+	if _, ok := ctx.Value(proxyContextKey{}).(*url.URL); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, proxyContextKey{}, h.proxies.pick())
+}
+
+// proxyFor returns the proxy bound to the context or the next one of the rotation
+func (h *HTTPX) proxyFor(ctx context.Context) *url.URL {
+	if proxyURL, ok := ctx.Value(proxyContextKey{}).(*url.URL); ok {
+		return proxyURL
+	}
+	return h.proxies.pick()
+}
+
+// proxyForRequest is used as proxy function by the http transport. The socks proxies are dialed
+// by dialContext instead, so that the names are resolved the same way for all the connections:
+// locally with socks5 and by the proxy with socks5h.
+func (h *HTTPX) proxyForRequest(req *http.Request) (*url.URL, error) {
+	proxyURL, ok := req.Context().Value(proxyContextKey{}).(*url.URL)
+	if !ok {
+		// dialContext couldn't tell which proxy was picked
+		return nil, errors.New("the request isn't bound to a proxy")
+	}
+	if isSocksProxy(proxyURL) {
+		return nil, nil
+	}
+	return proxyURL, nil
+}
+
+// boundSocksProxy returns the socks proxy bound to the context, if any
+func boundSocksProxy(ctx context.Context) *url.URL {
+	if proxyURL, ok := ctx.Value(proxyContextKey{}).(*url.URL); ok && isSocksProxy(proxyURL) {
+		return proxyURL
+	}
+	return nil
+}
+
+func isSocksProxy(proxyURL *url.URL) bool {
+	return proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h"
+}
+
+// Dial connects to the address through the proxies if any, satisfying proxy.Dialer
+func (h *HTTPX) Dial(network, addr string) (net.Conn, error) {
+	return h.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address through the proxy bound to the context or
+// the next one of the rotation, directly if no proxy is configured
+func (h *HTTPX) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyURL := h.proxyFor(ctx)
+	if proxyURL == nil {
+		return h.Dialer.Dial(ctx, network, addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		// socks5 resolves the names locally while socks5h lets the proxy resolve them
+		if proxyURL.Scheme == "socks5" {
+			var err error
+			if addr, err = h.resolveAddr(addr); err != nil {
+				return nil, err
+			}
+		}
+		socksURL := *proxyURL
+		socksURL.Scheme = "socks5"
+		dialer, err := proxy.FromURL(&socksURL, forwardDialer{h.Dialer})
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	default:
+		return h.dialConnect(ctx, proxyURL, addr)
+	}
+}
+
+// resolveAddr resolves the host of the address with the configured resolvers
+func (h *HTTPX) resolveAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || iputil.IsIP(host) {
+		return addr, err
+	}
+	dnsData, err := h.Dialer.GetDNSData(host)
+	if err != nil {
+		return "", dnsError(host, err)
+	}
+	switch {
+	case len(dnsData.A) > 0:
+		return net.JoinHostPort(dnsData.A[0], port), nil
+	case len(dnsData.AAAA) > 0:
+		return net.JoinHostPort(dnsData.AAAA[0], port), nil
+	}
+	return "", dnsError(host, nil)
+}
+
+// dialConnect opens a tunnel to the address with an http CONNECT request
+func (h *HTTPX) dialConnect(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := h.Dialer.Dial(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else if h.Options.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(h.Options.Timeout))
+	}
+	if proxyURL.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: proxyURL.Hostname()})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy '%s' refused the connection: %s", proxyURL.Host, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// dialTLS connects to the address through the proxies and performs the tls handshake
+func (h *HTTPX) dialTLS(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+	conn, err := h.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else if h.Options.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(h.Options.Timeout))
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// proxyHTTP2Transport sends each request on a new http2 connection dialed through the proxies.
+// The DialTLS hook of http2.Transport doesn't receive the request context, so the connection
+// is dialed here to bind it to the request deadline and cancellation.
+type proxyHTTP2Transport struct {
+	h         *HTTPX
+	transport *http2.Transport
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *proxyHTTP2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	port := req.URL.Port()
+	if port == "" {
+		port = "443"
+		if req.URL.Scheme == HTTP {
+			port = "80"
+		}
+	}
+	addr := net.JoinHostPort(req.URL.Hostname(), port)
+
+	var conn net.Conn
+	var err error
+	if req.URL.Scheme == HTTP {
+		conn, err = t.h.DialContext(ctx, "tcp", addr)
+	} else {
+		config := t.transport.TLSClientConfig.Clone()
+		config.NextProtos = []string{http2.NextProtoTLS}
+		conn, err = t.h.dialTLS(ctx, "tcp", addr, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cc, err := t.transport.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
+	resp.Body = &clientConnBody{ReadCloser: resp.Body, cc: cc}
+	return resp, nil
+}
+
+// clientConnBody closes the connection of the response along with its body
+type clientConnBody struct {
+	io.ReadCloser
+	cc *http2.ClientConn
+}
+
+func (b *clientConnBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cc.Close()
+	return err
+}
+
+// forwardDialer lets the socks dialer reach the proxy with fastdialer
+type forwardDialer struct {
+	dialer *fastdialer.Dialer
+}
+
+func (f forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return f.dialer.Dial(context.Background(), network, addr)
+}
+
+func (f forwardDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f.dialer.Dial(ctx, network, addr)
+}
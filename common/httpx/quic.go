@@ -0,0 +1,652 @@
+//go:build go1.21
+// +build go1.21
+
+package httpx
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// The probe implements the client side of the QUIC v1 handshake (RFC 9000 and 9001)
+// on top of the tls QUIC api, just enough to learn the negotiated application protocol.
+const (
+	quicVersion1        = 0x00000001
+	quicMinDatagramSize = 1200
+	quicMaxCryptoFrame  = 1000
+	quicRetransmission  = time.Second
+
+	quicPacketInitial   = 0x0
+	quicPacketHandshake = 0x2
+	quicPacketRetry     = 0x3
+
+	quicFramePadding         = 0x00
+	quicFramePing            = 0x01
+	quicFrameAck             = 0x02
+	quicFrameAckECN          = 0x03
+	quicFrameCrypto          = 0x06
+	quicFrameConnectionClose = 0x1c
+	quicFrameAppClose        = 0x1d
+
+	quicTransportParamInitialSCID = 0x0f
+)
+
+var quicV1InitialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+// quicHandshake performs a QUIC handshake over conn offering the alpn protocols
+// and returns the one negotiated by the server
+func quicHandshake(ctx context.Context, conn net.Conn, serverName string, alpn []string) (string, error) {
+	p, err := newQUICProbe(conn, serverName, alpn)
+	if err != nil {
+		return "", err
+	}
+	defer p.tls.Close()
+	return p.run(ctx)
+}
+
+// quicKeys protects the packets of an encryption level in one direction
+type quicKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   func(sample []byte) []byte
+}
+
+// quicSpace holds the state of a packet number space
+type quicSpace struct {
+	level      tls.QUICEncryptionLevel
+	read       *quicKeys
+	write      *quicKeys
+	nextPN     uint64
+	largestPN  int64
+	received   bool
+	cryptoIn   map[uint64][]byte
+	cryptoRead uint64
+	cryptoOut  []byte
+}
+
+type quicProbe struct {
+	conn     net.Conn
+	tls      *tls.QUICConn
+	dcid     []byte
+	scid     []byte
+	token    []byte
+	retried  bool
+	initial  *quicSpace
+	hs       *quicSpace
+	finished bool
+}
+
+func newQUICProbe(conn net.Conn, serverName string, alpn []string) (*quicProbe, error) {
+	p := &quicProbe{
+		conn:    conn,
+		dcid:    make([]byte, 8),
+		scid:    make([]byte, 8),
+		initial: &quicSpace{level: tls.QUICEncryptionLevelInitial, largestPN: -1, cryptoIn: map[uint64][]byte{}},
+		hs:      &quicSpace{level: tls.QUICEncryptionLevelHandshake, largestPN: -1, cryptoIn: map[uint64][]byte{}},
+	}
+	if _, err := rand.Read(p.dcid); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(p.scid); err != nil {
+		return nil, err
+	}
+	if err := p.setInitialKeys(); err != nil {
+		return nil, err
+	}
+	p.tls = tls.QUICClient(&tls.QUICConfig{TLSConfig: &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         alpn,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+		// a single classic key share keeps the client hello small
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}})
+	var params []byte
+	params = quicAppendVarint(params, quicTransportParamInitialSCID)
+	params = quicAppendVarint(params, uint64(len(p.scid)))
+	params = append(params, p.scid...)
+	p.tls.SetTransportParameters(params)
+	return p, nil
+}
+
+// setInitialKeys derives the initial keys from the destination connection id
+func (p *quicProbe) setInitialKeys() error {
+	initialSecret := hkdf.Extract(sha256.New, p.dcid, quicV1InitialSalt)
+	clientSecret := quicExpandLabel(sha256.New, initialSecret, "client in", 32)
+	serverSecret := quicExpandLabel(sha256.New, initialSecret, "server in", 32)
+	var err error
+	if p.initial.write, err = newQUICKeys(tls.TLS_AES_128_GCM_SHA256, clientSecret); err != nil {
+		return err
+	}
+	p.initial.read, err = newQUICKeys(tls.TLS_AES_128_GCM_SHA256, serverSecret)
+	return err
+}
+
+func (p *quicProbe) run(ctx context.Context) (string, error) {
+	if err := p.tls.Start(ctx); err != nil {
+		return "", err
+	}
+	if err := p.handleEvents(); err != nil {
+		return "", err
+	}
+	if err := p.sendInitial(); err != nil {
+		return "", err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	buf := make([]byte, 65535)
+	for !p.finished {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if time.Now().After(deadline) {
+			return "", errors.New("quic handshake timed out")
+		}
+		readDeadline := time.Now().Add(quicRetransmission)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
+		}
+		_ = p.conn.SetReadDeadline(readDeadline)
+		n, err := p.conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// nothing came back, the initial flight may have been lost
+				if !p.initial.received {
+					if err := p.sendInitial(); err != nil {
+						return "", err
+					}
+				}
+				continue
+			}
+			return "", err
+		}
+		if err := p.handleDatagram(buf[:n]); err != nil {
+			return "", err
+		}
+	}
+	return p.tls.ConnectionState().NegotiatedProtocol, nil
+}
+
+// handleEvents consumes the tls events, installing the keys and collecting the data to send
+func (p *quicProbe) handleEvents() error {
+	for {
+		event := p.tls.NextEvent()
+		switch event.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+			space := p.space(event.Level)
+			if space == nil {
+				// application keys aren't needed to learn the alpn
+				continue
+			}
+			keys, err := newQUICKeys(event.Suite, event.Data)
+			if err != nil {
+				return err
+			}
+			if event.Kind == tls.QUICSetReadSecret {
+				space.read = keys
+			} else {
+				space.write = keys
+			}
+		case tls.QUICWriteData:
+			if space := p.space(event.Level); space != nil {
+				space.cryptoOut = append(space.cryptoOut, event.Data...)
+			}
+		case tls.QUICHandshakeDone:
+			p.finished = true
+		}
+	}
+}
+
+func (p *quicProbe) space(level tls.QUICEncryptionLevel) *quicSpace {
+	switch level {
+	case tls.QUICEncryptionLevelInitial:
+		return p.initial
+	case tls.QUICEncryptionLevelHandshake:
+		return p.hs
+	}
+	return nil
+}
+
+// sendInitial sends the client hello, split in padded initial packets
+func (p *quicProbe) sendInitial() error {
+	data := p.initial.cryptoOut
+	for offset := 0; offset < len(data); offset += quicMaxCryptoFrame {
+		end := offset + quicMaxCryptoFrame
+		if end > len(data) {
+			end = len(data)
+		}
+		payload := quicAppendCrypto(nil, uint64(offset), data[offset:end])
+		packet := p.sealLong(quicPacketInitial, p.initial, payload, quicMinDatagramSize)
+		if _, err := p.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendHandshake acknowledges the server handshake packets, which also validates the client
+// address lifting the server amplification limit, and sends the client handshake data if any
+func (p *quicProbe) sendHandshake() error {
+	if p.hs.write == nil || !p.hs.received {
+		return nil
+	}
+	var payload []byte
+	payload = quicAppendVarint(payload, quicFrameAck)
+	payload = quicAppendVarint(payload, uint64(p.hs.largestPN))
+	payload = quicAppendVarint(payload, 0)
+	payload = quicAppendVarint(payload, 0)
+	payload = quicAppendVarint(payload, uint64(p.hs.largestPN))
+	if len(p.hs.cryptoOut) > 0 {
+		payload = quicAppendCrypto(payload, 0, p.hs.cryptoOut)
+		p.hs.cryptoOut = nil
+	}
+	if p.finished {
+		// the probe is over, let the server release the connection
+		payload = quicAppendVarint(payload, quicFrameConnectionClose)
+		payload = quicAppendVarint(payload, 0)
+		payload = quicAppendVarint(payload, 0)
+		payload = quicAppendVarint(payload, 0)
+	}
+	_, err := p.conn.Write(p.sealLong(quicPacketHandshake, p.hs, payload, 0))
+	return err
+}
+
+// sealLong builds a protected long header packet, padding the datagram to size
+func (p *quicProbe) sealLong(packetType byte, space *quicSpace, payload []byte, size int) []byte {
+	const pnLen = 4
+	header := []byte{0xc0 | packetType<<4 | (pnLen - 1)}
+	header = binary.BigEndian.AppendUint32(header, quicVersion1)
+	header = append(header, byte(len(p.dcid)))
+	header = append(header, p.dcid...)
+	header = append(header, byte(len(p.scid)))
+	header = append(header, p.scid...)
+	if packetType == quicPacketInitial {
+		header = quicAppendVarint(header, uint64(len(p.token)))
+		header = append(header, p.token...)
+	}
+	overhead := space.write.aead.Overhead()
+	if padding := size - (len(header) + 2 + pnLen + len(payload) + overhead); padding > 0 {
+		payload = append(payload, make([]byte, padding)...)
+	}
+	// the length is always encoded on two bytes to know the padding in advance
+	length := uint64(pnLen + len(payload) + overhead)
+	header = append(header, byte(0x40|length>>8), byte(length))
+	pnOffset := len(header)
+	pn := space.nextPN
+	space.nextPN++
+	header = binary.BigEndian.AppendUint32(header, uint32(pn))
+
+	packet := space.write.aead.Seal(header, space.write.nonce(pn), payload, header)
+	mask := space.write.hp(packet[pnOffset+4 : pnOffset+4+16])
+	packet[0] ^= mask[0] & 0x0f
+	for i := 0; i < pnLen; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+// handleDatagram processes the coalesced packets of a datagram
+func (p *quicProbe) handleDatagram(datagram []byte) error {
+	receivedHandshake := false
+	for len(datagram) > 0 {
+		if datagram[0]&0x80 == 0 {
+			// short header packets carry application data, which isn't needed
+			break
+		}
+		if len(datagram) < 7 {
+			return errors.New("quic packet too short")
+		}
+		version := binary.BigEndian.Uint32(datagram[1:5])
+		if version == 0 {
+			return errors.New("quic version 1 not supported by the server")
+		}
+		if version != quicVersion1 {
+			return fmt.Errorf("unexpected quic version 0x%x", version)
+		}
+		packetType := (datagram[0] >> 4) & 0x3
+		offset := 5
+		dcidLen := int(datagram[offset])
+		offset += 1 + dcidLen
+		if offset >= len(datagram) {
+			return errors.New("malformed quic packet")
+		}
+		scidLen := int(datagram[offset])
+		if offset+1+scidLen > len(datagram) {
+			return errors.New("malformed quic packet")
+		}
+		scid := datagram[offset+1 : offset+1+scidLen]
+		offset += 1 + scidLen
+
+		if packetType == quicPacketRetry {
+			if len(datagram) < offset+16 {
+				return errors.New("malformed quic packet")
+			}
+			// the retry token runs up to the integrity tag
+			return p.handleRetry(datagram[offset:len(datagram)-16], scid)
+		}
+
+		var space *quicSpace
+		switch packetType {
+		case quicPacketInitial:
+			space = p.initial
+			tokenLen, n := quicReadVarint(datagram[offset:])
+			if n == 0 {
+				return errors.New("malformed quic packet")
+			}
+			offset += n + int(tokenLen)
+		case quicPacketHandshake:
+			space = p.hs
+		}
+		if offset > len(datagram) {
+			return errors.New("malformed quic packet")
+		}
+		length, n := quicReadVarint(datagram[offset:])
+		if n == 0 || offset+n+int(length) > len(datagram) {
+			return errors.New("malformed quic packet")
+		}
+		pnOffset := offset + n
+		packet := datagram[:pnOffset+int(length)]
+		datagram = datagram[len(packet):]
+		if space == nil || space.read == nil {
+			// 0-rtt or packets we can't decrypt yet
+			continue
+		}
+		// the server uses our source connection id as its destination from now on
+		p.dcid = append([]byte(nil), scid...)
+
+		payload, pn, err := space.open(packet, pnOffset)
+		if err != nil {
+			// undecryptable packets are dropped
+			continue
+		}
+		space.received = true
+		if int64(pn) > space.largestPN {
+			space.largestPN = int64(pn)
+		}
+		if space == p.hs {
+			receivedHandshake = true
+		}
+		if err := p.handleFrames(space, payload); err != nil {
+			return err
+		}
+		if err := p.handleEvents(); err != nil {
+			return err
+		}
+	}
+	if receivedHandshake {
+		return p.sendHandshake()
+	}
+	return nil
+}
+
+// handleRetry restarts the handshake with the token and connection id chosen by the server
+func (p *quicProbe) handleRetry(token, scid []byte) error {
+	if p.retried || p.initial.received {
+		return nil
+	}
+	p.retried = true
+	p.token = append([]byte(nil), token...)
+	p.dcid = append([]byte(nil), scid...)
+	if err := p.setInitialKeys(); err != nil {
+		return err
+	}
+	return p.sendInitial()
+}
+
+// handleFrames passes the crypto data to tls and fails on connection close
+func (p *quicProbe) handleFrames(space *quicSpace, payload []byte) error {
+	for len(payload) > 0 {
+		frameType, n := quicReadVarint(payload)
+		if n == 0 {
+			return nil
+		}
+		payload = payload[n:]
+		switch frameType {
+		case quicFramePadding, quicFramePing:
+		case quicFrameAck, quicFrameAckECN:
+			fields := 4
+			values, ok := quicReadVarints(payload, fields)
+			if !ok {
+				return nil
+			}
+			rangeCount := values[2]
+			fields += int(rangeCount) * 2
+			if frameType == quicFrameAckECN {
+				fields += 3
+			}
+			if _, ok = quicReadVarints(payload, fields); !ok {
+				return nil
+			}
+			payload = payload[quicVarintsLen(payload, fields):]
+		case quicFrameCrypto:
+			values, ok := quicReadVarints(payload, 2)
+			if !ok {
+				return nil
+			}
+			payload = payload[quicVarintsLen(payload, 2):]
+			offset, length := values[0], values[1]
+			if uint64(len(payload)) < length {
+				return nil
+			}
+			space.cryptoIn[offset] = append([]byte(nil), payload[:length]...)
+			payload = payload[length:]
+			if err := p.deliverCrypto(space); err != nil {
+				return err
+			}
+		case quicFrameConnectionClose, quicFrameAppClose:
+			code, _ := quicReadVarint(payload)
+			// crypto errors carry the tls alert, e.g. 0x178 is no_application_protocol
+			if code >= 0x100 && code <= 0x1ff {
+				return fmt.Errorf("quic connection closed by the server: tls alert %d", code-0x100)
+			}
+			return fmt.Errorf("quic connection closed by the server: error 0x%x", code)
+		default:
+			// other frames aren't allowed before the handshake completes
+			return nil
+		}
+	}
+	return nil
+}
+
+// deliverCrypto passes the contiguous crypto data received so far to tls
+func (p *quicProbe) deliverCrypto(space *quicSpace) error {
+	for {
+		data, ok := space.cryptoIn[space.cryptoRead]
+		if !ok {
+			return nil
+		}
+		delete(space.cryptoIn, space.cryptoRead)
+		space.cryptoRead += uint64(len(data))
+		if err := p.tls.HandleData(space.level, data); err != nil {
+			return err
+		}
+	}
+}
+
+// open removes the header protection and decrypts the packet
+func (space *quicSpace) open(packet []byte, pnOffset int) ([]byte, uint64, error) {
+	if len(packet) < pnOffset+4+16 {
+		return nil, 0, errors.New("quic packet too short")
+	}
+	header := append([]byte(nil), packet[:pnOffset+4]...)
+	mask := space.read.hp(packet[pnOffset+4 : pnOffset+4+16])
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x3) + 1
+	var truncated uint64
+	for i := 0; i < pnLen; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | uint64(header[pnOffset+i])
+	}
+	header = header[:pnOffset+pnLen]
+	pn := quicDecodePacketNumber(space.largestPN, truncated, pnLen*8)
+	payload, err := space.read.aead.Open(nil, space.read.nonce(pn), packet[pnOffset+pnLen:], header)
+	return payload, pn, err
+}
+
+// quicDecodePacketNumber reconstructs the full packet number (RFC 9000 appendix A.3)
+func quicDecodePacketNumber(largest int64, truncated uint64, bits int) uint64 {
+	expected := uint64(largest + 1)
+	window := uint64(1) << bits
+	half := window / 2
+	candidate := (expected &^ (window - 1)) | truncated
+	switch {
+	case candidate+half <= expected && candidate < (1<<62)-window:
+		return candidate + window
+	case candidate > expected+half && candidate >= window:
+		return candidate - window
+	}
+	return candidate
+}
+
+func (k *quicKeys) nonce(pn uint64) []byte {
+	nonce := append([]byte(nil), k.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return nonce
+}
+
+// newQUICKeys derives the packet protection keys from a tls traffic secret
+func newQUICKeys(suite uint16, secret []byte) (*quicKeys, error) {
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384:
+		h, keyLen := sha256.New, 16
+		if suite == tls.TLS_AES_256_GCM_SHA384 {
+			h, keyLen = sha512.New384, 32
+		}
+		block, err := aes.NewCipher(quicExpandLabel(h, secret, "quic key", keyLen))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		hpBlock, err := aes.NewCipher(quicExpandLabel(h, secret, "quic hp", keyLen))
+		if err != nil {
+			return nil, err
+		}
+		return &quicKeys{
+			aead: aead,
+			iv:   quicExpandLabel(h, secret, "quic iv", 12),
+			hp: func(sample []byte) []byte {
+				mask := make([]byte, aes.BlockSize)
+				hpBlock.Encrypt(mask, sample)
+				return mask
+			},
+		}, nil
+	case tls.TLS_CHACHA20_POLY1305_SHA256:
+		aead, err := chacha20poly1305.New(quicExpandLabel(sha256.New, secret, "quic key", chacha20poly1305.KeySize))
+		if err != nil {
+			return nil, err
+		}
+		hpKey := quicExpandLabel(sha256.New, secret, "quic hp", chacha20.KeySize)
+		return &quicKeys{
+			aead: aead,
+			iv:   quicExpandLabel(sha256.New, secret, "quic iv", 12),
+			hp: func(sample []byte) []byte {
+				mask := make([]byte, 5)
+				c, err := chacha20.NewUnauthenticatedCipher(hpKey, sample[4:16])
+				if err != nil {
+					return mask
+				}
+				c.SetCounter(binary.LittleEndian.Uint32(sample[:4]))
+				c.XORKeyStream(mask, mask)
+				return mask
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported cipher suite 0x%x", suite)
+}
+
+// quicExpandLabel is the tls 1.3 HKDF-Expand-Label
+func quicExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(label))}
+	info = append(info, label...)
+	info = append(info, 0)
+	out := make([]byte, length)
+	_, _ = hkdf.Expand(h, secret, info).Read(out)
+	return out
+}
+
+func quicAppendCrypto(b []byte, offset uint64, data []byte) []byte {
+	b = quicAppendVarint(b, quicFrameCrypto)
+	b = quicAppendVarint(b, offset)
+	b = quicAppendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func quicAppendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, byte(0x40|v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, byte(0x80|v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, byte(0xc0|v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// quicReadVarint returns the value and the number of bytes read, zero if b is too short
+func quicReadVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+func quicReadVarints(b []byte, count int) ([]uint64, bool) {
+	values := make([]uint64, 0, count)
+	for i := 0; i < count; i++ {
+		v, n := quicReadVarint(b)
+		if n == 0 {
+			return nil, false
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values, true
+}
+
+func quicVarintsLen(b []byte, count int) int {
+	total := 0
+	for i := 0; i < count; i++ {
+		_, n := quicReadVarint(b[total:])
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,316 @@
+//go:build go1.21
+// +build go1.21
+
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %s", s, err)
+	}
+	return b
+}
+
+// RFC 9001 appendix A.1
+func TestQUICInitialKeys(t *testing.T) {
+	dcid := unhex(t, "8394c8f03e515708")
+
+	initialSecret := hkdf.Extract(sha256.New, dcid, quicV1InitialSalt)
+	if want := unhex(t, "7db5df06e7a69e432496adedb00851923595221596ae2ae9fb8115c1e9ed0a44"); !bytes.Equal(initialSecret, want) {
+		t.Fatalf("initial secret = %x, want %x", initialSecret, want)
+	}
+
+	tests := []struct {
+		label               string
+		secret, key, iv, hp string
+	}{
+		{
+			label:  "client in",
+			secret: "c00cf151ca5be075ed0ebfb5c80323c42d6b7db67881289af4008f1f6c357aea",
+			key:    "1f369613dd76d5467730efcbe3b1a22d",
+			iv:     "fa044b2f42a3fd3b46fb255c",
+			hp:     "9f50449e04a0e810283a1e9933adedd2",
+		},
+		{
+			label:  "server in",
+			secret: "3c199828fd139efd216c155ad844cc81fb82fa8d7446fa7d78be803acdda951b",
+			key:    "cf3a5331653c364c88f0f379b6067e37",
+			iv:     "0ac1493ca1905853b0bba03e",
+			hp:     "c206b8d9b9f0f37644430b490eeaa314",
+		},
+	}
+	for _, test := range tests {
+		secret := quicExpandLabel(sha256.New, initialSecret, test.label, 32)
+		if want := unhex(t, test.secret); !bytes.Equal(secret, want) {
+			t.Errorf("%s secret = %x, want %x", test.label, secret, want)
+		}
+		if key := quicExpandLabel(sha256.New, secret, "quic key", 16); !bytes.Equal(key, unhex(t, test.key)) {
+			t.Errorf("%s key = %x, want %s", test.label, key, test.key)
+		}
+		if iv := quicExpandLabel(sha256.New, secret, "quic iv", 12); !bytes.Equal(iv, unhex(t, test.iv)) {
+			t.Errorf("%s iv = %x, want %s", test.label, iv, test.iv)
+		}
+		if hp := quicExpandLabel(sha256.New, secret, "quic hp", 16); !bytes.Equal(hp, unhex(t, test.hp)) {
+			t.Errorf("%s hp = %x, want %s", test.label, hp, test.hp)
+		}
+	}
+
+	// the probe derives the same keys from the destination connection id
+	p := &quicProbe{dcid: dcid, initial: &quicSpace{}}
+	if err := p.setInitialKeys(); err != nil {
+		t.Fatalf("setInitialKeys returned error: %s", err)
+	}
+	if want := unhex(t, "fa044b2f42a3fd3b46fb255c"); !bytes.Equal(p.initial.write.iv, want) {
+		t.Errorf("client iv = %x, want %x", p.initial.write.iv, want)
+	}
+	if want := unhex(t, "0ac1493ca1905853b0bba03e"); !bytes.Equal(p.initial.read.iv, want) {
+		t.Errorf("server iv = %x, want %x", p.initial.read.iv, want)
+	}
+}
+
+// RFC 9001 appendix A.2, A.3 and A.5
+func TestQUICHeaderProtection(t *testing.T) {
+	p := &quicProbe{dcid: unhex(t, "8394c8f03e515708"), initial: &quicSpace{}}
+	if err := p.setInitialKeys(); err != nil {
+		t.Fatalf("setInitialKeys returned error: %s", err)
+	}
+	chachaKeys, err := newQUICKeys(tls.TLS_CHACHA20_POLY1305_SHA256, unhex(t, "9ac312a7f877468ebe69422748ad00a15443f18203a07d6060f688f30f21632b"))
+	if err != nil {
+		t.Fatalf("newQUICKeys returned error: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		keys   *quicKeys
+		sample string
+		mask   string
+	}{
+		{"client initial", p.initial.write, "d1b1c98dd7689fb8ec11d242b123dc9b", "437b9aec36"},
+		{"server initial", p.initial.read, "2cd0991cd25b0aac406a5816b6394100", "2ec0d8356a"},
+		{"chacha20", chachaKeys, "5e5cd55c41f69080575d7999c25a5bfb", "aefefe7d03"},
+	}
+	for _, test := range tests {
+		mask := test.keys.hp(unhex(t, test.sample))
+		if got := hex.EncodeToString(mask[:5]); got != test.mask {
+			t.Errorf("%s mask = %s, want %s", test.name, got, test.mask)
+		}
+	}
+}
+
+// RFC 9001 appendix A.5: a short header packet protected with ChaCha20-Poly1305
+func TestQUICChaCha20Packet(t *testing.T) {
+	keys, err := newQUICKeys(tls.TLS_CHACHA20_POLY1305_SHA256, unhex(t, "9ac312a7f877468ebe69422748ad00a15443f18203a07d6060f688f30f21632b"))
+	if err != nil {
+		t.Fatalf("newQUICKeys returned error: %s", err)
+	}
+	const pn = 654360564
+	if nonce := keys.nonce(pn); !bytes.Equal(nonce, unhex(t, "e0459b3474bdd0e46d417eb0")) {
+		t.Errorf("nonce = %x, want e0459b3474bdd0e46d417eb0", nonce)
+	}
+
+	header := unhex(t, "4200bff4")
+	packet := keys.aead.Seal(append([]byte(nil), header...), keys.nonce(pn), []byte{0x01}, header)
+	mask := keys.hp(packet[5:21])
+	packet[0] ^= mask[0] & 0x1f
+	for i := 0; i < 3; i++ {
+		packet[1+i] ^= mask[1+i]
+	}
+	if want := unhex(t, "4cfe4189655e5cd55c41f69080575d7999c25a5bfb"); !bytes.Equal(packet, want) {
+		t.Fatalf("protected packet = %x, want %x", packet, want)
+	}
+}
+
+// RFC 9000 appendix A.1 and A.3
+func TestQUICVarintsAndPacketNumbers(t *testing.T) {
+	varints := []struct {
+		encoded string
+		value   uint64
+	}{
+		{"c2197c5eff14e88c", 151288809941952652},
+		{"9d7f3e7d", 494878333},
+		{"7bbd", 15293},
+		{"25", 37},
+	}
+	for _, test := range varints {
+		value, n := quicReadVarint(unhex(t, test.encoded))
+		if value != test.value || n != len(test.encoded)/2 {
+			t.Errorf("quicReadVarint(%s) = %d, %d, want %d, %d", test.encoded, value, n, test.value, len(test.encoded)/2)
+		}
+		if encoded := hex.EncodeToString(quicAppendVarint(nil, test.value)); encoded != test.encoded {
+			t.Errorf("quicAppendVarint(%d) = %s, want %s", test.value, encoded, test.encoded)
+		}
+	}
+	if value, n := quicReadVarint(unhex(t, "4025")); value != 37 || n != 2 {
+		t.Errorf("quicReadVarint(4025) = %d, %d, want 37, 2", value, n)
+	}
+	if _, n := quicReadVarint(unhex(t, "9d7f")); n != 0 {
+		t.Errorf("quicReadVarint of a truncated varint read %d bytes", n)
+	}
+
+	if pn := quicDecodePacketNumber(0xa82f30ea, 0x9b32, 16); pn != 0xa82f9b32 {
+		t.Errorf("quicDecodePacketNumber = %x, want a82f9b32", pn)
+	}
+	if pn := quicDecodePacketNumber(-1, 0, 32); pn != 0 {
+		t.Errorf("quicDecodePacketNumber of the first packet = %d, want 0", pn)
+	}
+}
+
+func TestQUICHandshake(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverALPN []string
+		clientALPN []string
+		want       string
+		err        string
+	}{
+		{"negotiated", []string{"h3"}, []string{"h3-29", "h3"}, "h3", ""},
+		{"no common protocol", []string{"h3"}, []string{"h3-29"}, "", "tls alert 120"},
+	}
+	for _, test := range tests {
+		addr := startQUICTestServer(t, test.serverALPN)
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			t.Fatalf("could not dial the test server: %s", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		got, err := quicHandshake(ctx, conn, "localhost", test.clientALPN)
+		cancel()
+		conn.Close()
+		switch {
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: quicHandshake error = %v, want error containing %q", test.name, err, test.err)
+		case test.err == "" && err != nil:
+			t.Errorf("%s: quicHandshake returned error: %s", test.name, err)
+		case got != test.want:
+			t.Errorf("%s: quicHandshake = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// quicTestPeer lets the server side of the probe answer a single client from a listening socket
+type quicTestPeer struct {
+	*net.UDPConn
+	addr *net.UDPAddr
+}
+
+func (c *quicTestPeer) Write(b []byte) (int, error) {
+	return c.WriteToUDP(b, c.addr)
+}
+
+// startQUICTestServer serves a single QUIC handshake. The server reuses the packet
+// handling of the probe, with the roles of the initial keys swapped.
+func startQUICTestServer(t *testing.T, alpn []string) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	certificate := testCertificate(t)
+
+	go func() {
+		buf := make([]byte, 65535)
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil || n < 6 {
+			return
+		}
+		odcid := append([]byte(nil), buf[6:6+int(buf[5])]...)
+		p := &quicProbe{
+			conn:    &quicTestPeer{UDPConn: conn, addr: addr},
+			scid:    []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			initial: &quicSpace{level: tls.QUICEncryptionLevelInitial, largestPN: -1, cryptoIn: map[uint64][]byte{}},
+			hs:      &quicSpace{level: tls.QUICEncryptionLevelHandshake, largestPN: -1, cryptoIn: map[uint64][]byte{}},
+		}
+		initialSecret := hkdf.Extract(sha256.New, odcid, quicV1InitialSalt)
+		p.initial.read, _ = newQUICKeys(tls.TLS_AES_128_GCM_SHA256, quicExpandLabel(sha256.New, initialSecret, "client in", 32))
+		p.initial.write, _ = newQUICKeys(tls.TLS_AES_128_GCM_SHA256, quicExpandLabel(sha256.New, initialSecret, "server in", 32))
+		p.tls = tls.QUICServer(&tls.QUICConfig{TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			NextProtos:   alpn,
+			MinVersion:   tls.VersionTLS13,
+		}})
+		defer p.tls.Close()
+		p.tls.SetTransportParameters([]byte{})
+		if err := p.tls.Start(context.Background()); err != nil {
+			return
+		}
+
+		if err := p.handleDatagram(buf[:n]); err != nil {
+			code := uint64(0x1)
+			var alert tls.AlertError
+			if errors.As(err, &alert) {
+				code = 0x100 + uint64(alert)
+			}
+			var payload []byte
+			payload = quicAppendVarint(payload, quicFrameConnectionClose)
+			payload = quicAppendVarint(payload, code)
+			payload = quicAppendVarint(payload, 0)
+			payload = quicAppendVarint(payload, 0)
+			_, _ = p.conn.Write(p.sealLong(quicPacketInitial, p.initial, payload, 0))
+			return
+		}
+
+		// the whole server flight is coalesced in a single datagram
+		datagram := p.sealLong(quicPacketInitial, p.initial, quicAppendCrypto(nil, 0, p.initial.cryptoOut), 0)
+		for offset := 0; offset < len(p.hs.cryptoOut); offset += quicMaxCryptoFrame {
+			end := offset + quicMaxCryptoFrame
+			if end > len(p.hs.cryptoOut) {
+				end = len(p.hs.cryptoOut)
+			}
+			datagram = append(datagram, p.sealLong(quicPacketHandshake, p.hs, quicAppendCrypto(nil, uint64(offset), p.hs.cryptoOut[offset:end]), 0)...)
+		}
+		_, _ = p.conn.Write(datagram)
+
+		// wait for the client finished, the client closes the connection right after
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		for !p.finished {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil || p.handleDatagram(buf[:n]) != nil {
+				return
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,15 @@
+//go:build !go1.21
+// +build !go1.21
+
+package httpx
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// quicHandshake requires the tls QUIC api available from go 1.21
+func quicHandshake(ctx context.Context, conn net.Conn, serverName string, alpn []string) (string, error) {
+	return "", errors.New("quic is not supported by this go version")
+}
@@ -0,0 +1,150 @@
+package httpx
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/projectdiscovery/rawhttp"
+	"github.com/projectdiscovery/rawhttp/client"
+)
+
+// doRawThroughProxy sends a raw request like rawhttp.DoRawWithOptions but on a
+// connection opened through the proxies
+func (h *HTTPX) doRawThroughProxy(ctx context.Context, method, targetURL, uripath string, headers map[string][]string, body io.Reader, options rawhttp.Options) (*http.Response, error) {
+	for redirects := 0; ; redirects++ {
+		resp, err := h.doRawRequestThroughProxy(ctx, method, targetURL, uripath, headers, body, options)
+		if err != nil {
+			return nil, err
+		}
+		location := resp.Header.Get("Location")
+		isRedirect := resp.StatusCode >= 300 && resp.StatusCode < 400 && location != ""
+		if !isRedirect || !options.FollowRedirects || redirects >= options.MaxRedirects {
+			return resp, nil
+		}
+		// consume the response body before following the redirect
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		base, err := url.Parse(targetURL)
+		if err != nil {
+			return nil, err
+		}
+		next, err := base.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		targetURL, uripath = next.String(), ""
+	}
+}
+
+func (h *HTTPX) doRawRequestThroughProxy(ctx context.Context, method, targetURL, uripath string, headers map[string][]string, body io.Reader, options rawhttp.Options) (*http.Response, error) {
+	u, err := url.ParseRequestURI(targetURL)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == HTTPS {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+	var conn net.Conn
+	if u.Scheme == HTTPS {
+		conn, err = h.dialTLS(ctx, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	} else {
+		conn, err = h.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if options.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(options.Timeout))
+	}
+
+	reqHeaders := make(map[string][]string, len(headers)+1)
+	for key, values := range headers {
+		reqHeaders[key] = values
+	}
+	if options.AutomaticHostHeader {
+		// rawhttp sends the header value as is, hence the leading space
+		reqHeaders["Host"] = []string{" " + u.Host}
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if uripath != "" {
+		path = uripath
+	}
+
+	req := &client.Request{
+		Method:                 method,
+		Path:                   path,
+		Version:                client.HTTP_1_1,
+		Body:                   body,
+		AutomaticContentLength: options.AutomaticContentLength,
+		AutomaticHost:          options.AutomaticHostHeader,
+	}
+	for key, values := range reqHeaders {
+		for _, value := range values {
+			req.Headers = append(req.Headers, client.Header{Key: key, Value: value})
+		}
+	}
+
+	rawClient := client.NewClient(conn)
+	if err := rawClient.WriteRequest(req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	rawResp, err := rawClient.ReadResponse()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	respHeaders := make(http.Header)
+	for _, header := range rawResp.Headers {
+		respHeaders[header.Key] = append(respHeaders[header.Key], header.Value)
+	}
+	var respBody io.Reader = rawResp.Body
+	if strings.Join(respHeaders["Content-Encoding"], " ") == "gzip" {
+		if respBody, err = gzip.NewReader(respBody); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &http.Response{
+		ProtoMajor:    rawResp.Version.Major,
+		ProtoMinor:    rawResp.Version.Minor,
+		Status:        rawResp.Status.String(),
+		StatusCode:    rawResp.Status.Code,
+		Header:        respHeaders,
+		ContentLength: rawResp.ContentLength(),
+		Body:          readCloser{respBody, conn},
+	}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
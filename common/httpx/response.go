@@ -1,6 +1,8 @@
 package httpx
 
 import (
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +26,13 @@ type Response struct {
 	Pipeline      bool
 	Duration      time.Duration
 	Chain         []httputil.ChainItem
+
+	// CertValidation is set when the certificate validation is enabled
+	CertValidation *CertValidation
+	// Timings of each request of the chain, set when tracing is enabled
+	Timings []Timings
+	// BodyTruncated is set when the body is larger than the maximum size read
+	BodyTruncated bool
 }
 
 // ChainItem request=>response
@@ -102,3 +111,31 @@ func (r *Response) GetChainLastURL() string {
 	}
 	return ""
 }
+
+// IsThrottled returns true if the server asks the client to slow down, which is
+// a 429 or a 503 carrying a Retry-After header
+func (r *Response) IsThrottled() bool {
+	if r.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	_, hasRetryAfter := r.Headers["Retry-After"]
+	return r.StatusCode == http.StatusServiceUnavailable && hasRetryAfter
+}
+
+// RetryAfter returns the delay requested by the Retry-After header, which can
+// be expressed either in seconds or as an http date
+func (r *Response) RetryAfter() time.Duration {
+	value := strings.TrimSpace(r.GetHeader("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/projectdiscovery/iputil"
+)
+
+// TLSProfile describes the tls configurations accepted by an endpoint
+type TLSProfile struct {
+	// Versions are the supported protocol versions
+	Versions []string `json:"versions,omitempty"`
+	// CipherSuites are the accepted cipher suites per version, in the order chosen by the
+	// server. For TLS 1.3 the suite can't be restricted and only the negotiated one is reported
+	CipherSuites map[string][]string `json:"cipher-suites,omitempty"`
+	// ALPN are the supported application protocols among the probed ones
+	ALPN         []string `json:"alpn,omitempty"`
+	OCSPStapling bool     `json:"ocsp-stapling,omitempty"`
+	SNIRequired  bool     `json:"sni-required,omitempty"`
+}
+
+var (
+	tlsProfileVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+	tlsProfileALPN     = []string{"h2", "http/1.1"}
+)
+
+// TLSVersionName returns the name of a tls protocol version
+func TLSVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "tls10"
+	case tls.VersionTLS11:
+		return "tls11"
+	case tls.VersionTLS12:
+		return "tls12"
+	case tls.VersionTLS13:
+		return "tls13"
+	}
+	return "unknown"
+}
+
+// TakeFunc waits until a connection can be opened and returns the function releasing it
+type TakeFunc func(ctx context.Context) (release func(), err error)
+
+// TLSProfile runs separate handshakes against host:port to enumerate the supported tls
+// versions, cipher suites and application protocols, the OCSP stapling and whether SNI is required.
+// If take is not nil it is called before each handshake to apply the rate limits.
+func (h *HTTPX) TLSProfile(ctx context.Context, host, port string, take TakeFunc) (*TLSProfile, error) {
+	// the handshakes of a profile go through the same proxy
+	ctx = h.WithProxy(ctx)
+	addr := net.JoinHostPort(host, port)
+	profile := &TLSProfile{CipherSuites: make(map[string][]string)}
+
+	var (
+		lastErr error
+		best    *tls.ConnectionState
+	)
+	for _, version := range tlsProfileVersions {
+		versionName := TLSVersionName(version)
+		offered := cipherSuitesFor(version)
+		for len(offered) > 0 {
+			state, err := h.tlsHandshake(ctx, take, addr, &tls.Config{
+				ServerName:         host,
+				MinVersion:         version,
+				MaxVersion:         version,
+				CipherSuites:       offered,
+				InsecureSkipVerify: true,
+			})
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if len(profile.CipherSuites[versionName]) == 0 {
+				profile.Versions = append(profile.Versions, versionName)
+				best = state
+			}
+			profile.CipherSuites[versionName] = append(profile.CipherSuites[versionName], tls.CipherSuiteName(state.CipherSuite))
+			if version == tls.VersionTLS13 {
+				break
+			}
+			// offer the remaining suites until the server refuses all of them
+			offered = removeCipherSuite(offered, state.CipherSuite)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if best == nil {
+		return nil, lastErr
+	}
+	profile.OCSPStapling = len(best.OCSPResponse) > 0
+
+	for _, protocol := range tlsProfileALPN {
+		state, err := h.tlsHandshake(ctx, take, addr, &tls.Config{
+			ServerName:         host,
+			MinVersion:         tls.VersionTLS10,
+			NextProtos:         []string{protocol},
+			InsecureSkipVerify: true,
+		})
+		if err == nil && state.NegotiatedProtocol == protocol {
+			profile.ALPN = append(profile.ALPN, protocol)
+		}
+	}
+
+	if !iputil.IsIP(host) {
+		// without server name no SNI extension is sent
+		_, err := h.tlsHandshake(ctx, take, addr, &tls.Config{
+			MinVersion:         tls.VersionTLS10,
+			InsecureSkipVerify: true,
+		})
+		profile.SNIRequired = err != nil && ctx.Err() == nil
+	}
+	return profile, nil
+}
+
+// tlsHandshake connects to the address and returns the state of the tls handshake
+func (h *HTTPX) tlsHandshake(ctx context.Context, take TakeFunc, addr string, config *tls.Config) (*tls.ConnectionState, error) {
+	if take != nil {
+		release, err := take(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	conn, err := h.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else if h.Options.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(h.Options.Timeout))
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	return &state, nil
+}
+
+// cipherSuitesFor returns the secure and insecure cipher suites usable with version
+func cipherSuitesFor(version uint16) []uint16 {
+	var ids []uint16
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			for _, supported := range suite.SupportedVersions {
+				if supported == version {
+					ids = append(ids, suite.ID)
+					break
+				}
+			}
+		}
+	}
+	return ids
+}
+
+func removeCipherSuite(suites []uint16, id uint16) []uint16 {
+	remaining := make([]uint16, 0, len(suites))
+	for _, suite := range suites {
+		if suite != id {
+			remaining = append(remaining, suite)
+		}
+	}
+	return remaining
+}
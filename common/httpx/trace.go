@@ -0,0 +1,157 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/iputil"
+)
+
+// Timings are the phases of a request, a negative duration means the phase didn't happen
+type Timings struct {
+	Start   time.Time
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	Send    time.Duration
+	Wait    time.Duration
+	Receive time.Duration
+}
+
+// requestTrace records the timings of each request sent for a probe, redirects included
+type requestTrace struct {
+	mu           sync.Mutex
+	timings      []Timings
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			now := time.Now()
+			if n := len(t.timings); n > 0 {
+				if t.firstByte.IsZero() {
+					// the previous attempt failed and is being retried
+					t.timings = t.timings[:n-1]
+				} else {
+					// the client drains the redirect body before following it
+					t.timings[n-1].Receive = now.Sub(t.firstByte)
+				}
+			}
+			t.timings = append(t.timings, Timings{Start: now, DNS: -1, Connect: -1, TLS: -1})
+			t.dnsStart, t.connectStart, t.tlsStart, t.gotConn, t.wroteRequest, t.firstByte = time.Time{}, time.Time{}, time.Time{}, now, time.Time{}, time.Time{}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mark(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.update(func(current *Timings) { current.DNS = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(_, _ string) {
+			t.mark(&t.connectStart)
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			t.update(func(current *Timings) { current.Connect = time.Since(t.connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			t.mark(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.update(func(current *Timings) { current.TLS = time.Since(t.tlsStart) })
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			t.mark(&t.gotConn)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.update(func(current *Timings) { current.Send = time.Since(t.gotConn) })
+			t.mark(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.update(func(current *Timings) { current.Wait = time.Since(t.wroteRequest) })
+			t.mark(&t.firstByte)
+		},
+	}
+}
+
+func (t *requestTrace) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *requestTrace) update(f func(current *Timings)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n := len(t.timings); n > 0 {
+		f(&t.timings[n-1])
+	}
+}
+
+// reset drops the timings recorded so far, when the probe is sent again
+func (t *requestTrace) reset() {
+	t.mu.Lock()
+	t.timings = nil
+	t.mu.Unlock()
+}
+
+// done completes the last request once its body has been read and returns the timings
+func (t *requestTrace) done() []Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n := len(t.timings); n > 0 && !t.firstByte.IsZero() {
+		t.timings[n-1].Receive = time.Since(t.firstByte)
+	}
+	return append([]Timings(nil), t.timings...)
+}
+
+// dialContext is the dialer of the transport. The host is resolved before dialing, so that
+// the dns lookup is traced apart from the connection and its failures are returned as
+// net.DNSError, while the connection failures to resolved hosts are returned as ConnectError.
+// The connections through a socks proxy are dialed by DialContext, resolving the names as the
+// other probes do.
+func (h *HTTPX) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if boundSocksProxy(ctx) != nil {
+		conn, err := h.DialContext(ctx, network, addr)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return nil, dnsErr
+		}
+		if err != nil {
+			return nil, connectError(ctx, addr, err)
+		}
+		return conn, nil
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && !iputil.IsIP(host) {
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.DNSStart != nil {
+			trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+		}
+		dnsData, err := h.Dialer.GetDNSData(host)
+		if err == nil && (dnsData == nil || len(dnsData.A)+len(dnsData.AAAA) == 0) {
+			err = dnsError(host, nil)
+		}
+		if trace != nil && trace.DNSDone != nil {
+			trace.DNSDone(httptrace.DNSDoneInfo{Err: err})
+		}
+		if err != nil {
+			return nil, dnsError(host, err)
+		}
+	}
+	conn, err := h.Dialer.Dial(ctx, network, addr)
+	if err != nil {
+		return nil, connectError(ctx, addr, err)
+	}
+	return conn, nil
+}
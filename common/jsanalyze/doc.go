@@ -0,0 +1,3 @@
+// Package jsanalyze extracts the api paths, urls, graphql endpoints, source maps and secrets
+// referenced by javascript files, each with the confidence of the match
+package jsanalyze
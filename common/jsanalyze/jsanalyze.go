@@ -0,0 +1,252 @@
+package jsanalyze
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Confidence levels of the findings
+const (
+	High   = "high"
+	Medium = "medium"
+	Low    = "low"
+)
+
+var (
+	// callRegex matches the urls passed to the common request functions
+	callRegex = regexp.MustCompile("(?:\\bfetch|\\baxios(?:\\.\\w+)?|\\$\\.(?:ajax|get|post|getJSON)|\\.open\\(\\s*[\"'`][A-Za-z]+[\"'`]\\s*,|\\b(?:url|uri|endpoint)\\s*:)\\s*\\(?\\s*[\"'`]([^\"'`\\s]+)[\"'`]")
+	// pathRegex matches the string literals starting with a slash
+	pathRegex = regexp.MustCompile("[\"'`](/[A-Za-z0-9_\\-.~%/:@!$&()*+,;=?#{}\\[\\]]*)[\"'`]")
+	// urlRegex matches the string literals holding an absolute url
+	urlRegex = regexp.MustCompile("[\"'`]((?:https?|wss?)://[^\"'`\\s<>\\\\]+)[\"'`]")
+	// apiPathRegex matches the paths which are likely api endpoints
+	apiPathRegex = regexp.MustCompile(`(?i)/(?:api|rest|graphql|gql|v\d+|internal|admin|auth|oauth2?|services?|rpc|ajax)(?:[/?.]|$)`)
+	// graphqlRegex matches the graphql endpoints
+	graphqlRegex = regexp.MustCompile(`(?i)graphql|/gql(?:[/?]|$)`)
+	// staticRegex matches the paths of static assets
+	staticRegex = regexp.MustCompile(`(?i)\.(?:png|jpe?g|gif|svg|ico|webp|bmp|css|woff2?|ttf|otf|eot|mp[34]|webm|avi)(?:\?|$)`)
+	// sourceMapRegex matches the source map comment of a script
+	sourceMapRegex = regexp.MustCompile(`(?m)^\s*//[#@]\s*sourceMappingURL=(\S+)`)
+	// jwtRegex matches the json web tokens, whose header is checked separately
+	jwtRegex = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]*`)
+)
+
+// noisyHosts are the hosts of the urls commonly found in libraries, such as specs and documentation
+var noisyHosts = []string{"www.w3.org", "w3.org", "schema.org", "reactjs.org", "react.dev", "fb.me", "developer.mozilla.org", "github.com", "jquery.com", "angular.io", "vuejs.org", "momentjs.com", "lodash.com", "example.com", "localhost"}
+
+// secretPatterns are the known secrets formats, the value is the first group of the regex or the whole match
+var secretPatterns = []struct {
+	kind       string
+	confidence string
+	regex      *regexp.Regexp
+}{
+	{"aws-access-key-id", High, regexp.MustCompile(`\b((?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16})\b`)},
+	{"aws-secret-access-key", Medium, regexp.MustCompile("(?i)aws.{0,20}?(?:secret|key).{0,20}?[\"'`]([A-Za-z0-9/+=]{40})[\"'`]")},
+	{"google-api-key", High, regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"github-token", High, regexp.MustCompile(`\b(?:gh[pousr]_[0-9A-Za-z]{36}|github_pat_[0-9A-Za-z_]{82})\b`)},
+	{"slack-token", High, regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,72}`)},
+	{"slack-webhook", High, regexp.MustCompile(`https://hooks\.slack\.com/services/T[0-9A-Za-z_]+/B[0-9A-Za-z_]+/[0-9A-Za-z_]+`)},
+	{"stripe-key", High, regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,99}\b`)},
+	{"private-key", High, regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{"generic-secret", Low, regexp.MustCompile("(?i)\\b(?:api[_-]?key|api[_-]?secret|access[_-]?token|auth[_-]?token|client[_-]?secret|secret[_-]?key|password)[\"'`]?\\s*[:=]\\s*[\"'`]([^\"'`\\s]{8,})[\"'`]")},
+}
+
+// Finding is a value found in a script
+type Finding struct {
+	Value string `json:"value"`
+	// Kind is the type of the secrets
+	Kind       string `json:"kind,omitempty"`
+	Confidence string `json:"confidence"`
+	// Source is the url of the script
+	Source string `json:"source"`
+}
+
+// Findings holds the findings of one or more scripts, each value is reported once
+type Findings struct {
+	Paths      []Finding
+	URLs       []Finding
+	GraphQL    []Finding
+	SourceMaps []Finding
+	Secrets    []Finding
+
+	seen map[string]struct{}
+}
+
+// Empty returns true if nothing was found
+func (f *Findings) Empty() bool {
+	return len(f.Paths) == 0 && len(f.URLs) == 0 && len(f.GraphQL) == 0 && len(f.SourceMaps) == 0 && len(f.Secrets) == 0
+}
+
+// Analyze adds the findings of the script at source, the source map headers of its response are also reported
+func (f *Findings) Analyze(source string, headers map[string][]string, data []byte) {
+	base, _ := url.Parse(source)
+	content := string(data)
+
+	// the urls passed to request functions are the most reliable
+	called := make(map[string]struct{})
+	for _, match := range callRegex.FindAllStringSubmatch(content, -1) {
+		value := match[1]
+		called[value] = struct{}{}
+		if isAbsoluteURL(value) {
+			f.addURL(value, High, source)
+		} else if !staticRegex.MatchString(value) && !strings.HasPrefix(value, "data:") {
+			f.addPath(value, High, source)
+		}
+	}
+	for _, match := range urlRegex.FindAllStringSubmatch(content, -1) {
+		if _, ok := called[match[1]]; ok {
+			continue
+		}
+		confidence := Medium
+		if u, err := url.Parse(match[1]); err != nil || isNoisyHost(u.Hostname()) {
+			confidence = Low
+		}
+		f.addURL(match[1], confidence, source)
+	}
+	for _, match := range pathRegex.FindAllStringSubmatch(content, -1) {
+		value := match[1]
+		if _, ok := called[value]; ok || len(value) < 2 || strings.HasPrefix(value, "//") || staticRegex.MatchString(value) {
+			continue
+		}
+		confidence := Low
+		if apiPathRegex.MatchString(value) {
+			confidence = Medium
+		}
+		f.addPath(value, confidence, source)
+	}
+
+	for _, match := range sourceMapRegex.FindAllStringSubmatch(content, -1) {
+		f.addSourceMap(base, match[1], source)
+	}
+	for key, values := range headers {
+		if strings.EqualFold(key, "SourceMap") || strings.EqualFold(key, "X-SourceMap") {
+			for _, value := range values {
+				f.addSourceMap(base, value, source)
+			}
+		}
+	}
+
+	for _, pattern := range secretPatterns {
+		for _, match := range pattern.regex.FindAllStringSubmatch(content, -1) {
+			value := match[0]
+			if len(match) > 1 && match[1] != "" {
+				value = match[1]
+			}
+			f.add("secrets", &f.Secrets, Finding{Value: value, Kind: pattern.kind, Confidence: pattern.confidence, Source: source})
+		}
+	}
+	for _, value := range jwtRegex.FindAllString(content, -1) {
+		confidence := Low
+		if isJWTHeader(value[:strings.Index(value, ".")]) {
+			confidence = High
+		}
+		f.add("secrets", &f.Secrets, Finding{Value: value, Kind: "jwt", Confidence: confidence, Source: source})
+	}
+}
+
+// ScriptSources returns the absolute urls of the scripts included by the html page
+func ScriptSources(pageURL string, data []byte) []string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+	var sources []string
+	seen := make(map[string]struct{})
+	doc.Find("script[src]").Each(func(_ int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		u, err := base.Parse(strings.TrimSpace(src))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		if _, ok := seen[u.String()]; ok {
+			return
+		}
+		seen[u.String()] = struct{}{}
+		sources = append(sources, u.String())
+	})
+	return sources
+}
+
+func (f *Findings) addPath(value, confidence, source string) {
+	f.add("paths", &f.Paths, Finding{Value: value, Confidence: confidence, Source: source})
+	if graphqlRegex.MatchString(value) {
+		f.add("graphql", &f.GraphQL, Finding{Value: value, Confidence: High, Source: source})
+	}
+}
+
+func (f *Findings) addURL(value, confidence, source string) {
+	f.add("urls", &f.URLs, Finding{Value: value, Confidence: confidence, Source: source})
+	if graphqlRegex.MatchString(value) {
+		f.add("graphql", &f.GraphQL, Finding{Value: value, Confidence: High, Source: source})
+	}
+}
+
+// addSourceMap adds the source map at the location relative to the script, the inline ones are skipped
+func (f *Findings) addSourceMap(base *url.URL, location, source string) {
+	location = strings.TrimSpace(location)
+	if location == "" || strings.HasPrefix(location, "data:") {
+		return
+	}
+	if base != nil {
+		if u, err := base.Parse(location); err == nil {
+			location = u.String()
+		}
+	}
+	f.add("source-maps", &f.SourceMaps, Finding{Value: location, Confidence: High, Source: source})
+}
+
+// add appends the finding to the category unless its value was already found there with the same kind
+func (f *Findings) add(category string, findings *[]Finding, finding Finding) {
+	if f.seen == nil {
+		f.seen = make(map[string]struct{})
+	}
+	key := category + "\x00" + finding.Kind + "\x00" + finding.Value
+	if _, ok := f.seen[key]; ok {
+		return
+	}
+	f.seen[key] = struct{}{}
+	*findings = append(*findings, finding)
+}
+
+func isAbsoluteURL(value string) bool {
+	lower := strings.ToLower(value)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "ws://") || strings.HasPrefix(lower, "wss://")
+}
+
+func isNoisyHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, noisy := range noisyHosts {
+		if host == noisy || strings.HasSuffix(host, "."+noisy) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJWTHeader returns true if the first part of the token decodes to a json header with an algorithm
+func isJWTHeader(part string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return false
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	return json.Unmarshal(decoded, &header) == nil && header.Alg != ""
+}
@@ -0,0 +1,3 @@
+// Package metrics contains a minimal registry of counters, gauges and histograms
+// exposed in the OpenMetrics text format
+package metrics
@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the OpenMetrics text format
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// DefaultBuckets are the default upper bounds in seconds of the histogram buckets
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// family is a metric with its samples
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics exposed together
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// WriteTo writes the metrics in the OpenMetrics text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: w}
+	writer := bufio.NewWriter(counter)
+	for _, f := range families {
+		f.write(writer)
+	}
+	writer.WriteString("# EOF\n")
+	err := writer.Flush()
+	return counter.n, err
+}
+
+// ServeHTTP exposes the metrics over http
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// vector holds the samples of a metric by label values
+type vector struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// histograms only
+	buckets []uint64
+	count   uint64
+}
+
+func newVector(name, help, kind string, labels []string) vector {
+	return vector{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+// get returns the series of the label values, the lock must be held
+func (v *vector) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values, the lock must be held
+func (v *vector) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	all := make([]*series, len(keys))
+	for i, key := range keys {
+		all[i] = v.series[key]
+	}
+	return all
+}
+
+func (v *vector) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escape(v.help))
+}
+
+func (v *vector) writeSample(w *bufio.Writer, suffix string, labelValues []string, extraLabel, extraValue string, value string) {
+	w.WriteString(v.name)
+	w.WriteString(suffix)
+	if len(v.labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range v.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escape(labelValues[i]))
+		}
+		if extraLabel != "" {
+			if len(v.labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	vector
+}
+
+// NewCounter registers a new counter, the name must not include the _total suffix
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vector: newVector(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// Inc increments by one the counter of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter of the label values, negative values are ignored
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.get(labelValues).value += value
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		c.writeSample(w, "_total", s.labelValues, "", "", formatFloat(s.value))
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	vector
+}
+
+// NewGauge registers a new gauge
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vector: newVector(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge of the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value = value
+	g.mu.Unlock()
+}
+
+// Add adds value, which can be negative, to the gauge of the label values
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value += value
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(w)
+	for _, s := range g.sorted() {
+		g.writeSample(w, "", s.labelValues, "", "", formatFloat(s.value))
+	}
+}
+
+// Histogram counts the observed values in buckets
+type Histogram struct {
+	vector
+	bounds []float64
+}
+
+// NewHistogram registers a new histogram with the given bucket upper bounds, DefaultBuckets if empty
+func (r *Registry) NewHistogram(name, help string, bounds []float64, labels ...string) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets
+	}
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	h := &Histogram{vector: newVector(name, help, "histogram", labels), bounds: bounds}
+	r.register(h)
+	return h
+}
+
+// Observe adds a value to the histogram of the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.bounds))
+	}
+	for i, bound := range h.bounds {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		for i, bound := range h.bounds {
+			h.writeSample(w, "_bucket", s.labelValues, "le", formatFloat(bound), strconv.FormatUint(s.buckets[i], 10))
+		}
+		h.writeSample(w, "_bucket", s.labelValues, "le", "+Inf", strconv.FormatUint(s.count, 10))
+		h.writeSample(w, "_count", s.labelValues, "", "", strconv.FormatUint(s.count, 10))
+		h.writeSample(w, "_sum", s.labelValues, "", "", formatFloat(s.value))
+	}
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escape escapes the label values and help texts
+func escape(value string) string {
+	return escaper.Replace(value)
+}
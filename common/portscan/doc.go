@@ -0,0 +1,3 @@
+// Package portscan parses the results of port scanners into the host and port pairs
+// to probe, along with the scheme of the services they identified
+package portscan
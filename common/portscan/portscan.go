@@ -0,0 +1,316 @@
+package portscan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Supported input formats
+const (
+	FormatNmapXML     = "nmap-xml"
+	FormatMasscanJSON = "masscan-json"
+	FormatNaabuJSON   = "naabu-json"
+	FormatJSONL       = "jsonl"
+)
+
+// Formats are all the supported input formats
+var Formats = []string{FormatNmapXML, FormatMasscanJSON, FormatNaabuJSON, FormatJSONL}
+
+// maxLineSize is the maximum size of a line of the json formats
+const maxLineSize = 1024 * 1024
+
+// Target is an open port of a host
+type Target struct {
+	Host string
+	Port int
+	// Scheme is http or https if the service was identified, empty otherwise
+	Scheme string
+	// NonHTTP is set when the service was identified as something else than http (eg ssh)
+	NonHTTP bool
+}
+
+// String returns the target as an url if the scheme is known, as host:port otherwise
+func (t Target) String() string {
+	hostPort := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	if t.Scheme == "" {
+		return hostPort
+	}
+	return t.Scheme + "://" + hostPort
+}
+
+// Parse returns the open ports of the port scan in the given format, in the order they are found.
+// Each host and port is returned once, with the scheme of any of its records identifying the service.
+// A port is only reported as non-http if none of its records identify an http service.
+func Parse(format string, r io.Reader) ([]Target, error) {
+	var parse func(io.Reader, func(Target)) error
+	switch format {
+	case FormatNmapXML:
+		parse = parseNmap
+	case FormatMasscanJSON:
+		parse = parseMasscan
+	case FormatNaabuJSON, FormatJSONL:
+		parse = parseJSONL
+	default:
+		return nil, fmt.Errorf("unknown input format '%s'", format)
+	}
+
+	var targets []Target
+	index := make(map[string]int)
+	err := parse(r, func(target Target) {
+		target.Host = strings.Trim(strings.TrimSpace(target.Host), "[]")
+		if target.Host == "" || target.Port <= 0 || target.Port > 65535 {
+			return
+		}
+		key := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+		if i, ok := index[key]; ok {
+			if targets[i].Scheme == "" {
+				targets[i].Scheme = target.Scheme
+			}
+			targets[i].NonHTTP = targets[i].Scheme == "" && (targets[i].NonHTTP || target.NonHTTP)
+			return
+		}
+		index[key] = len(targets)
+		targets = append(targets, target)
+	})
+	return targets, err
+}
+
+// newTarget returns the target of a port with the service identified on it, if any
+func newTarget(host string, port int, service string, tls bool) Target {
+	if nonHTTPService(service) {
+		return Target{Host: host, Port: port, NonHTTP: true}
+	}
+	return Target{Host: host, Port: port, Scheme: schemeOf(service, tls)}
+}
+
+// nonHTTPService reports whether the service was identified as something else than http. The
+// unidentified services, the bare tls ones and the ones known to speak http are probed
+func nonHTTPService(service string) bool {
+	service = strings.ToLower(strings.TrimSpace(service))
+	// ssl/imap is imap over tls
+	if i := strings.LastIndex(service, "/"); i >= 0 {
+		service = service[i+1:]
+	}
+	switch service {
+	case "", "unknown", "tcpwrapped", "ssl", "tls", "upnp", "ipp":
+		return false
+	}
+	return !strings.HasPrefix(service, "http")
+}
+
+// schemeOf returns the scheme of a service from its name (eg http, https-alt, ssl/http) or tls support
+func schemeOf(service string, tls bool) string {
+	service = strings.ToLower(strings.TrimSpace(service))
+	switch {
+	case tls, service == "ssl", service == "tls", strings.HasPrefix(service, "ssl/"), strings.HasPrefix(service, "tls/"), strings.HasPrefix(service, "https"):
+		return "https"
+	case strings.HasPrefix(service, "http"):
+		return "http"
+	}
+	return ""
+}
+
+type nmapHost struct {
+	Addresses []struct {
+		Addr     string `xml:"addr,attr"`
+		AddrType string `xml:"addrtype,attr"`
+	} `xml:"address"`
+	Hostnames []struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"hostnames>hostname"`
+	Ports []struct {
+		Protocol string `xml:"protocol,attr"`
+		PortID   int    `xml:"portid,attr"`
+		State    struct {
+			State string `xml:"state,attr"`
+		} `xml:"state"`
+		Service struct {
+			Name   string `xml:"name,attr"`
+			Tunnel string `xml:"tunnel,attr"`
+		} `xml:"service"`
+	} `xml:"ports>port"`
+}
+
+// parseNmap parses the nmap xml output (-oX), the hosts are streamed to handle large scans
+func parseNmap(r io.Reader, fn func(Target)) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not parse nmap xml: %s", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "host" {
+			continue
+		}
+		var host nmapHost
+		if err := decoder.DecodeElement(&host, &start); err != nil {
+			return fmt.Errorf("could not parse nmap xml: %s", err)
+		}
+
+		// the hostname given to nmap is preferred to the ip, reverse dns names may not serve the same content
+		var name string
+		for _, hostname := range host.Hostnames {
+			if hostname.Type == "user" {
+				name = hostname.Name
+				break
+			}
+		}
+		if name == "" {
+			for _, address := range host.Addresses {
+				if address.AddrType == "ipv4" || address.AddrType == "ipv6" {
+					name = address.Addr
+					break
+				}
+			}
+		}
+		for _, port := range host.Ports {
+			if port.Protocol != "tcp" || port.State.State != "open" {
+				continue
+			}
+			service := port.Service.Name
+			if port.Service.Tunnel != "" {
+				service = port.Service.Tunnel + "/" + service
+			}
+			fn(newTarget(name, port.PortID, service, false))
+		}
+	}
+}
+
+type masscanRecord struct {
+	IP    string `json:"ip"`
+	Ports []struct {
+		Port    int    `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		Service struct {
+			Name string `json:"name"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+// parseMasscan parses the masscan json (-oJ) and ndjson (-oD) outputs. The json output is an array
+// with a record per line, which older versions terminate with a trailing comma and a finished record.
+func parseMasscan(r io.Reader, fn func(Target)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		text = bytes.TrimSuffix(bytes.TrimPrefix(text, []byte("[")), []byte("]"))
+		text = bytes.TrimSpace(bytes.TrimSuffix(bytes.TrimSpace(text), []byte(",")))
+		if len(text) == 0 || bytes.HasPrefix(text, []byte("{finished")) {
+			continue
+		}
+		var record masscanRecord
+		if err := json.Unmarshal(text, &record); err != nil {
+			return fmt.Errorf("could not parse masscan json at line %d: %s", line, err)
+		}
+		for _, port := range record.Ports {
+			// the banner records have no status
+			if (port.Proto != "" && port.Proto != "tcp") || (port.Status != "" && port.Status != "open") {
+				continue
+			}
+			fn(newTarget(record.IP, port.Port, port.Service.Name, false))
+		}
+	}
+	return scanner.Err()
+}
+
+// jsonlRecord is a line of the naabu json output (-json) or of the generic json lines format, which
+// accepts the host or ip, port, scheme or service, tls and url keys
+type jsonlRecord struct {
+	Host    string          `json:"host"`
+	IP      string          `json:"ip"`
+	Port    json.RawMessage `json:"port"`
+	Scheme  string          `json:"scheme"`
+	Service string          `json:"service"`
+	TLS     bool            `json:"tls"`
+	URL     string          `json:"url"`
+}
+
+// parseJSONL parses a json object per line
+func parseJSONL(r io.Reader, fn func(Target)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var record jsonlRecord
+		if err := json.Unmarshal(text, &record); err != nil {
+			return fmt.Errorf("could not parse json at line %d: %s", line, err)
+		}
+		target, err := record.target()
+		if err != nil {
+			return fmt.Errorf("invalid record at line %d: %s", line, err)
+		}
+		fn(target)
+	}
+	return scanner.Err()
+}
+
+func (record jsonlRecord) target() (Target, error) {
+	host := record.Host
+	if host == "" {
+		host = record.IP
+	}
+	target := newTarget(host, 0, record.Service, record.TLS)
+	if scheme := strings.ToLower(record.Scheme); scheme == "http" || scheme == "https" {
+		target.Scheme, target.NonHTTP = scheme, false
+	}
+
+	if len(record.Port) > 0 {
+		// the port is a number, a string, or an object in some naabu versions
+		var port struct {
+			Port int  `json:"Port"`
+			TLS  bool `json:"TLS"`
+		}
+		var portString string
+		switch {
+		case json.Unmarshal(record.Port, &target.Port) == nil:
+		case json.Unmarshal(record.Port, &portString) == nil:
+			var err error
+			if target.Port, err = strconv.Atoi(portString); err != nil {
+				return target, fmt.Errorf("invalid port '%s'", portString)
+			}
+		case json.Unmarshal(record.Port, &port) == nil:
+			target.Port = port.Port
+			if port.TLS && !target.NonHTTP {
+				target.Scheme = "https"
+			}
+		default:
+			return target, fmt.Errorf("invalid port %s", record.Port)
+		}
+	}
+
+	if record.URL != "" {
+		u, err := url.Parse(record.URL)
+		if err != nil || u.Host == "" {
+			return target, fmt.Errorf("invalid url '%s'", record.URL)
+		}
+		target.Host, target.Scheme, target.NonHTTP = u.Hostname(), strings.ToLower(u.Scheme), false
+		if target.Scheme != "http" && target.Scheme != "https" {
+			return target, fmt.Errorf("invalid url '%s'", record.URL)
+		}
+		if target.Port, err = strconv.Atoi(u.Port()); err != nil {
+			target.Port = 80
+			if target.Scheme == "https" {
+				target.Port = 443
+			}
+		}
+	}
+	return target, nil
+}
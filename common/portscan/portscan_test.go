@@ -0,0 +1,145 @@
+package portscan
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFixtures(t *testing.T) {
+	tests := []struct {
+		format  string
+		fixture string
+		want    []Target
+	}{
+		{
+			format:  FormatNmapXML,
+			fixture: "nmap.xml",
+			want: []Target{
+				{Host: "example.com", Port: 22, NonHTTP: true},
+				{Host: "example.com", Port: 80, Scheme: "http"},
+				{Host: "example.com", Port: 443, Scheme: "https"},
+				{Host: "example.com", Port: 993, NonHTTP: true},
+				{Host: "example.com", Port: 9000},
+				{Host: "10.0.0.2", Port: 8443, Scheme: "https"},
+				{Host: "2001:db8::1", Port: 8000},
+			},
+		},
+		{
+			// the json output with the trailing comma and the finished record of older versions
+			format:  FormatMasscanJSON,
+			fixture: "masscan.json",
+			want: []Target{
+				{Host: "10.0.0.1", Port: 80, Scheme: "http"},
+				{Host: "10.0.0.1", Port: 22, NonHTTP: true},
+				{Host: "10.0.0.2", Port: 8443},
+			},
+		},
+		{
+			format:  FormatMasscanJSON,
+			fixture: "masscan.ndjson",
+			want:    []Target{{Host: "10.0.0.3", Port: 8080}},
+		},
+		{
+			// the port is a number, a string and an object
+			format:  FormatNaabuJSON,
+			fixture: "naabu.jsonl",
+			want: []Target{
+				{Host: "example.com", Port: 80},
+				{Host: "93.184.216.34", Port: 8443, Scheme: "https"},
+				{Host: "example.com", Port: 443, Scheme: "https"},
+				{Host: "10.0.0.1", Port: 22, NonHTTP: true},
+			},
+		},
+	}
+	for _, test := range tests {
+		file, err := os.Open(filepath.Join("testdata", test.fixture))
+		if err != nil {
+			t.Fatalf("could not open fixture: %s", err)
+		}
+		got, err := Parse(test.format, file)
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: Parse returned error: %s", test.fixture, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Parse = %+v, want %+v", test.fixture, got, test.want)
+		}
+	}
+}
+
+func TestParseMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Target
+	}{
+		{
+			name:  "scheme wins over a non-http service",
+			input: `{"ip":"10.0.0.1","port":8080,"service":"ssh"}` + "\n" + `{"ip":"10.0.0.1","port":8080,"scheme":"http"}`,
+			want:  Target{Host: "10.0.0.1", Port: 8080, Scheme: "http"},
+		},
+		{
+			name:  "non-http service doesn't override a scheme",
+			input: `{"ip":"10.0.0.1","port":8080,"tls":true}` + "\n" + `{"ip":"10.0.0.1","port":8080,"service":"ssh"}`,
+			want:  Target{Host: "10.0.0.1", Port: 8080, Scheme: "https"},
+		},
+		{
+			name:  "first scheme is kept",
+			input: `{"ip":"10.0.0.1","port":8080,"scheme":"http"}` + "\n" + `{"ip":"10.0.0.1","port":8080,"scheme":"https"}`,
+			want:  Target{Host: "10.0.0.1", Port: 8080, Scheme: "http"},
+		},
+		{
+			name:  "unidentified then non-http",
+			input: `{"ip":"10.0.0.1","port":22}` + "\n" + `{"ip":"10.0.0.1","port":22,"service":"ssh"}`,
+			want:  Target{Host: "10.0.0.1", Port: 22, NonHTTP: true},
+		},
+		{
+			name:  "url and host records are the same port",
+			input: `{"url":"https://[2001:db8::1]/"}` + "\n" + `{"host":"[2001:db8::1]","port":"443","service":"ssh"}`,
+			want:  Target{Host: "2001:db8::1", Port: 443, Scheme: "https"},
+		},
+	}
+	for _, test := range tests {
+		got, err := Parse(FormatJSONL, strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%s: Parse returned error: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, []Target{test.want}) {
+			t.Errorf("%s: Parse = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+	}{
+		{"csv", "10.0.0.1,80"},
+		{FormatNmapXML, `<nmaprun><host><address addr="10.0.0.1" addrtype="ipv4"/><ports>`},
+		{FormatMasscanJSON, `{"ip":"10.0.0.1","ports":[{"port":"80"}]}`},
+		{FormatNaabuJSON, `{"ip":"10.0.0.1","port":"http"}`},
+		{FormatNaabuJSON, `{"ip":"10.0.0.1","port":[80]}`},
+		{FormatJSONL, `{"url":"ftp://example.com"}`},
+		{FormatJSONL, `not json`},
+	}
+	for _, test := range tests {
+		if _, err := Parse(test.format, strings.NewReader(test.input)); err == nil {
+			t.Errorf("Parse(%s, %q) succeeded, want error", test.format, test.input)
+		}
+	}
+}
+
+func TestTargetString(t *testing.T) {
+	if got := (Target{Host: "2001:db8::1", Port: 8443, Scheme: "https"}).String(); got != "https://[2001:db8::1]:8443" {
+		t.Errorf("String = %s", got)
+	}
+	if got := (Target{Host: "example.com", Port: 22, NonHTTP: true}).String(); got != "example.com:22" {
+		t.Errorf("String = %s", got)
+	}
+}
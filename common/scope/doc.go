@@ -0,0 +1,3 @@
+// Package scope decides whether hosts and urls are in scope according to a list of
+// include and exclude rules on hosts, wildcards, cidrs, ports and path prefixes
+package scope
@@ -0,0 +1,269 @@
+package scope
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ruleRegex splits a rule into scheme, host or ip, cidr bits, ports and path
+var ruleRegex = regexp.MustCompile(`^(?:(https?)://)?(\[[^\]]+\]|[^/:\[\]]+)(?:/(\d{1,3}))?(?::([\d,\-]+))?(/.*)?$`)
+
+// rule is a single line of a scope file
+type rule struct {
+	exclude bool
+	regex   *regexp.Regexp
+
+	scheme string
+	// host is either an exact host, a wildcard (*.example.com) or * for any host
+	host    string
+	network *net.IPNet
+	ports   []portRange
+	path    string
+}
+
+type portRange struct {
+	from, to int
+}
+
+// Scope holds the include and exclude rules. A url is in scope if it matches one of the
+// include rules, or there are none, and none of the exclude rules.
+// All the methods consider everything in scope on a nil receiver.
+type Scope struct {
+	includes []*rule
+	excludes []*rule
+}
+
+// Load loads the rules of a scope file
+func Load(path string) (*Scope, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse parses the rules, one per line. Empty lines and the ones starting with # are ignored,
+// the exclude rules start with !. A rule is either a regex on the url prefixed by re:, or
+// [scheme://]host[:ports][/path] where host is a hostname, a wildcard (*.example.com), * for
+// any host, an ip or a cidr, ports a comma separated list of ports or ranges (80,8000-8100)
+// and path a path prefix.
+func Parse(r io.Reader) (*Scope, error) {
+	s := &Scope{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule, err := parseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule at line %d: %s", line, err)
+		}
+		if rule.exclude {
+			s.excludes = append(s.excludes, rule)
+		} else {
+			s.includes = append(s.includes, rule)
+		}
+	}
+	return s, scanner.Err()
+}
+
+func parseRule(text string) (*rule, error) {
+	r := &rule{}
+	if strings.HasPrefix(text, "!") {
+		r.exclude = true
+		text = strings.TrimSpace(text[1:])
+	}
+	if strings.HasPrefix(text, "re:") {
+		regex, err := regexp.Compile(text[3:])
+		if err != nil {
+			return nil, err
+		}
+		r.regex = regex
+		return r, nil
+	}
+
+	parts := ruleRegex.FindStringSubmatch(text)
+	if parts == nil {
+		return nil, fmt.Errorf("'%s' is not a valid rule", text)
+	}
+	r.scheme = strings.ToLower(parts[1])
+	r.host = strings.ToLower(strings.Trim(parts[2], "[]"))
+	r.path = parts[5]
+	if bits := parts[3]; bits != "" {
+		if net.ParseIP(r.host) == nil {
+			// a path made of digits on a hostname
+			r.path = "/" + bits + r.path
+		} else {
+			_, network, err := net.ParseCIDR(r.host + "/" + bits)
+			if err != nil {
+				return nil, err
+			}
+			r.network = network
+		}
+	} else if ip := net.ParseIP(r.host); ip != nil {
+		r.host = ip.String()
+	}
+	if strings.Contains(strings.TrimPrefix(r.host, "*."), "*") {
+		return nil, fmt.Errorf("'%s' is not a valid wildcard, use *.domain", r.host)
+	}
+	if parts[4] != "" {
+		for _, item := range strings.Split(parts[4], ",") {
+			var ports portRange
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if ports.from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid port '%s'", item)
+			}
+			ports.to = ports.from
+			if len(bounds) == 2 {
+				if ports.to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid port range '%s'", item)
+				}
+			}
+			if ports.from < 1 || ports.to > 65535 || ports.from > ports.to {
+				return nil, fmt.Errorf("invalid port range '%s'", item)
+			}
+			r.ports = append(r.ports, ports)
+		}
+	}
+	return r, nil
+}
+
+// matchHost returns true if the rule applies to the host
+func (r *rule) matchHost(host string) bool {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if r.network != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && r.network.Contains(ip)
+	}
+	switch {
+	case r.host == "*":
+		return true
+	case strings.HasPrefix(r.host, "*."):
+		return strings.HasSuffix(host, r.host[1:])
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	}
+	return host == r.host
+}
+
+// hostWide returns true if the rule applies to all the urls of the hosts it matches
+func (r *rule) hostWide() bool {
+	return r.regex == nil && r.scheme == "" && len(r.ports) == 0 && r.path == ""
+}
+
+func (r *rule) match(u *url.URL) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(u.String())
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if r.scheme != "" && r.scheme != scheme {
+		return false
+	}
+	if !r.matchHost(u.Hostname()) {
+		return false
+	}
+	if len(r.ports) > 0 {
+		port, err := strconv.Atoi(u.Port())
+		if err != nil {
+			switch scheme {
+			case "http":
+				port = 80
+			case "https":
+				port = 443
+			}
+		}
+		matched := false
+		for _, ports := range r.ports {
+			if port >= ports.from && port <= ports.to {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if r.path != "" {
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		return strings.HasPrefix(path, r.path)
+	}
+	return true
+}
+
+// Allowed returns true if the url is in scope
+func (s *Scope) Allowed(u *url.URL) bool {
+	if s == nil {
+		return true
+	}
+	for _, rule := range s.excludes {
+		if rule.match(u) {
+			return false
+		}
+	}
+	if len(s.includes) == 0 {
+		return true
+	}
+	for _, rule := range s.includes {
+		if rule.match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// HostAllowed returns false if none of the urls of the host can be in scope. It's a
+// pre-filter for the targets whose port and path are not known yet, the urls of the
+// hosts allowed must still be checked with Allowed.
+func (s *Scope) HostAllowed(host string) bool {
+	if s == nil {
+		return true
+	}
+	for _, rule := range s.excludes {
+		if rule.hostWide() && rule.matchHost(host) {
+			return false
+		}
+	}
+	if len(s.includes) == 0 {
+		return true
+	}
+	for _, rule := range s.includes {
+		if rule.regex != nil || rule.matchHost(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludedNetworks returns the ips and cidrs excluded entirely, which can't be dialed
+// even when a hostname in scope resolves to them
+func (s *Scope) ExcludedNetworks() []string {
+	if s == nil {
+		return nil
+	}
+	var networks []string
+	for _, rule := range s.excludes {
+		if !rule.hostWide() {
+			continue
+		}
+		if rule.network != nil {
+			networks = append(networks, rule.network.String())
+		} else if net.ParseIP(rule.host) != nil {
+			networks = append(networks, rule.host)
+		}
+	}
+	return networks
+}
@@ -0,0 +1,224 @@
+package scope
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, rules string) *Scope {
+	t.Helper()
+	s, err := Parse(strings.NewReader(rules))
+	if err != nil {
+		t.Fatalf("could not parse rules %q: %s", rules, err)
+	}
+	return s
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		urls  map[string]bool
+	}{
+		{
+			name:  "no rules",
+			rules: "# nothing\n\n",
+			urls:  map[string]bool{"https://anything.test/": true},
+		},
+		{
+			name:  "exact host",
+			rules: "example.com",
+			urls: map[string]bool{
+				"https://example.com/":       true,
+				"http://EXAMPLE.com:8080/x":  true,
+				"https://www.example.com/":   false,
+				"https://example.com.evil/":  false,
+				"https://notexample.com/":    false,
+				"https://evil.test/?example": false,
+			},
+		},
+		{
+			name:  "wildcard doesn't include the apex",
+			rules: "*.example.com",
+			urls: map[string]bool{
+				"https://www.example.com/":    true,
+				"https://a.b.example.com/":    true,
+				"https://example.com/":        false,
+				"https://badexample.com/":     false,
+				"https://www.example.com.io/": false,
+			},
+		},
+		{
+			name:  "only excludes",
+			rules: "!*.internal.test",
+			urls: map[string]bool{
+				"https://example.com/":       true,
+				"https://db.internal.test/":  false,
+				"https://internal.test/":     true,
+				"http://10.0.0.1:8080/admin": true,
+			},
+		},
+		{
+			name:  "exclude wins over include",
+			rules: "*.example.com\nexample.com\n!admin.example.com\n!example.com/private",
+			urls: map[string]bool{
+				"https://www.example.com/":          true,
+				"https://admin.example.com/":        false,
+				"https://example.com/":              true,
+				"https://example.com/private":       false,
+				"https://example.com/private/a":     false,
+				"https://www.example.com/private":   true,
+				"https://admin.example.com/public/": false,
+			},
+		},
+		{
+			name:  "ports with default schemes",
+			rules: "example.com:443,8000-8100",
+			urls: map[string]bool{
+				"https://example.com/":       true,
+				"http://example.com/":        false,
+				"http://example.com:443/":    true,
+				"https://example.com:8000/":  true,
+				"https://example.com:8100/":  true,
+				"https://example.com:8101/":  false,
+				"http://example.com:7999/":   false,
+				"https://example.com:8443/":  false,
+				"https://other.example.com/": false,
+			},
+		},
+		{
+			name:  "scheme",
+			rules: "https://example.com",
+			urls: map[string]bool{
+				"https://example.com/":      true,
+				"HTTPS://example.com:8443/": true,
+				"http://example.com/":       false,
+			},
+		},
+		{
+			name:  "path prefix",
+			rules: "example.com/api\n!example.com/api/internal",
+			urls: map[string]bool{
+				"https://example.com/api":            true,
+				"https://example.com/api/v1?x=1":     true,
+				"https://example.com/api/internal/x": false,
+				"https://example.com/":               false,
+				"https://example.com":                false,
+				"https://example.com/v1/api":         false,
+			},
+		},
+		{
+			name:  "root path",
+			rules: "example.com/",
+			urls: map[string]bool{
+				"https://example.com":   true,
+				"https://example.com/a": true,
+			},
+		},
+		{
+			name:  "numeric path on a hostname isn't a cidr",
+			rules: "example.com/24",
+			urls: map[string]bool{
+				"https://example.com/24/a": true,
+				"https://example.com/":     false,
+			},
+		},
+		{
+			name:  "cidr and ips",
+			rules: "10.0.0.0/24\n192.168.1.10:8080\n[::1]\n!10.0.0.128/25",
+			urls: map[string]bool{
+				"http://10.0.0.1/":         true,
+				"http://10.0.0.127:8443/":  true,
+				"http://10.0.0.200/":       false,
+				"http://10.0.1.1/":         false,
+				"http://192.168.1.10:8080": true,
+				"http://192.168.1.10/":     false,
+				"http://[::1]:8080/":       true,
+				"http://[0:0::1]/":         true,
+				"http://example.com/":      false,
+			},
+		},
+		{
+			name:  "regex",
+			rules: `re:^https://[a-z]+\.example\.com/app/` + "\n" + `!re:logout`,
+			urls: map[string]bool{
+				"https://www.example.com/app/":       true,
+				"https://www.example.com/app/logout": false,
+				"http://www.example.com/app/":        false,
+				"https://www1.example.com/app/":      false,
+			},
+		},
+	}
+	for _, test := range tests {
+		s := mustParse(t, test.rules)
+		for rawURL, want := range test.urls {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				t.Fatalf("invalid url %q: %s", rawURL, err)
+			}
+			if got := s.Allowed(u); got != want {
+				t.Errorf("%s: Allowed(%s) = %v, want %v", test.name, rawURL, got, want)
+			}
+		}
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	s := mustParse(t, "*.example.com\nexample.org/api\n10.0.0.0/24\n!admin.example.com\n!www.example.com/private\n!10.0.0.5")
+	tests := map[string]bool{
+		"www.example.com":   true,
+		"admin.example.com": false,
+		"example.com":       false,
+		// the rule only restricts the path, the host keeps other urls in scope
+		"example.org": true,
+		"10.0.0.1":    true,
+		"10.0.0.5":    false,
+		"10.0.1.1":    false,
+		"example.net": false,
+	}
+	for host, want := range tests {
+		if got := s.HostAllowed(host); got != want {
+			t.Errorf("HostAllowed(%s) = %v, want %v", host, got, want)
+		}
+	}
+
+	// the regex rules can't be checked without the url
+	if !mustParse(t, `re:^https://app\.`).HostAllowed("anything.test") {
+		t.Errorf("HostAllowed rejected a host which a regex rule may allow")
+	}
+	var nilScope *Scope
+	if !nilScope.HostAllowed("example.com") || !nilScope.Allowed(&url.URL{Scheme: "https", Host: "example.com"}) {
+		t.Errorf("a nil scope doesn't allow everything")
+	}
+}
+
+func TestExcludedNetworks(t *testing.T) {
+	s := mustParse(t, "!10.0.0.0/8\n!192.168.1.1\n!172.16.0.1:8080\n!example.com\n!re:10\\.1\\.")
+	want := []string{"10.0.0.0/8", "192.168.1.1"}
+	if got := s.ExcludedNetworks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExcludedNetworks = %v, want %v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"re:(",
+		"example.com:0",
+		"example.com:70000",
+		"example.com:9000-8000",
+		"example.com:80-",
+		"ex*ample.com",
+		"*",
+		"*.*.example.com",
+		"ftp://example.com",
+		"10.0.0.0/33",
+		"example.com\n!",
+	}
+	for _, rules := range tests {
+		if _, err := Parse(strings.NewReader(rules)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", rules)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package store keeps the response bodies deduplicated by their sha256 hash together
+// with an index of the probes that served them
+package store
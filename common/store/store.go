@@ -0,0 +1,268 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sviivyao/httpx/common/hashes"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	indexFile = "index.db"
+	blobsDir  = "blobs"
+)
+
+var (
+	entriesBucket = []byte("entries")
+	hashBucket    = []byte("by-hash")
+	urlBucket     = []byte("by-url")
+	statusBucket  = []byte("by-status")
+)
+
+// Entry is a probe recorded in the index
+type Entry struct {
+	URL        string            `json:"url"`
+	Timestamp  time.Time         `json:"timestamp"`
+	StatusCode int               `json:"status-code"`
+	BodyHash   string            `json:"body-sha256"`
+	Hashes     map[string]string `json:"hashes,omitempty"`
+	// Blob is the path of the body relative to the store directory
+	Blob string `json:"blob"`
+}
+
+// Store is a content addressed store of response bodies with an index database
+type Store struct {
+	dir string
+	db  *bolt.DB
+}
+
+// Open opens or creates the store in dir. A read only store can be opened while a scan
+// is writing to it only once the scan is over, as the index is locked by the writer
+func Open(dir string, readOnly bool) (*Store, error) {
+	if !readOnly {
+		if err := os.MkdirAll(filepath.Join(dir, blobsDir), os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(filepath.Join(dir, indexFile), 0644, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("could not open index: %s", err)
+	}
+	if !readOnly {
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, bucket := range [][]byte{entriesBucket, hashBucket, urlBucket, statusBucket} {
+				if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &Store{dir: dir, db: db}, nil
+}
+
+// Close closes the index
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// BlobPath returns the absolute path of the blob of an entry
+func (s *Store) BlobPath(entry Entry) string {
+	return filepath.Join(s.dir, entry.Blob)
+}
+
+// Put stores the body unless an identical one is already present and indexes the probe
+func (s *Store) Put(url string, timestamp time.Time, statusCode int, body []byte, extraHashes map[string]string) (Entry, error) {
+	bodyHash := hashes.Sha256(body)
+	entry := Entry{
+		URL:        url,
+		Timestamp:  timestamp.UTC(),
+		StatusCode: statusCode,
+		BodyHash:   bodyHash,
+		Hashes:     extraHashes,
+		Blob:       filepath.Join(blobsDir, bodyHash[:2], bodyHash),
+	}
+	if err := s.writeBlob(entry.Blob, body); err != nil {
+		return entry, err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return entry, err
+	}
+	// batching lets the concurrent probes share the index commits
+	err = s.db.Batch(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(entriesBucket)
+		seq, err := entries.NextSequence()
+		if err != nil {
+			return err
+		}
+		id := make([]byte, 8)
+		binary.BigEndian.PutUint64(id, seq)
+		if err := entries.Put(id, data); err != nil {
+			return err
+		}
+		hashValues := []string{bodyHash}
+		for _, value := range extraHashes {
+			hashValues = append(hashValues, value)
+		}
+		for _, value := range hashValues {
+			if err := tx.Bucket(hashBucket).Put(indexKey(value, id), nil); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(urlBucket).Put(indexKey(url, id), nil); err != nil {
+			return err
+		}
+		return tx.Bucket(statusBucket).Put(indexKey(strconv.Itoa(statusCode), id), nil)
+	})
+	return entry, err
+}
+
+// writeBlob writes the body once, a blob being only ever created with its final content
+func (s *Store) writeBlob(blob string, body []byte) error {
+	path := filepath.Join(s.dir, blob)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Query selects the entries of the index, the set criteria must all match
+type Query struct {
+	// Hash matches the body sha256 or any of the other recorded hashes
+	Hash string
+	// URLPrefix matches the urls starting with the prefix
+	URLPrefix string
+	// StatusCode matches the status code if not zero
+	StatusCode int
+	// Limit is the maximum number of entries returned if not zero
+	Limit int
+}
+
+// Query returns the entries matching the query in the order they were recorded
+func (s *Store) Query(query Query) ([]Entry, error) {
+	var results []Entry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(entriesBucket)
+		if entries == nil {
+			return nil
+		}
+		// the most selective index is used to find the candidates, the others are checked on the entries
+		var ids [][]byte
+		switch {
+		case query.Hash != "":
+			ids = scanIndex(tx.Bucket(hashBucket), []byte(query.Hash+"\x00"))
+		case query.URLPrefix != "":
+			ids = scanIndex(tx.Bucket(urlBucket), []byte(query.URLPrefix))
+		case query.StatusCode != 0:
+			ids = scanIndex(tx.Bucket(statusBucket), []byte(strconv.Itoa(query.StatusCode)+"\x00"))
+		default:
+			_ = entries.ForEach(func(id, _ []byte) error {
+				ids = append(ids, id)
+				return nil
+			})
+		}
+		sortIDs(ids)
+
+		for _, id := range ids {
+			data := entries.Get(id)
+			if data == nil {
+				continue
+			}
+			var entry Entry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			if !query.matches(entry) {
+				continue
+			}
+			results = append(results, entry)
+			if query.Limit > 0 && len(results) >= query.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return results, err
+}
+
+func (query Query) matches(entry Entry) bool {
+	if query.Hash != "" && entry.BodyHash != query.Hash {
+		found := false
+		for _, value := range entry.Hashes {
+			if value == query.Hash {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if query.URLPrefix != "" && !strings.HasPrefix(entry.URL, query.URLPrefix) {
+		return false
+	}
+	return query.StatusCode == 0 || entry.StatusCode == query.StatusCode
+}
+
+// indexKey is the value followed by a separator and the entry id, so that the keys
+// of a value are contiguous and unique
+func indexKey(value string, id []byte) []byte {
+	key := make([]byte, 0, len(value)+1+len(id))
+	key = append(key, value...)
+	key = append(key, 0)
+	return append(key, id...)
+}
+
+// scanIndex returns the entry ids of the keys starting with prefix
+func scanIndex(bucket *bolt.Bucket, prefix []byte) [][]byte {
+	var ids [][]byte
+	if bucket == nil {
+		return ids
+	}
+	cursor := bucket.Cursor()
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+		if len(key) < 8 {
+			continue
+		}
+		ids = append(ids, append([]byte(nil), key[len(key)-8:]...))
+	}
+	return ids
+}
+
+func sortIDs(ids [][]byte) {
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i], ids[j]) < 0
+	})
+}
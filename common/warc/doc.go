@@ -0,0 +1,2 @@
+// Package warc writes http exchanges as gzip compressed WARC 1.1 archives
+package warc
@@ -0,0 +1,266 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1" //nolint
+	"encoding/base32"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Version is the WARC format version of the records
+const Version = "WARC/1.1"
+
+// DefaultMaxSize is the size after which a new file is started
+const DefaultMaxSize = 1024 * 1024 * 1024
+
+// Exchange is a request and the response received for it
+type Exchange struct {
+	// TargetURI is the url of the request
+	TargetURI string
+	// IP is the address the request was sent to
+	IP string
+	// Date is the time the request was sent
+	Date     time.Time
+	Request  []byte
+	Response []byte
+	// Truncated is the reason the response was cut short, written as WARC-Truncated if set
+	Truncated string
+	// Metadata is written as a metadata record about the response if set
+	Metadata map[string]string
+}
+
+// Writer writes the exchanges to gzip compressed WARC files, each record being a separate
+// gzip member as expected by the replay tools. Files are rotated once they exceed MaxSize
+type Writer struct {
+	mu       sync.Mutex
+	dir      string
+	prefix   string
+	software string
+	maxSize  int64
+	serial   int
+	file     *os.File
+	size     int64
+}
+
+// New creates a writer storing the archives in dir. Files are named after the prefix,
+// the creation time and a serial number
+func New(dir, prefix, software string, maxSize int64) (*Writer, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &Writer{dir: dir, prefix: prefix, software: software, maxSize: maxSize}, nil
+}
+
+// Write appends the exchanges to the current file. The records of the exchanges are kept
+// together, so a redirect chain is never split across files
+func (w *Writer) Write(exchanges ...Exchange) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil || w.size >= w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	for _, exchange := range exchanges {
+		date := exchange.Date.UTC()
+		requestID, responseID := recordID(), recordID()
+		request := Record{
+			Type:  "request",
+			ID:    requestID,
+			Date:  date,
+			Block: exchange.Request,
+			Headers: [][2]string{
+				{"WARC-Target-URI", exchange.TargetURI},
+				{"WARC-Concurrent-To", responseID},
+				{"Content-Type", "application/http;msgtype=request"},
+			},
+		}
+		response := Record{
+			Type:  "response",
+			ID:    responseID,
+			Date:  date,
+			Block: exchange.Response,
+			Headers: [][2]string{
+				{"WARC-Target-URI", exchange.TargetURI},
+				{"Content-Type", "application/http;msgtype=response"},
+			},
+		}
+		if exchange.Truncated != "" {
+			response.Headers = append(response.Headers, [2]string{"WARC-Truncated", exchange.Truncated})
+		}
+		if exchange.IP != "" {
+			request.Headers = append(request.Headers, [2]string{"WARC-IP-Address", exchange.IP})
+			response.Headers = append(response.Headers, [2]string{"WARC-IP-Address", exchange.IP})
+		}
+		records := []Record{response, request}
+		if len(exchange.Metadata) > 0 {
+			records = append(records, Record{
+				Type:  "metadata",
+				ID:    recordID(),
+				Date:  date,
+				Block: fields(exchange.Metadata),
+				Headers: [][2]string{
+					{"WARC-Target-URI", exchange.TargetURI},
+					{"WARC-Concurrent-To", responseID},
+					{"Content-Type", "application/warc-fields"},
+				},
+			})
+		}
+		for _, record := range records {
+			if err := w.writeRecord(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the current file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate closes the current file and starts a new one with a warcinfo record
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+	}
+	var (
+		name string
+		file *os.File
+		err  error
+	)
+	// never overwrite the archives of a previous run started within the same second
+	for {
+		w.serial++
+		name = fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, time.Now().UTC().Format("20060102150405"), w.serial)
+		file, err = os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	w.file, w.size = file, 0
+	return w.writeRecord(Record{
+		Type:  "warcinfo",
+		ID:    recordID(),
+		Date:  time.Now().UTC(),
+		Block: fields(map[string]string{"software": w.software, "format": "WARC File Format 1.1"}),
+		Headers: [][2]string{
+			{"WARC-Filename", name},
+			{"Content-Type", "application/warc-fields"},
+		},
+	})
+}
+
+func (w *Writer) writeRecord(record Record) error {
+	counter := &countingWriter{w: w.file}
+	gz := gzip.NewWriter(counter)
+	if _, err := record.WriteTo(gz); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	w.size += counter.n
+	return nil
+}
+
+// Record is a WARC record
+type Record struct {
+	Type    string
+	ID      string
+	Date    time.Time
+	Headers [][2]string
+	Block   []byte
+}
+
+// WriteTo writes the uncompressed record
+func (r Record) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString(Version + "\r\n")
+	writeHeader(&buf, "WARC-Type", r.Type)
+	writeHeader(&buf, "WARC-Record-ID", r.ID)
+	writeHeader(&buf, "WARC-Date", r.Date.Format("2006-01-02T15:04:05.000000Z"))
+	for _, header := range r.Headers {
+		writeHeader(&buf, header[0], header[1])
+	}
+	digest := sha1.Sum(r.Block) //nolint
+	writeHeader(&buf, "WARC-Block-Digest", "sha1:"+base32.StdEncoding.EncodeToString(digest[:]))
+	writeHeader(&buf, "Content-Length", strconv.Itoa(len(r.Block)))
+	buf.WriteString("\r\n")
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+// fields encodes the values as application/warc-fields
+func fields(values map[string]string) []byte {
+	var buf bytes.Buffer
+	for _, name := range sortedKeys(values) {
+		writeHeader(&buf, name, values[name])
+	}
+	return buf.Bytes()
+}
+
+// recordID returns a random uuid urn
+func recordID() string {
+	var uuid [16]byte
+	_, _ = rand.Read(uuid[:])
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
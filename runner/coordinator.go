@@ -0,0 +1,285 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/hmap/store/hybrid"
+	"github.com/projectdiscovery/iputil"
+	"github.com/projectdiscovery/mapcidr"
+)
+
+const (
+	// batchSize is the maximum number of work units handed out to a worker at once
+	batchSize = 100
+	// batchLeaseTimeout is the time after which a batch whose results were not pushed is handed out again
+	batchLeaseTimeout = 10 * time.Minute
+	// batchPollWait is the maximum time a worker waits for a batch before being told to retry
+	batchPollWait = 5 * time.Second
+)
+
+// workUnit is a target probed by a worker, on the given path or on the one of the worker if empty
+type workUnit struct {
+	Target string `json:"target"`
+	Path   string `json:"path,omitempty"`
+}
+
+// workBatch is the response to a worker pulling work: a batch of units,
+// none if it should retry later, or done once all the targets were probed
+type workBatch struct {
+	ID    string     `json:"id,omitempty"`
+	Units []workUnit `json:"units,omitempty"`
+	Done  bool       `json:"done,omitempty"`
+}
+
+// workResult is a result pushed by a worker, along with its plain text output
+type workResult struct {
+	Str    string          `json:"str"`
+	Result json.RawMessage `json:"result"`
+}
+
+type lease struct {
+	batch   workBatch
+	expires time.Time
+}
+
+// coordinator hands out the targets to the workers in batches and merges their results
+// in a single deduplicated output. The batches of the workers which don't push their
+// results before the lease expires are handed out again.
+type coordinator struct {
+	server  *http.Server
+	units   chan workUnit
+	output  chan Result
+	seen    *hybrid.HybridMap
+	metrics *scanMetrics
+
+	mu      sync.Mutex
+	leases  map[string]*lease
+	expired []workBatch
+	pulling int
+	closed  bool
+	done    chan struct{}
+}
+
+// newCoordinator starts serving the batches at addr, the results are sent to output
+func newCoordinator(addr string, output chan Result, metrics *scanMetrics) (*coordinator, error) {
+	seen, err := hybrid.New(hybrid.DefaultDiskOptions)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		seen.Close()
+		return nil, err
+	}
+	c := &coordinator{
+		units:   make(chan workUnit),
+		output:  output,
+		seen:    seen,
+		metrics: metrics,
+		leases:  make(map[string]*lease),
+		done:    make(chan struct{}),
+	}
+	router := httprouter.New()
+	router.POST("/batches", c.pull)
+	router.POST("/batches/:id", c.push)
+	c.server = &http.Server{Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := c.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			gologger.Warning().Msgf("Could not serve workers: %s\n", err)
+		}
+	}()
+	gologger.Info().Msgf("Waiting for workers on %s\n", listener.Addr())
+	return c, nil
+}
+
+// add queues the units of an input target, expanding cidrs so that their ips are spread among the workers
+func (c *coordinator) add(ctx context.Context, target string, paths []string) error {
+	targets := []string{target}
+	if iputil.IsCIDR(target) {
+		ips, err := mapcidr.IPAddresses(target)
+		if err != nil {
+			gologger.Warning().Msgf("Could not expand cidr %s: %s\n", target, err)
+			return nil
+		}
+		targets = ips
+	}
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	for _, target := range targets {
+		for _, path := range paths {
+			select {
+			case c.units <- workUnit{Target: target, Path: path}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// wait waits for the results of all the units queued, or for ctx to be canceled, and stops serving the workers
+func (c *coordinator) wait(ctx context.Context) {
+	c.mu.Lock()
+	c.closed = true
+	close(c.units)
+	c.checkDone()
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		// the workers waiting for a batch are told that the scan is done
+		select {
+		case <-time.After(batchPollWait):
+		case <-ctx.Done():
+		}
+	case <-ctx.Done():
+	}
+	// the workers still pushing their results are waited for
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := c.server.Shutdown(shutdownCtx); err != nil {
+		gologger.Warning().Msgf("Could not stop serving workers: %s\n", err)
+	}
+}
+
+// Close releases the resources of the coordinator
+func (c *coordinator) Close() error {
+	c.seen.Close()
+	return c.server.Close()
+}
+
+// pull hands out a batch to a worker, the expired batches first
+func (c *coordinator) pull(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	c.mu.Lock()
+	now := time.Now()
+	for id, l := range c.leases {
+		if now.After(l.expires) {
+			gologger.Debug().Msgf("Lease of batch %s expired, handing it out again\n", id)
+			delete(c.leases, id)
+			c.expired = append(c.expired, l.batch)
+		}
+	}
+	if len(c.expired) > 0 {
+		batch := c.expired[0]
+		c.expired = c.expired[1:]
+		c.leases[batch.ID] = &lease{batch: batch, expires: now.Add(batchLeaseTimeout)}
+		c.mu.Unlock()
+		writeJSON(w, http.StatusOK, batch)
+		return
+	}
+	// the units taken from the queue are not leased yet
+	c.pulling++
+	c.mu.Unlock()
+
+	var units []workUnit
+	closed := false
+	timer := time.NewTimer(batchPollWait)
+	defer timer.Stop()
+	// waits for the first unit, then takes the ones already available
+	select {
+	case unit, ok := <-c.units:
+		if ok {
+			units = append(units, unit)
+		}
+		closed = !ok
+	case <-timer.C:
+	case <-req.Context().Done():
+		c.mu.Lock()
+		c.pulling--
+		c.checkDone()
+		c.mu.Unlock()
+		return
+	}
+fill:
+	for !closed && len(units) < batchSize {
+		select {
+		case unit, ok := <-c.units:
+			if !ok {
+				closed = true
+				break fill
+			}
+			units = append(units, unit)
+		default:
+			break fill
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pulling--
+	var batch workBatch
+	switch {
+	case len(units) > 0:
+		batch = workBatch{ID: randomID(), Units: units}
+		c.leases[batch.ID] = &lease{batch: batch, expires: time.Now().Add(batchLeaseTimeout)}
+	case closed && len(c.leases) == 0 && len(c.expired) == 0 && c.pulling == 0:
+		batch.Done = true
+	}
+	writeJSON(w, http.StatusOK, batch)
+}
+
+// push merges the results of a batch in the output
+func (c *coordinator) push(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	scanner := bufio.NewScanner(req.Body)
+	scanner.Buffer(nil, maxDiffLineSize)
+	for scanner.Scan() {
+		var pushed workResult
+		if err := json.Unmarshal(scanner.Bytes(), &pushed); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "could not decode result"))
+			return
+		}
+		var result Result
+		if err := json.Unmarshal(pushed.Result, &result); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "could not decode result"))
+			return
+		}
+		// a batch handed out again after its lease expired may be probed twice
+		key := diffKey(result.Method, result.URL)
+		if _, ok := c.seen.Get(key); ok {
+			continue
+		}
+		_ = c.seen.Set(key, nil)
+		result.str = pushed.Str
+		c.metrics.queued(1)
+		c.output <- result
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "could not read results"))
+		return
+	}
+
+	id := ps.ByName("id")
+	c.mu.Lock()
+	delete(c.leases, id)
+	for i, batch := range c.expired {
+		if batch.ID == id {
+			c.expired = append(c.expired[:i], c.expired[i+1:]...)
+			break
+		}
+	}
+	c.checkDone()
+	c.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkDone signals when all the units were probed, the lock must be held
+func (c *coordinator) checkDone() {
+	if !c.closed || len(c.leases) > 0 || len(c.expired) > 0 || c.pulling > 0 {
+		return
+	}
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+}
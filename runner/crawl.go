@@ -0,0 +1,310 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/sviivyao/httpx/common/httpx"
+)
+
+// sitemapLocRegex matches the urls of the sitemaps and sitemap indexes
+var sitemapLocRegex = regexp.MustCompile(`(?i)<loc>\s*([^<]+?)\s*</loc>`)
+
+// crawlSelectors are the elements of the html pages linking to other resources, with the attribute holding the url
+var crawlSelectors = []struct {
+	selector, attribute string
+}{
+	{"a[href]", "href"},
+	{"area[href]", "href"},
+	{"link[href]", "href"},
+	{"script[src]", "src"},
+	{"iframe[src]", "src"},
+	{"frame[src]", "src"},
+	{"form", "action"},
+}
+
+// crawler crawls each origin once, from the first successful probe on it
+type crawler struct {
+	depth    int
+	maxPages int
+
+	mu      sync.Mutex
+	origins map[string]*crawlState
+}
+
+// crawlState holds the pages of an origin queued so far
+type crawlState struct {
+	seen  map[string]struct{}
+	pages int
+}
+
+func newCrawler(depth, maxPages int) *crawler {
+	return &crawler{depth: depth, maxPages: maxPages, origins: make(map[string]*crawlState)}
+}
+
+// start returns true if the origin wasn't crawled yet, the root page counts as its first page
+func (c *crawler) start(origin, root string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.origins[origin]; ok {
+		return false
+	}
+	c.origins[origin] = &crawlState{seen: map[string]struct{}{root: {}}, pages: 1}
+	return true
+}
+
+// crawlPage is a page found while crawling an origin, journaled when queued so that
+// a resumed scan crawls the pages left. The root of the crawl has a depth of 0.
+type crawlPage struct {
+	url    string
+	source string
+	depth  int
+	input  string
+}
+
+// crawlJournalPrefix starts the lines of the resume file journaling the crawled pages
+const crawlJournalPrefix = "crawl\t"
+
+// String returns the journal line of the page
+func (p crawlPage) String() string {
+	return crawlJournalPrefix + strings.Join([]string{strconv.Itoa(p.depth), p.url, p.source, p.input}, "\t")
+}
+
+// parseCrawlPage parses a journal line of a crawled page
+func parseCrawlPage(line string) (crawlPage, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(line, crawlJournalPrefix), "\t", 4)
+	if len(parts) != 4 {
+		return crawlPage{}, false
+	}
+	depth, err := strconv.Atoi(parts[0])
+	if err != nil || depth < 0 {
+		return crawlPage{}, false
+	}
+	return crawlPage{url: parts[1], source: parts[2], depth: depth, input: parts[3]}, true
+}
+
+// unit returns the resume unit of the page
+func (p crawlPage) unit() string {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return ""
+	}
+	return resumeUnit(u.Host, http.MethodGet, u.Scheme, u.RequestURI())
+}
+
+// crawl starts crawling the origin of the result from the same origin pages it links to, including
+// the entries of robots.txt and sitemap.xml. The pages are queued in the pool breadth first up to the
+// crawl depth and the maximum number of pages of the origin, each one being a result of its own
+// tagged with its depth and the url linking to it.
+func (r *Runner) crawl(root Result, wg *probePool, hp *httpx.HTTPX, scanopts *scanOptions) {
+	if root.Err != nil || root.StatusCode == 0 {
+		return
+	}
+	rootURL, err := url.Parse(root.URL)
+	if err != nil {
+		return
+	}
+	origin := crawlOrigin(rootURL)
+	if origin == "" || !r.crawler.start(origin, crawlKey(rootURL)) {
+		return
+	}
+	if r.resume != nil {
+		r.resume.MarkQueued(crawlPage{url: crawlKey(rootURL), source: root.URL, input: root.Input})
+	}
+	links := make([]string, 0, len(root.links)+2)
+	links = append(links, root.links...)
+	links = append(links, origin+"/robots.txt", origin+"/sitemap.xml")
+	r.queueCrawl(wg, hp, scanopts, origin, links, root.URL, 1, root.Input)
+}
+
+// queueCrawl queues the pages of the origin among the links which weren't queued yet
+func (r *Runner) queueCrawl(wg *probePool, hp *httpx.HTTPX, scanopts *scanOptions, origin string, links []string, source string, depth int, input string) {
+	r.crawler.mu.Lock()
+	defer r.crawler.mu.Unlock()
+	state := r.crawler.origins[origin]
+	for _, link := range links {
+		if state.pages >= r.crawler.maxPages {
+			return
+		}
+		u, err := url.Parse(link)
+		if err != nil || crawlOrigin(u) != origin {
+			continue
+		}
+		key := crawlKey(u)
+		if _, ok := state.seen[key]; ok {
+			continue
+		}
+		state.seen[key] = struct{}{}
+		if !r.urlInScope(key) {
+			continue
+		}
+		state.pages++
+		page := crawlPage{url: key, source: source, depth: depth, input: input}
+		// the page is journaled before the result linking to it is completed
+		if r.resume != nil {
+			r.resume.MarkQueued(page)
+		}
+		wg.queueCrawl(page, hp, scanopts)
+	}
+}
+
+// resumeCrawl restores the state of the crawled origins from the journal and queues the pages
+// which weren't completed
+func (r *Runner) resumeCrawl(wg *probePool) {
+	if r.crawler == nil || r.resume == nil {
+		return
+	}
+	for _, page := range r.resume.crawlPages {
+		u, err := url.Parse(page.url)
+		if err != nil {
+			continue
+		}
+		origin := crawlOrigin(u)
+		r.crawler.mu.Lock()
+		state, ok := r.crawler.origins[origin]
+		if !ok {
+			state = &crawlState{seen: make(map[string]struct{}), pages: 1}
+			r.crawler.origins[origin] = state
+		}
+		state.seen[page.url] = struct{}{}
+		// the root of the origin is probed as part of the input
+		if page.depth == 0 {
+			r.crawler.mu.Unlock()
+			continue
+		}
+		state.pages++
+		r.crawler.mu.Unlock()
+		if !r.resume.Completed(page.unit()) {
+			wg.queueCrawl(page, r.hp, &r.scanopts)
+		}
+	}
+}
+
+// processCrawlPage probes a crawled page and queues the pages it links to
+func (r *Runner) processCrawlPage(ctx context.Context, wg *probePool, page crawlPage, hp *httpx.HTTPX, scanopts *scanOptions, output chan Result) {
+	unit := page.unit()
+	if unit == "" || (r.resume != nil && r.resume.Completed(unit)) {
+		return
+	}
+	u, _ := url.Parse(page.url)
+	pageScanopts := scanopts.Clone()
+	pageScanopts.RequestURI = u.RequestURI()
+	r.metrics.queued(1)
+	wg.Add()
+	go func() {
+		defer wg.Done()
+		result := r.analyze(ctx, hp, u.Scheme, u.Host, http.MethodGet, page.input, pageScanopts)
+		result.CrawlDepth = page.depth
+		result.CrawlSource = page.source
+		result.resumeUnit = unit
+		r.setErrorType(&result)
+		if page.depth < r.crawler.depth {
+			r.queueCrawl(wg, hp, scanopts, crawlOrigin(u), result.links, page.url, page.depth+1, page.input)
+		}
+		output <- result
+	}()
+}
+
+// crawlOrigin returns the scheme, host and port of the url, without the default ports
+func crawlOrigin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme != httpx.HTTP && scheme != httpx.HTTPS) || u.Host == "" {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && !(scheme == httpx.HTTP && port == "80") && !(scheme == httpx.HTTPS && port == "443") {
+		host += ":" + port
+	}
+	return scheme + "://" + host
+}
+
+// crawlKey returns the url without its fragment, used to fetch each page once
+func crawlKey(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key := crawlOrigin(u) + path
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+// crawlLinks returns the absolute urls linked from the response: the links, forms, scripts and
+// stylesheets of the html pages, the entries of robots.txt and the locations of the sitemaps
+func crawlLinks(pageURL string, resp *httpx.Response) []string {
+	base, err := url.Parse(pageURL)
+	if err != nil || len(resp.Data) == 0 {
+		return nil
+	}
+	var links []string
+	add := func(link string) {
+		link = strings.TrimSpace(link)
+		if link == "" || strings.HasPrefix(link, "#") {
+			return
+		}
+		if u, err := base.Parse(link); err == nil {
+			links = append(links, u.String())
+		}
+	}
+
+	contentType := strings.ToLower(resp.GetHeaderPart("Content-Type", ";"))
+	switch {
+	case strings.HasSuffix(base.Path, "/robots.txt") && !strings.Contains(contentType, "html"):
+		scanner := bufio.NewScanner(bytes.NewReader(resp.Data))
+		for scanner.Scan() {
+			parts := strings.SplitN(scanner.Text(), ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			value := strings.TrimSpace(parts[1])
+			switch strings.ToLower(strings.TrimSpace(parts[0])) {
+			case "allow", "disallow":
+				// the patterns can't be fetched as they are
+				if !strings.Contains(value, "*") {
+					add(strings.TrimSuffix(value, "$"))
+				}
+			case "sitemap":
+				add(value)
+			}
+		}
+	case strings.Contains(contentType, "xml") || bytes.Contains(resp.Data, []byte("<urlset")) || bytes.Contains(resp.Data, []byte("<sitemapindex")):
+		for _, match := range sitemapLocRegex.FindAllSubmatch(resp.Data, -1) {
+			add(html.UnescapeString(string(match[1])))
+		}
+	case strings.Contains(contentType, "html"):
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(resp.Data))
+		if err != nil {
+			return nil
+		}
+		if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+			if u, err := base.Parse(href); err == nil {
+				base = u
+			}
+		}
+		for _, element := range crawlSelectors {
+			doc.Find(element.selector).Each(func(_ int, s *goquery.Selection) {
+				value, ok := s.Attr(element.attribute)
+				// a form without action is submitted to the page itself
+				if !ok || strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "javascript:") {
+					return
+				}
+				add(value)
+			})
+		}
+	}
+	return links
+}
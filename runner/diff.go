@@ -0,0 +1,174 @@
+package runner
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/pkg/errors"
+	"github.com/sviivyao/httpx/common/hashes"
+)
+
+// Change types of the results reported in diff mode
+const (
+	ChangeNew     = "new"
+	ChangeChanged = "changed"
+	ChangeRemoved = "removed"
+)
+
+// maxDiffLineSize is the maximum size of a line of the previous output, which may include the response body
+const maxDiffLineSize = 64 * 1024 * 1024
+
+// scanDiff compares the results of the scan with the ones of a previous run,
+// keyed by method and url. It's only used by the output routine.
+type scanDiff struct {
+	previous     map[string]Result
+	seen         map[string]struct{}
+	threshold    int
+	technologies bool
+}
+
+// newScanDiff loads the previous JSON lines output at path
+func newScanDiff(path string, threshold int, technologies bool) (*scanDiff, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := &scanDiff{
+		previous:     make(map[string]Result),
+		seen:         make(map[string]struct{}),
+		threshold:    threshold,
+		technologies: technologies,
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxDiffLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var result Result
+		if err := json.Unmarshal([]byte(text), &result); err != nil {
+			return nil, errors.Wrapf(err, "could not parse line %d", line)
+		}
+		// endpoints removed in the previous diff are gone for good
+		if result.URL == "" || result.Change == ChangeRemoved {
+			continue
+		}
+		result.Change, result.Changes = "", nil
+		d.previous[diffKey(result.Method, result.URL)] = result
+	}
+	return d, scanner.Err()
+}
+
+func diffKey(method, url string) string {
+	return method + " " + url
+}
+
+// compare marks the result as seen and sets its change, returning false if the endpoint is unchanged
+func (d *scanDiff) compare(result *Result) bool {
+	key := diffKey(result.Method, result.URL)
+	d.seen[key] = struct{}{}
+
+	previous, ok := d.previous[key]
+	if !ok {
+		result.Change = ChangeNew
+		return true
+	}
+	changes := d.changes(&previous, result)
+	if len(changes) == 0 {
+		return false
+	}
+	result.Change = ChangeChanged
+	result.Changes = changes
+	return true
+}
+
+// changes returns the fields which changed between two results of the same endpoint.
+// Fields which were not collected in both runs are not compared.
+func (d *scanDiff) changes(previous, current *Result) []string {
+	var changes []string
+	if previous.StatusCode != current.StatusCode {
+		changes = append(changes, "status-code")
+	}
+	if previous.Title != current.Title {
+		changes = append(changes, "title")
+	}
+	if d.technologies && !sameStrings(previous.Technologies, current.Technologies) {
+		changes = append(changes, "technologies")
+	}
+	if previousFingerprint, currentFingerprint := certFingerprint(previous), certFingerprint(current); previousFingerprint != "" && currentFingerprint != "" && previousFingerprint != currentFingerprint {
+		changes = append(changes, "cert-fingerprint")
+	}
+	if distance, err := hashes.SimhashDistance(previous.Hashes["body-simhash"], current.Hashes["body-simhash"]); err == nil && distance > d.threshold {
+		changes = append(changes, "body-simhash")
+	}
+	return changes
+}
+
+// removed returns the endpoints of the previous run which were not seen, sorted by url
+func (d *scanDiff) removed() []Result {
+	var removed []Result
+	for key, result := range d.previous {
+		if _, ok := d.seen[key]; ok {
+			continue
+		}
+		result.Change = ChangeRemoved
+		result.str = result.URL
+		removed = append(removed, result)
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].URL != removed[j].URL {
+			return removed[i].URL < removed[j].URL
+		}
+		return removed[i].Method < removed[j].Method
+	})
+	return removed
+}
+
+func certFingerprint(result *Result) string {
+	if result.TLSData == nil {
+		return ""
+	}
+	return result.TLSData.FingerprintSHA256
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// changeString returns the change of the result for the plain text output
+func changeString(result Result, noColor bool) string {
+	change := result.Change
+	if len(result.Changes) > 0 {
+		change += ": " + strings.Join(result.Changes, ",")
+	}
+	if !noColor {
+		switch result.Change {
+		case ChangeNew:
+			change = aurora.Green(change).String()
+		case ChangeChanged:
+			change = aurora.Yellow(change).String()
+		case ChangeRemoved:
+			change = aurora.Red(change).String()
+		}
+	}
+	return " [" + change + "]"
+}
@@ -0,0 +1,167 @@
+package runner
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/iputil"
+	"github.com/projectdiscovery/urlutil"
+	"github.com/sviivyao/httpx/common/httpx"
+	"golang.org/x/net/publicsuffix"
+)
+
+// hostnameRegex matches the hostnames in the links and scripts of the response bodies
+var hostnameRegex = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}\b`)
+
+// domainDiscovery finds the subdomains of the input domains, in the responses and by resolving
+// the names of a wordlist. The candidates are deduplicated and probed as new targets.
+type domainDiscovery struct {
+	wordlist []string
+
+	mu sync.Mutex
+	// roots are the domains already brute forced
+	roots map[string]struct{}
+}
+
+func newDomainDiscovery(wordlist []string) *domainDiscovery {
+	var words []string
+	for _, word := range wordlist {
+		if word = strings.Trim(strings.TrimSpace(strings.ToLower(word)), "."); word != "" {
+			words = append(words, word)
+		}
+	}
+	return &domainDiscovery{wordlist: words, roots: make(map[string]struct{})}
+}
+
+// rootDomain returns the registrable domain of the host, empty for ips and public suffixes
+func rootDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || iputil.IsIP(host) {
+		return ""
+	}
+	root, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+	return root
+}
+
+// discoverDomains returns the subdomains of the root domain of the host found in the response:
+// in the certificate names, the csp, the redirect locations and the links and scripts of the body
+func discoverDomains(host string, resp *httpx.Response) []string {
+	host = strings.ToLower(host)
+	root := rootDomain(host)
+	if root == "" {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	var domains []string
+	add := func(name string) {
+		name = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "*."), ".")
+		if name == host || (name != root && !strings.HasSuffix(name, "."+root)) {
+			return
+		}
+		if _, ok := seen[name]; ok {
+			return
+		}
+		seen[name] = struct{}{}
+		domains = append(domains, name)
+	}
+	addURL := func(rawURL string) {
+		if u, err := url.Parse(rawURL); err == nil {
+			add(u.Hostname())
+		}
+	}
+
+	if resp.TLSData != nil {
+		for _, name := range resp.TLSData.DNSNames {
+			add(name)
+		}
+		for _, name := range resp.TLSData.CommonName {
+			add(name)
+		}
+	}
+	if resp.CSPData != nil {
+		for _, name := range resp.CSPData.Domains {
+			add(name)
+		}
+	}
+	addURL(resp.GetHeaderPart("Location", ";"))
+	for _, item := range resp.Chain {
+		addURL(item.RequestURL)
+		addURL(item.Location)
+	}
+	for _, name := range hostnameRegex.FindAllString(string(resp.Data), -1) {
+		add(name)
+	}
+	return domains
+}
+
+// discover queues the domains discovered in the result as new targets
+func (r *Runner) discover(ctx context.Context, result Result, wg *probePool, hp *httpx.HTTPX, protocol string, scanopts *scanOptions) {
+	for _, domain := range result.discovered {
+		if r.inputStopped(ctx) {
+			return
+		}
+		if !r.inScope(domain) || !r.testAndSet(domain) {
+			continue
+		}
+		gologger.Verbose().Msgf("Discovered %s on %s\n", domain, result.URL)
+		wg.queue(domain, hp, protocol, scanopts)
+	}
+}
+
+// bruteForce resolves the names of the wordlist under the root domain of the target, once per root
+// domain, and queues the ones resolving as new targets. Roots with wildcard dns records are skipped.
+func (r *Runner) bruteForce(ctx context.Context, target string, wg *probePool, hp *httpx.HTTPX, protocol string, scanopts *scanOptions) {
+	d := r.discovery
+	if len(d.wordlist) == 0 {
+		return
+	}
+	host := target
+	if URL, err := urlutil.Parse(target); err == nil && URL.Host != "" {
+		host = URL.Host
+	}
+	root := rootDomain(host)
+	if root == "" {
+		return
+	}
+	d.mu.Lock()
+	_, done := d.roots[root]
+	d.roots[root] = struct{}{}
+	d.mu.Unlock()
+	if done {
+		return
+	}
+
+	if ips, _, err := getDNSData(hp, randomID()+"."+root); err == nil && len(ips) > 0 {
+		gologger.Warning().Msgf("Skipping subdomain brute force of %s: wildcard dns record\n", root)
+		return
+	}
+	gologger.Verbose().Msgf("Resolving %d subdomains of %s\n", len(d.wordlist), root)
+	for _, word := range d.wordlist {
+		if r.inputStopped(ctx) {
+			return
+		}
+		domain := word + "." + root
+		if !r.inScope(domain) {
+			continue
+		}
+		wg.Add()
+		go func(domain string) {
+			defer wg.Done()
+			if ips, _, err := getDNSData(hp, domain); err != nil || len(ips) == 0 {
+				return
+			}
+			if !r.testAndSet(domain) {
+				return
+			}
+			gologger.Verbose().Msgf("Discovered %s by brute force\n", domain)
+			wg.queue(domain, hp, protocol, scanopts)
+		}(domain)
+	}
+}
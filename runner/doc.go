@@ -1,2 +1,16 @@
 // Package runner executes the enumeration process.
+//
+// The runner can be embedded in other tools by building the options programmatically:
+//
+//	options := runner.DefaultOptions
+//	options.InputTargets = []string{"example.com"}
+//	options.OnResult = func(result runner.Result) {
+//		fmt.Println(result.URL, result.StatusCode)
+//	}
+//	httpxRunner, err := runner.New(&options)
+//	if err != nil {
+//		return err
+//	}
+//	defer httpxRunner.Close()
+//	return httpxRunner.RunEnumerationWithContext(ctx)
 package runner
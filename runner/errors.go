@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/sviivyao/httpx/common/httpx"
+)
+
+// Types of the errors reported in the results
+const (
+	ErrorTypeDNSNXDomain          = "dns_nxdomain"
+	ErrorTypeDNSTimeout           = "dns_timeout"
+	ErrorTypeTCPRefused           = "tcp_refused"
+	ErrorTypeTCPTimeout           = "tcp_timeout"
+	ErrorTypeTCPReset             = "tcp_reset"
+	ErrorTypeTLSHandshake         = "tls_handshake"
+	ErrorTypeTLSVersion           = "tls_version"
+	ErrorTypeHTTPMalformed        = "http_malformed"
+	ErrorTypeHTTPTimeout          = "http_timeout"
+	ErrorTypeHostSkippedMaxErrors = "host_skipped_max_errors"
+	ErrorTypeCDNPortSkipped       = "cdn_port_skipped"
+	ErrorTypeOutOfScope           = "out_of_scope"
+	ErrorTypeUnknown              = "unknown"
+)
+
+// errorTypes are all the error types, in the order they are reported in the statistics
+var errorTypes = []string{
+	ErrorTypeDNSNXDomain, ErrorTypeDNSTimeout,
+	ErrorTypeTCPRefused, ErrorTypeTCPTimeout, ErrorTypeTCPReset,
+	ErrorTypeTLSHandshake, ErrorTypeTLSVersion,
+	ErrorTypeHTTPMalformed, ErrorTypeHTTPTimeout,
+	ErrorTypeHostSkippedMaxErrors, ErrorTypeCDNPortSkipped, ErrorTypeOutOfScope, ErrorTypeUnknown,
+}
+
+var (
+	errSkippedMaxErrors = errors.New("skipping as previously unresponsive")
+	errCDNPortSkipped   = errors.New("cdn target only allows ports 80 and 443")
+	errOutOfScope       = errors.New("url is out of scope")
+)
+
+// errorType classifies the error of a probe, interrupted probes have no error type
+func errorType(err error) string {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return ""
+	}
+	switch {
+	case errors.Is(err, errSkippedMaxErrors):
+		return ErrorTypeHostSkippedMaxErrors
+	case errors.Is(err, errCDNPortSkipped):
+		return ErrorTypeCDNPortSkipped
+	case errors.Is(err, errOutOfScope):
+		return ErrorTypeOutOfScope
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ErrorTypeDNSTimeout
+		}
+		return ErrorTypeDNSNXDomain
+	}
+
+	message := strings.ToLower(err.Error())
+	timeout := isTimeout(err, message)
+	var requestErr *httpx.RequestError
+	if errors.As(err, &requestErr) {
+		switch requestErr.Phase {
+		case httpx.PhaseDNS:
+			if timeout {
+				return ErrorTypeDNSTimeout
+			}
+			return ErrorTypeDNSNXDomain
+		case httpx.PhaseConnect:
+			if timeout {
+				return ErrorTypeTCPTimeout
+			}
+		case httpx.PhaseTLS:
+			if isTLSVersion(message) {
+				return ErrorTypeTLSVersion
+			}
+			return ErrorTypeTLSHandshake
+		}
+	}
+
+	// the raw requests don't report the phase they failed in
+	switch {
+	case isTLSVersion(message):
+		return ErrorTypeTLSVersion
+	case strings.Contains(message, "tls: "), strings.Contains(message, "x509: "), strings.Contains(message, "tls handshake"),
+		strings.Contains(message, "http response to https client"):
+		return ErrorTypeTLSHandshake
+	case strings.Contains(message, "malformed"), strings.Contains(message, "invalid header"), strings.Contains(message, "missing status"):
+		return ErrorTypeHTTPMalformed
+	case errors.Is(err, syscall.ECONNREFUSED), strings.Contains(message, "connection refused"):
+		return ErrorTypeTCPRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		strings.Contains(message, "connection reset"), strings.HasSuffix(message, "eof"):
+		return ErrorTypeTCPReset
+	case timeout:
+		return ErrorTypeHTTPTimeout
+	case strings.Contains(message, "no such host"), strings.Contains(message, "could not resolve host"), strings.Contains(message, "no address found"):
+		return ErrorTypeDNSNXDomain
+	}
+	return ErrorTypeUnknown
+}
+
+func isTimeout(err error, message string) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) ||
+		strings.Contains(message, "timeout") || strings.Contains(message, "deadline exceeded")
+}
+
+func isTLSVersion(message string) bool {
+	return strings.Contains(message, "protocol version") || strings.Contains(message, "unsupported protocol version") ||
+		strings.Contains(message, "no supported versions")
+}
+
+// setErrorType classifies the error of the result and counts it in the statistics
+func (r *Runner) setErrorType(result *Result) {
+	if result.ErrorType == "" {
+		result.ErrorType = errorType(result.Err)
+	}
+	if result.ErrorType != "" && r.options.ShowStatistics {
+		r.stats.IncrementCounter("errors-"+result.ErrorType, 1)
+	}
+}
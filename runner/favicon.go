@@ -0,0 +1,221 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bluele/gcache"
+	"github.com/projectdiscovery/gologger"
+	"github.com/sviivyao/httpx/common/hashes"
+	"github.com/sviivyao/httpx/common/httpx"
+	"github.com/sviivyao/httpx/common/stringz"
+)
+
+// maxFavicons is the maximum number of icons hashed per page
+const maxFavicons = 10
+
+// maxCachedIcons is the number of icons whose hash is kept in memory
+const maxCachedIcons = 10000
+
+// Favicon is the hash of an icon of a page
+type Favicon struct {
+	URL  string `json:"url" csv:"url"`
+	MMH3 string `json:"mmh3" csv:"mmh3"`
+	MD5  string `json:"md5" csv:"md5"`
+}
+
+// iconCache caches the hash of each icon url, which is shared by all the paths and methods
+// probed on the origin
+type iconCache struct {
+	mu      sync.Mutex
+	entries gcache.Cache
+}
+
+type iconEntry struct {
+	done    chan struct{}
+	favicon *Favicon
+}
+
+func newIconCache() *iconCache {
+	return &iconCache{entries: gcache.New(maxCachedIcons).LRU().Build()}
+}
+
+// favicons hashes the icons linked from the page, or /favicon.ico if there are none.
+// The icons embedded as data uris are decoded instead of being fetched, and a page which
+// is an image itself is hashed as is.
+func (r *Runner) favicons(ctx context.Context, hp *httpx.HTTPX, pageURL string, resp *httpx.Response) []Favicon {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	if isIcon(resp) {
+		favicon := newFavicon(pageURL, resp.Data)
+		r.icons.set(pageURL, favicon)
+		return []Favicon{*favicon}
+	}
+	links := faviconLinks(base, resp)
+	if len(links) == 0 {
+		links = []string{base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()}
+	}
+
+	var favicons []Favicon
+	for _, link := range links {
+		if len(favicons) >= maxFavicons {
+			break
+		}
+		var favicon *Favicon
+		if strings.HasPrefix(link, "data:") {
+			data, err := decodeDataURI(link)
+			if err != nil {
+				gologger.Debug().Msgf("Could not decode icon of %s: %s\n", pageURL, err)
+				continue
+			}
+			// the data is identified by its hash
+			favicon = newFavicon(link[:strings.Index(link, ",")], data)
+		} else {
+			if !r.urlInScope(link) {
+				continue
+			}
+			favicon = r.icon(ctx, hp, link)
+		}
+		if favicon != nil {
+			favicons = append(favicons, *favicon)
+		}
+	}
+	return favicons
+}
+
+// icon returns the hash of the icon at link. Each icon is fetched once, the concurrent
+// requests to it wait for the result.
+func (r *Runner) icon(ctx context.Context, hp *httpx.HTTPX, link string) *Favicon {
+	r.icons.mu.Lock()
+	if value, err := r.icons.entries.Get(link); err == nil {
+		r.icons.mu.Unlock()
+		entry := value.(*iconEntry)
+		select {
+		case <-entry.done:
+			return entry.favicon
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	entry := &iconEntry{done: make(chan struct{})}
+	_ = r.icons.entries.Set(link, entry)
+	r.icons.mu.Unlock()
+	defer close(entry.done)
+
+	iconResp, err := r.fetchResource(ctx, hp, link)
+	if err != nil {
+		gologger.Debug().Msgf("Could not fetch icon %s: %s\n", link, err)
+		// the failures caused by the scan being stopped aren't cached
+		if ctx.Err() != nil {
+			r.icons.mu.Lock()
+			r.icons.entries.Remove(link)
+			r.icons.mu.Unlock()
+		}
+		return nil
+	}
+	// pages served for any path aren't icons
+	if iconResp.StatusCode != http.StatusOK || strings.Contains(iconResp.GetHeaderPart("Content-Type", ";"), "html") {
+		return nil
+	}
+	entry.favicon = newFavicon(link, iconResp.Data)
+	return entry.favicon
+}
+
+// set caches the hash of an icon obtained without fetching it
+func (c *iconCache) set(link string, favicon *Favicon) {
+	entry := &iconEntry{done: make(chan struct{}), favicon: favicon}
+	close(entry.done)
+	c.mu.Lock()
+	_ = c.entries.Set(link, entry)
+	c.mu.Unlock()
+}
+
+// isIcon tells if the response is an image with a body, such as a probe of /favicon.ico
+func isIcon(resp *httpx.Response) bool {
+	return resp.StatusCode == http.StatusOK && len(resp.Data) > 0 && strings.HasPrefix(strings.ToLower(resp.GetHeaderPart("Content-Type", ";")), "image/")
+}
+
+// newFavicon hashes the data of an icon, it returns nil if there is none
+func newFavicon(link string, data []byte) *Favicon {
+	if len(data) == 0 {
+		return nil
+	}
+	return &Favicon{
+		URL:  link,
+		MMH3: fmt.Sprintf("%d", stringz.FaviconHash(data)),
+		MD5:  hashes.Md5(data),
+	}
+}
+
+// faviconLinks returns the urls of the <link rel="icon"> tags of an html page, including the
+// shortcut and apple touch icons, in document order
+func faviconLinks(base *url.URL, resp *httpx.Response) []string {
+	if !strings.Contains(strings.ToLower(resp.GetHeaderPart("Content-Type", ";")), "html") {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(resp.Data))
+	if err != nil {
+		return nil
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+	var links []string
+	seen := make(map[string]struct{})
+	doc.Find("link[rel][href]").Each(func(_ int, s *goquery.Selection) {
+		rel, _ := s.Attr("rel")
+		isIcon := false
+		for _, token := range strings.Fields(strings.ToLower(rel)) {
+			if strings.HasSuffix(token, "icon") || strings.HasPrefix(token, "apple-touch-icon") {
+				isIcon = true
+			}
+		}
+		if !isIcon {
+			return
+		}
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if !strings.HasPrefix(href, "data:") {
+			u, err := base.Parse(href)
+			if err != nil || (u.Scheme != httpx.HTTP && u.Scheme != httpx.HTTPS) {
+				return
+			}
+			href = u.String()
+		}
+		if _, ok := seen[href]; ok {
+			return
+		}
+		seen[href] = struct{}{}
+		links = append(links, href)
+	})
+	return links
+}
+
+// decodeDataURI returns the data of a data:[<mediatype>][;base64],<data> uri
+func decodeDataURI(uri string) ([]byte, error) {
+	comma := strings.Index(uri, ",")
+	if comma < 0 {
+		return nil, errors.New("missing data")
+	}
+	meta, data := uri[len("data:"):comma], uri[comma+1:]
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		data = strings.Join(strings.Fields(data), "")
+		if decoded, err := base64.StdEncoding.DecodeString(data); err == nil {
+			return decoded, nil
+		}
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+	decoded, err := url.PathUnescape(data)
+	return []byte(decoded), err
+}
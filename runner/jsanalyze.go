@@ -0,0 +1,50 @@
+package runner
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/sviivyao/httpx/common/httpx"
+	"github.com/sviivyao/httpx/common/jsanalyze"
+)
+
+// maxJSFiles is the maximum number of scripts fetched per page
+const maxJSFiles = 20
+
+// analyzeScripts fetches the scripts included by the page and returns their urls along with what was found
+// in them. A response which is a script itself is analyzed as is.
+func (r *Runner) analyzeScripts(ctx context.Context, hp *httpx.HTTPX, pageURL string, resp *httpx.Response) ([]string, jsanalyze.Findings) {
+	var findings jsanalyze.Findings
+	contentType := strings.ToLower(resp.GetHeaderPart("Content-Type", ";"))
+	if strings.Contains(contentType, "javascript") || strings.Contains(contentType, "ecmascript") {
+		findings.Analyze(pageURL, resp.Headers, resp.Data)
+		return nil, findings
+	}
+	if !strings.Contains(contentType, "html") {
+		return nil, findings
+	}
+
+	var files []string
+	for _, src := range jsanalyze.ScriptSources(pageURL, resp.Data) {
+		if len(files) >= maxJSFiles {
+			gologger.Debug().Msgf("Skipping the scripts of %s after the first %d\n", pageURL, maxJSFiles)
+			break
+		}
+		if !r.urlInScope(src) {
+			continue
+		}
+		files = append(files, src)
+		scriptResp, err := r.fetchResource(ctx, hp, src)
+		if err != nil {
+			gologger.Debug().Msgf("Could not fetch script %s: %s\n", src, err)
+			continue
+		}
+		if scriptResp.StatusCode != http.StatusOK {
+			continue
+		}
+		findings.Analyze(src, scriptResp.Headers, scriptResp.Data)
+	}
+	return files, findings
+}
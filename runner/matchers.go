@@ -0,0 +1,249 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/sviivyao/httpx/common/dsl"
+	"github.com/sviivyao/httpx/common/stringz"
+)
+
+// compileConditions converts the legacy matchers and filters to dsl expressions and
+// compiles them together with the user supplied conditions
+func (options *Options) compileConditions() error {
+	var matchConditions, filterConditions []string
+
+	intConditions := []struct {
+		value, variable, description string
+		filter                       bool
+	}{
+		{options.OutputMatchStatusCode, "status_code", "match status code", false},
+		{options.OutputMatchContentLength, "content_length", "match content length", false},
+		{options.OutputMatchLinesCount, "lines", "match lines count", false},
+		{options.OutputMatchWordsCount, "words", "match words count", false},
+		{options.OutputFilterStatusCode, "status_code", "filter status code", true},
+		{options.OutputFilterContentLength, "content_length", "filter content length", true},
+		{options.OutputFilterLinesCount, "lines", "filter lines count", true},
+		{options.OutputFilterWordsCount, "words", "filter words count", true},
+	}
+	for _, intCondition := range intConditions {
+		values, err := stringz.StringToSliceInt(intCondition.value)
+		if err != nil {
+			return fmt.Errorf("Invalid value for %s option: %s", intCondition.description, err)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		condition := inCondition(intCondition.variable, intsToStrings(values))
+		if intCondition.filter {
+			filterConditions = append(filterConditions, condition)
+		} else {
+			matchConditions = append(matchConditions, condition)
+		}
+	}
+
+	if options.OutputMatchRegex != "" {
+		if _, err := regexp.Compile(options.OutputMatchRegex); err != nil {
+			return fmt.Errorf("Invalid value for match regex option: %s", err)
+		}
+		matchConditions = append(matchConditions, fmt.Sprintf("regex(%s, raw)", strconv.Quote(options.OutputMatchRegex)))
+	}
+	if options.OutputFilterRegex != "" {
+		if _, err := regexp.Compile(options.OutputFilterRegex); err != nil {
+			return fmt.Errorf("Invalid value for regex filter option: %s", err)
+		}
+		filterConditions = append(filterConditions, fmt.Sprintf("regex(%s, raw)", strconv.Quote(options.OutputFilterRegex)))
+	}
+	if options.OutputMatchString != "" {
+		matchConditions = append(matchConditions, fmt.Sprintf("icontains(raw, %s)", strconv.Quote(options.OutputMatchString)))
+	}
+	if options.OutputFilterString != "" {
+		filterConditions = append(filterConditions, fmt.Sprintf("icontains(raw, %s)", strconv.Quote(options.OutputFilterString)))
+	}
+	if len(options.OutputMatchFavicon) > 0 {
+		matchConditions = append(matchConditions, containsAnyCondition("favicon_hashes", quoteLower(options.OutputMatchFavicon)))
+	}
+	if len(options.OutputFilterFavicon) > 0 {
+		filterConditions = append(filterConditions, containsAnyCondition("favicon_hashes", quoteLower(options.OutputFilterFavicon)))
+	}
+
+	if options.OutputMatchCertExpiring > 0 {
+		matchConditions = append(matchConditions, fmt.Sprintf("cert_days_to_expiry <= %d", options.OutputMatchCertExpiring))
+	}
+
+	if options.OutputMatchCondition != "" {
+		matchConditions = append(matchConditions, options.OutputMatchCondition)
+	}
+	if options.OutputFilterCondition != "" {
+		filterConditions = append(filterConditions, options.OutputFilterCondition)
+	}
+
+	var err error
+	if options.matchCondition, err = compileCondition(matchConditions, "&&"); err != nil {
+		return fmt.Errorf("Invalid value for match condition option: %s", err)
+	}
+	if options.filterCondition, err = compileCondition(filterConditions, "||"); err != nil {
+		return fmt.Errorf("Invalid value for filter condition option: %s", err)
+	}
+	// only the variables referenced by the conditions are built for each result
+	options.conditionVariables = make(map[string]struct{})
+	for _, compiled := range []*dsl.Expression{options.matchCondition, options.filterCondition} {
+		if compiled == nil {
+			continue
+		}
+		for _, variable := range compiled.Variables() {
+			options.conditionVariables[variable] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// compileCondition joins the conditions with the given logical operator and compiles the result
+func compileCondition(conditions []string, operator string) (*dsl.Expression, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	expression := "(" + strings.Join(conditions, ") "+operator+" (") + ")"
+	compiled, err := dsl.Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	knownVariables := resultVariableNames()
+	for _, variable := range compiled.Variables() {
+		if _, ok := knownVariables[variable]; !ok {
+			return nil, fmt.Errorf("unknown variable %q", variable)
+		}
+	}
+	gologger.Debug().Msgf("Using condition: %s\n", expression)
+	return compiled, nil
+}
+
+func inCondition(variable string, values []string) string {
+	return fmt.Sprintf("in(%s, %s)", variable, strings.Join(values, ", "))
+}
+
+// containsAnyCondition matches the lists holding any of the values
+func containsAnyCondition(variable string, values []string) string {
+	var conditions []string
+	for _, value := range values {
+		conditions = append(conditions, fmt.Sprintf("contains(%s, %s)", variable, value))
+	}
+	return strings.Join(conditions, " || ")
+}
+
+func intsToStrings(values []int) []string {
+	var result []string
+	for _, value := range values {
+		result = append(result, strconv.Itoa(value))
+	}
+	return result
+}
+
+func quoteLower(values []string) []string {
+	var result []string
+	for _, value := range values {
+		result = append(result, strconv.Quote(strings.ToLower(value)))
+	}
+	return result
+}
+
+// dslVariableName converts a json tag to the variable name used within conditions
+func dslVariableName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	if tag == "" || tag == "-" {
+		return ""
+	}
+	return strings.ReplaceAll(tag, "-", "_")
+}
+
+// resultVariableNames returns the variables exposed by a result to the conditions
+func resultVariableNames() map[string]struct{} {
+	names := map[string]struct{}{"raw": {}, "favicon_hashes": {}}
+	ty := reflect.TypeOf(Result{})
+	for i := 0; i < ty.NumField(); i++ {
+		if name := dslVariableName(ty.Field(i)); name != "" {
+			names[name] = struct{}{}
+		}
+	}
+	return names
+}
+
+// dslVariables exposes the result fields named to the conditions. Zero values are kept
+// so that legacy matchers like -ml 0 keep working
+func (r Result) dslVariables(names map[string]struct{}) map[string]interface{} {
+	vars := make(map[string]interface{}, len(names))
+	if _, ok := names["raw"]; ok {
+		vars["raw"] = r.Raw
+	}
+	// the lowercased mmh3 hashes of all the icons, favicon_mmh3 being the one of the first icon
+	if _, ok := names["favicon_hashes"]; ok {
+		hashes := make([]string, 0, len(r.Favicons))
+		for _, favicon := range r.Favicons {
+			hashes = append(hashes, strings.ToLower(favicon.MMH3))
+		}
+		vars["favicon_hashes"] = hashes
+	}
+	elem := reflect.ValueOf(r)
+	for i := 0; i < elem.NumField(); i++ {
+		name := dslVariableName(elem.Type().Field(i))
+		if _, ok := names[name]; name == "" || !ok {
+			continue
+		}
+		vars[name] = dslValue(elem.Field(i).Interface())
+	}
+	return vars
+}
+
+// dslValue converts nested structures to generic maps by using their json representation
+func dslValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, []string, []int, map[string]string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	reflected := reflect.ValueOf(value)
+	if (reflected.Kind() == reflect.Ptr || reflected.Kind() == reflect.Interface || reflected.Kind() == reflect.Slice || reflected.Kind() == reflect.Map) && reflected.IsNil() {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+	return generic
+}
+
+// matchConditions returns true if the result passes both the match and the filter conditions
+func (r *Runner) matchConditions(resp Result) bool {
+	if r.options.matchCondition == nil && r.options.filterCondition == nil {
+		return true
+	}
+	vars := resp.dslVariables(r.options.conditionVariables)
+	if r.options.filterCondition != nil {
+		filtered, err := r.options.filterCondition.Match(vars)
+		if err != nil {
+			gologger.Debug().Msgf("Could not evaluate filter condition on '%s': %s\n", resp.URL, err)
+		}
+		if filtered {
+			return false
+		}
+	}
+	if r.options.matchCondition != nil {
+		matched, err := r.options.matchCondition.Match(vars)
+		if err != nil {
+			gologger.Debug().Msgf("Could not evaluate match condition on '%s': %s\n", resp.URL, err)
+		}
+		return matched
+	}
+	return true
+}
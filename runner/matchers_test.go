@@ -0,0 +1,178 @@
+package runner
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/sviivyao/httpx/common/dsl"
+	"github.com/sviivyao/httpx/common/httpx"
+)
+
+func TestCompileConditions(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         Options
+		matchCondition  string
+		filterCondition string
+	}{
+		{
+			name:    "no conditions",
+			options: Options{},
+		},
+		{
+			name: "match flags are joined with and",
+			options: Options{
+				OutputMatchStatusCode:    "200,302",
+				OutputMatchContentLength: "0",
+				OutputMatchString:        "admin",
+				OutputMatchCondition:     `contains(title, "Login")`,
+			},
+			matchCondition: `(in(status_code, 200, 302)) && (in(content_length, 0)) && (icontains(raw, "admin")) && (contains(title, "Login"))`,
+		},
+		{
+			name: "filter flags are joined with or",
+			options: Options{
+				OutputFilterStatusCode: "404",
+				OutputFilterWordsCount: "1,2",
+				OutputFilterRegex:      "not found",
+				OutputFilterCondition:  "cdn",
+			},
+			filterCondition: `(in(status_code, 404)) || (in(words, 1, 2)) || (regex("not found", raw)) || (cdn)`,
+		},
+		{
+			name: "match and filter together",
+			options: Options{
+				OutputMatchLinesCount: "10",
+				OutputMatchFavicon:    []string{"-1A2b", "42"},
+				OutputFilterString:    "forbidden",
+			},
+			matchCondition:  `(in(lines, 10)) && (contains(favicon_hashes, "-1a2b") || contains(favicon_hashes, "42"))`,
+			filterCondition: `(icontains(raw, "forbidden"))`,
+		},
+	}
+	for _, test := range tests {
+		options := test.options
+		if err := options.compileConditions(); err != nil {
+			t.Errorf("%s: compileConditions returned error: %s", test.name, err)
+			continue
+		}
+		if got := conditionString(options.matchCondition); got != test.matchCondition {
+			t.Errorf("%s: match condition = %q, want %q", test.name, got, test.matchCondition)
+		}
+		if got := conditionString(options.filterCondition); got != test.filterCondition {
+			t.Errorf("%s: filter condition = %q, want %q", test.name, got, test.filterCondition)
+		}
+	}
+}
+
+func TestCompileConditionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"invalid status code", Options{OutputMatchStatusCode: "abc"}},
+		{"invalid regex", Options{OutputMatchRegex: "["}},
+		{"invalid expression", Options{OutputMatchCondition: "status_code =="}},
+		{"unknown variable", Options{OutputFilterCondition: "status == 200"}},
+	}
+	for _, test := range tests {
+		options := test.options
+		if err := options.compileConditions(); err == nil {
+			t.Errorf("%s: compileConditions succeeded, want error", test.name)
+		}
+	}
+}
+
+func TestMatchConditions(t *testing.T) {
+	options := &Options{
+		OutputMatchStatusCode: "200",
+		OutputMatchString:     "welcome",
+		OutputFilterCondition: `chain[0]["status_code"] == 301 || contains(technologies, "nginx")`,
+	}
+	if err := options.compileConditions(); err != nil {
+		t.Fatalf("compileConditions returned error: %s", err)
+	}
+	r := &Runner{options: options}
+
+	tests := []struct {
+		name   string
+		result Result
+		want   bool
+	}{
+		{"matching", Result{StatusCode: 200, Raw: "Welcome home"}, true},
+		{"wrong status code", Result{StatusCode: 404, Raw: "welcome"}, false},
+		{"missing string", Result{StatusCode: 200, Raw: "hello"}, false},
+		{"filtered by chain", Result{StatusCode: 200, Raw: "welcome", Chain: []httpx.ChainItem{{StatusCode: 301}}}, false},
+		{"filtered by technology", Result{StatusCode: 200, Raw: "welcome", Technologies: []string{"nginx"}}, false},
+	}
+	for _, test := range tests {
+		if got := r.matchConditions(test.result); got != test.want {
+			t.Errorf("%s: matchConditions = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMatchFavicons(t *testing.T) {
+	options := &Options{OutputMatchFavicon: []string{"116323821"}, OutputFilterFavicon: []string{"-235701012"}}
+	if err := options.compileConditions(); err != nil {
+		t.Fatalf("compileConditions returned error: %s", err)
+	}
+	r := &Runner{options: options}
+
+	tests := []struct {
+		name     string
+		favicons []string
+		want     bool
+	}{
+		{"first icon", []string{"116323821", "1"}, true},
+		{"other icon", []string{"1", "116323821"}, true},
+		{"no matching icon", []string{"1", "2"}, false},
+		{"no icon", nil, false},
+		{"filtered other icon", []string{"116323821", "-235701012"}, false},
+	}
+	for _, test := range tests {
+		result := Result{}
+		for _, hash := range test.favicons {
+			result.Favicons = append(result.Favicons, Favicon{MMH3: hash})
+		}
+		if len(result.Favicons) > 0 {
+			result.FavIconMMH3 = result.Favicons[0].MMH3
+		}
+		if got := r.matchConditions(result); got != test.want {
+			t.Errorf("%s: matchConditions = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDSLVariablesReferenced(t *testing.T) {
+	result := Result{
+		StatusCode:   200,
+		Title:        "Home",
+		Raw:          "raw response",
+		Technologies: []string{"nginx"},
+		Chain:        []httpx.ChainItem{{StatusCode: 301}},
+	}
+	vars := result.dslVariables(map[string]struct{}{"status_code": {}, "chain": {}, "raw": {}})
+	var names []string
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"chain", "raw", "status_code"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("dslVariables built %v, want %v", names, want)
+	}
+	if vars["status_code"] != 200 || vars["raw"] != "raw response" {
+		t.Errorf("unexpected values %v", vars)
+	}
+	if len(result.dslVariables(nil)) != 0 {
+		t.Errorf("dslVariables built variables that were not referenced")
+	}
+}
+
+func conditionString(condition *dsl.Expression) string {
+	if condition == nil {
+		return ""
+	}
+	return condition.String()
+}
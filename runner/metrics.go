@@ -0,0 +1,145 @@
+package runner
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/sviivyao/httpx/common/httpx"
+	"github.com/sviivyao/httpx/common/metrics"
+)
+
+// scanMetrics are the metrics of the scan exposed in the OpenMetrics format.
+// All the methods are no-op on a nil receiver, when the metrics are disabled.
+type scanMetrics struct {
+	addr     string
+	registry *metrics.Registry
+	mu       sync.Mutex
+	server   *http.Server
+
+	requests      *metrics.Counter
+	errors        *metrics.Counter
+	latency       *metrics.Histogram
+	rateLimitWait *metrics.Histogram
+	queueDepth    *metrics.Gauge
+	fallbacks     *metrics.Counter
+	hostsTotal    *metrics.Gauge
+	hosts         *metrics.Counter
+}
+
+// newScanMetrics creates the metrics, exposed at http://addr/metrics once served
+func newScanMetrics(addr string) *scanMetrics {
+	registry := metrics.NewRegistry()
+	return &scanMetrics{
+		addr:          addr,
+		registry:      registry,
+		requests:      registry.NewCounter("httpx_requests", "Responses received by status class.", "status_class"),
+		errors:        registry.NewCounter("httpx_errors", "Failed requests by error type.", "type"),
+		latency:       registry.NewHistogram("httpx_request_duration_seconds", "Duration of the requests by protocol.", nil, "protocol"),
+		rateLimitWait: registry.NewHistogram("httpx_ratelimit_wait_seconds", "Time spent waiting for the global and per host rate limiters.", nil),
+		queueDepth:    registry.NewGauge("httpx_queue_depth", "Probes scheduled whose result has not been written yet."),
+		fallbacks:     registry.NewCounter("httpx_fallbacks", "Probes retried with the other protocol after a failure.", "from", "to"),
+		hostsTotal:    registry.NewGauge("httpx_hosts", "Input targets to process."),
+		hosts:         registry.NewCounter("httpx_hosts_processed", "Input targets processed."),
+	}
+}
+
+// serve starts serving the metrics until Close is called, it does nothing if they are already served
+func (m *scanMetrics) serve() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.server != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.registry)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			gologger.Warning().Msgf("Could not serve metrics: %s\n", err)
+		}
+	}()
+	m.server = server
+	return nil
+}
+
+// Close stops serving the metrics
+func (m *scanMetrics) Close() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.server == nil {
+		return nil
+	}
+	err := m.server.Close()
+	m.server = nil
+	return err
+}
+
+// request records the outcome of a request
+func (m *scanMetrics) request(protocol string, resp *httpx.Response, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.latency.Observe(duration.Seconds(), protocol)
+	if err != nil {
+		if errType := errorType(err); errType != "" {
+			m.errors.Inc(errType)
+		}
+		return
+	}
+	m.requests.Inc(fmt.Sprintf("%dxx", resp.StatusCode/100))
+}
+
+// rateLimited records the time spent waiting for the rate limiters
+func (m *scanMetrics) rateLimited(wait time.Duration) {
+	if m == nil {
+		return
+	}
+	m.rateLimitWait.Observe(wait.Seconds())
+}
+
+// queued adds delta probes to the queue
+func (m *scanMetrics) queued(delta int) {
+	if m == nil {
+		return
+	}
+	m.queueDepth.Add(float64(delta))
+}
+
+// fallback records a probe retried with the protocol to after failing with from
+func (m *scanMetrics) fallback(from, to string) {
+	if m == nil {
+		return
+	}
+	m.fallbacks.Inc(from, to)
+}
+
+// setHosts sets the number of input targets
+func (m *scanMetrics) setHosts(total int) {
+	if m == nil {
+		return
+	}
+	m.hostsTotal.Set(float64(total))
+}
+
+// hostProcessed records an input target processed
+func (m *scanMetrics) hostProcessed() {
+	if m == nil {
+		return
+	}
+	m.hosts.Inc()
+}
@@ -1,13 +1,14 @@
 package runner
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"os"
 	"regexp"
 	"strings"
 
 	"github.com/projectdiscovery/fileutil"
-	"github.com/projectdiscovery/goconfig"
 	"github.com/projectdiscovery/goflags"
 	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/gologger/formatter"
@@ -15,9 +16,12 @@ import (
 	"github.com/sviivyao/httpx/common/customheader"
 	"github.com/sviivyao/httpx/common/customlist"
 	customport "github.com/sviivyao/httpx/common/customports"
+	"github.com/sviivyao/httpx/common/dsl"
+	"github.com/sviivyao/httpx/common/extractor"
 	fileutilz "github.com/sviivyao/httpx/common/fileutil"
+	"github.com/sviivyao/httpx/common/httpx"
+	"github.com/sviivyao/httpx/common/portscan"
 	"github.com/sviivyao/httpx/common/slice"
-	"github.com/sviivyao/httpx/common/stringz"
 )
 
 const (
@@ -26,58 +30,70 @@ const (
 	two                    = 2
 	DefaultResumeFile      = "resume.cfg"
 	DefaultOutputDirectory = "output"
+	// StoreFormatText stores each response in its own text file
+	StoreFormatText = "txt"
+	// StoreFormatWARC stores the responses in WARC archives
+	StoreFormatWARC = "warc"
+	// StoreFormatCAS stores the response bodies deduplicated by hash with an index
+	StoreFormatCAS = "cas"
 )
 
+// scanOptions are the options of the probes, the json keys are the ones accepted by the jobs of httpx serve
 type scanOptions struct {
-	Methods                   []string
-	StoreResponseDirectory    string
-	RequestURI                string
-	RequestBody               string
-	VHost                     bool
-	OutputTitle               bool
-	OutputStatusCode          bool
-	OutputLocation            bool
-	OutputContentLength       bool
-	StoreResponse             bool
-	OutputServerHeader        bool
-	OutputWebSocket           bool
-	OutputWithNoColor         bool
-	OutputMethod              bool
-	ResponseInStdout          bool
-	ChainInStdout             bool
-	TLSProbe                  bool
-	CSPProbe                  bool
-	VHostInput                bool
-	OutputContentType         bool
-	Unsafe                    bool
-	Pipeline                  bool
-	HTTP2Probe                bool
-	OutputIP                  bool
-	OutputCName               bool
-	OutputCDN                 bool
-	OutputResponseTime        bool
-	PreferHTTPS               bool
-	NoFallback                bool
-	NoFallbackScheme          bool
-	TechDetect                bool
-	StoreChain                bool
-	MaxResponseBodySizeToSave int
-	MaxResponseBodySizeToRead int
-	OutputExtractRegex        string
+	Methods                   []string `json:"methods"`
+	StoreResponseDirectory    string   `json:"-"`
+	RequestURI                string   `json:"path"`
+	RequestBody               string   `json:"body"`
+	VHost                     bool     `json:"vhost"`
+	OutputTitle               bool     `json:"title"`
+	OutputStatusCode          bool     `json:"status-code"`
+	OutputLocation            bool     `json:"location"`
+	OutputContentLength       bool     `json:"content-length"`
+	StoreResponse             bool     `json:"-"`
+	OutputServerHeader        bool     `json:"web-server"`
+	OutputWebSocket           bool     `json:"websocket"`
+	OutputWithNoColor         bool     `json:"-"`
+	OutputMethod              bool     `json:"method"`
+	ResponseInStdout          bool     `json:"include-response"`
+	ChainInStdout             bool     `json:"include-chain"`
+	TLSProbe                  bool     `json:"-"`
+	CSPProbe                  bool     `json:"-"`
+	VHostInput                bool     `json:"-"`
+	OutputContentType         bool     `json:"content-type"`
+	Unsafe                    bool     `json:"-"`
+	Pipeline                  bool     `json:"pipeline"`
+	HTTP2Probe                bool     `json:"http2"`
+	HTTP3Probe                bool     `json:"http3"`
+	OutputIP                  bool     `json:"ip"`
+	OutputCName               bool     `json:"cname"`
+	OutputCDN                 bool     `json:"cdn"`
+	OutputResponseTime        bool     `json:"response-time"`
+	PreferHTTPS               bool     `json:"-"`
+	NoFallback                bool     `json:"no-fallback"`
+	NoFallbackScheme          bool     `json:"no-fallback-scheme"`
+	TechDetect                bool     `json:"tech-detect"`
+	StoreChain                bool     `json:"-"`
+	MaxResponseBodySizeToSave int      `json:"response-size-to-save"`
+	MaxResponseBodySizeToRead int      `json:"-"`
+	OutputExtractRegex        string   `json:"extract-regex"`
 	extractRegex              *regexp.Regexp
-	ExcludeCDN                bool
-	HostMaxErrors             int
-	ProbeAllIPS               bool
-	Favicon                   bool
-	LeaveDefaultPorts         bool
-	OutputLinesCount          bool
-	OutputWordsCount          bool
-	Hashes                    string
+	Extractors                []string `json:"extract"`
+	extractors                []*extractor.Extractor
+	ExcludeCDN                bool   `json:"exclude-cdn"`
+	HostMaxErrors             int    `json:"-"`
+	ProbeAllIPS               bool   `json:"probe-all-ips"`
+	Favicon                   bool   `json:"favicon"`
+	LeaveDefaultPorts         bool   `json:"leave-default-ports"`
+	OutputLinesCount          bool   `json:"line-count"`
+	OutputWordsCount          bool   `json:"word-count"`
+	Hashes                    string `json:"hash"`
+	JSAnalyze                 bool   `json:"js-analyze"`
 }
 
 func (s *scanOptions) Clone() *scanOptions {
+	// the slices are copied as the jobs of httpx serve decode their config into the clone
 	return &scanOptions{
-		Methods:                   s.Methods,
+		Methods:                   append([]string(nil), s.Methods...),
 		StoreResponseDirectory:    s.StoreResponseDirectory,
 		RequestURI:                s.RequestURI,
 		RequestBody:               s.RequestBody,
@@ -95,10 +111,12 @@ func (s *scanOptions) Clone() *scanOptions {
 		ChainInStdout:             s.ChainInStdout,
 		TLSProbe:                  s.TLSProbe,
 		CSPProbe:                  s.CSPProbe,
+		VHostInput:                s.VHostInput,
 		OutputContentType:         s.OutputContentType,
 		Unsafe:                    s.Unsafe,
 		Pipeline:                  s.Pipeline,
 		HTTP2Probe:                s.HTTP2Probe,
+		HTTP3Probe:                s.HTTP3Probe,
 		OutputIP:                  s.OutputIP,
 		OutputCName:               s.OutputCName,
 		OutputCDN:                 s.OutputCDN,
@@ -109,29 +127,51 @@ func (s *scanOptions) Clone() *scanOptions {
 		TechDetect:                s.TechDetect,
 		StoreChain:                s.StoreChain,
 		OutputExtractRegex:        s.OutputExtractRegex,
+		extractRegex:              s.extractRegex,
 		MaxResponseBodySizeToSave: s.MaxResponseBodySizeToSave,
 		MaxResponseBodySizeToRead: s.MaxResponseBodySizeToRead,
 		HostMaxErrors:             s.HostMaxErrors,
+		ExcludeCDN:                s.ExcludeCDN,
+		ProbeAllIPS:               s.ProbeAllIPS,
 		Favicon:                   s.Favicon,
 		LeaveDefaultPorts:         s.LeaveDefaultPorts,
 		OutputLinesCount:          s.OutputLinesCount,
 		OutputWordsCount:          s.OutputWordsCount,
 		Hashes:                    s.Hashes,
+		JSAnalyze:                 s.JSAnalyze,
+		Extractors:                append([]string(nil), s.Extractors...),
+		extractors:                append([]*extractor.Extractor(nil), s.extractors...),
+	}
+}
+
+// parseExtractors parses the name:type:expr extractors
+func parseExtractors(values []string) ([]*extractor.Extractor, error) {
+	var extractors []*extractor.Extractor
+	for _, value := range values {
+		e, err := extractor.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		extractors = append(extractors, e)
 	}
+	return extractors, nil
 }
 
 // Options contains configuration options for httpx.
 type Options struct {
 	CustomHeaders             customheader.CustomHeaders
 	CustomPorts               customport.CustomPorts
-	matchStatusCode           []int
-	matchContentLength        []int
-	filterStatusCode          []int
-	filterContentLength       []int
 	Output                    string
 	StoreResponseDir          string
+	StoreFormat               string
+	StoreMaxSize              int
+	HAR                       string
+	Diff                      string
+	DiffThreshold             int
 	HTTPProxy                 string
 	SocksProxy                string
+	ProxyList                 string
+	ProxyRotation             string
 	InputFile                 string
 	Methods                   string
 	RequestURI                string
@@ -142,6 +182,8 @@ type Options struct {
 	OutputFilterStatusCode    string
 	OutputFilterContentLength string
 	InputRawRequest           string
+	InputFormat               string
+	InputAllServices          bool
 	rawRequest                string
 	RequestBody               string
 	OutputFilterString        string
@@ -151,8 +193,6 @@ type Options struct {
 	Retries                   int
 	Threads                   int
 	Timeout                   int
-	filterRegex               *regexp.Regexp
-	matchRegex                *regexp.Regexp
 	VHost                     bool
 	VHostInput                bool
 	Smuggling                 bool
@@ -186,15 +226,28 @@ type Options struct {
 	DebugResponse             bool
 	Pipeline                  bool
 	HTTP2Probe                bool
+	HTTP3Probe                bool
 	OutputCDN                 bool
 	OutputResponseTime        bool
 	NoFallback                bool
 	NoFallbackScheme          bool
 	TechDetect                bool
+	JSAnalyze                 bool
 	TLSGrab                   bool
+	TLSProfile                bool
+	CertValidate              bool
+	CABundle                  string
 	protocol                  string
 	ShowStatistics            bool
 	StatsInterval             int
+	MetricsAddr               string
+	Listen                    string
+	Shard                     string
+	shardIndex                int
+	shardCount                int
+	Coordinator               string
+	Worker                    string
+	Scope                     string
 	RandomAgent               bool
 	StoreChain                bool
 	Deny                      customlist.CustomList
@@ -202,11 +255,17 @@ type Options struct {
 	MaxResponseBodySizeToSave int
 	MaxResponseBodySizeToRead int
 	OutputExtractRegex        string
+	Extractors                goflags.StringSlice
 	RateLimit                 int
 	RateLimitMinute           int
+	RateLimitHost             int
+	RateLimitIP               bool
+	MaxHostConns              int
+	ThrottleRetries           int
+	MaxBackoff                int
 	Probe                     bool
 	Resume                    bool
-	resumeCfg                 *ResumeCfg
+	ResumeFile                string
 	ExcludeCDN                bool
 	HostMaxErrors             int
 	Stream                    bool
@@ -219,18 +278,50 @@ type Options struct {
 	LeaveDefaultPorts         bool
 	OutputLinesCount          bool
 	OutputMatchLinesCount     string
-	matchLinesCount           []int
 	OutputFilterLinesCount    string
-	filterLinesCount          []int
 	OutputWordsCount          bool
 	OutputMatchWordsCount     string
-	matchWordsCount           []int
 	OutputFilterWordsCount    string
-	filterWordsCount          []int
+	OutputMatchCertExpiring   int
+	OutputMatchCondition      string
+	matchCondition            *dsl.Expression
+	OutputFilterCondition     string
+	filterCondition           *dsl.Expression
+	conditionVariables        map[string]struct{}
 	Hashes                    string
 	Jarm                      bool
 	Asn                       bool
 	Domainsfinder             bool
+	DiscoveryWordlist         string
+	Crawl                     bool
+	CrawlDepth                int
+	CrawlMaxPages             int
+	// InputTargets contains the targets to process when httpx is used as a library
+	InputTargets []string
+	// InputTargetsChan streams targets to process when httpx is used as a library (implies stream mode)
+	InputTargetsChan <-chan string
+	// OnResult is invoked for each result passing matchers and filters, in place of the stdout output
+	OnResult func(Result)
+}
+
+// DefaultOptions contains the default values used by the command line
+var DefaultOptions = Options{
+	Threads:                   50,
+	RateLimit:                 150,
+	Timeout:                   5,
+	MaxRedirects:              10,
+	HostMaxErrors:             30,
+	ThrottleRetries:           3,
+	MaxBackoff:                60,
+	ProxyRotation:             httpx.ProxyRoundRobin,
+	StoreFormat:               StoreFormatText,
+	StoreMaxSize:              1024,
+	DiffThreshold:             3,
+	CrawlDepth:                3,
+	CrawlMaxPages:             100,
+	RandomAgent:               true,
+	MaxResponseBodySizeToSave: math.MaxInt32,
+	MaxResponseBodySizeToRead: math.MaxInt32,
 }
 
 // ParseOptions parses the command line options for application
@@ -243,6 +334,8 @@ func ParseOptions() *Options {
 	createGroup(flagSet, "input", "Input",
 		flagSet.StringVarP(&options.InputFile, "list", "l", "", "input file containing list of hosts to process"),
 		flagSet.StringVarP(&options.InputRawRequest, "request", "rr", "", "file containing raw request"),
+		flagSet.StringVarP(&options.InputFormat, "input-format", "if", "", "format of the input (nmap-xml, masscan-json, naabu-json, jsonl)"),
+		flagSet.BoolVarP(&options.InputAllServices, "input-all-services", "ias", false, "probe the ports identified as non-http services (eg ssh) in the -input-format input"),
 	)
 
 	createGroup(flagSet, "Probes", "Probes",
@@ -250,7 +343,7 @@ func ParseOptions() *Options {
 		flagSet.BoolVarP(&options.ContentLength, "content-length", "cl", false, "display response content-length"),
 		flagSet.BoolVarP(&options.OutputContentType, "content-type", "ct", false, "display response content-type"),
 		flagSet.BoolVar(&options.Location, "location", false, "display response redirect location"),
-		flagSet.BoolVar(&options.Favicon, "favicon", false, "display mmh3 hash for '/favicon.ico' file"),
+		flagSet.BoolVar(&options.Favicon, "favicon", false, "display mmh3 hash of the icons linked from the page or '/favicon.ico'"),
 		flagSet.StringVar(&options.Hashes, "hash", "", "display response body hash (supported: md5,mmh3,simhash,sha1,sha256,sha512)"),
 		flagSet.BoolVar(&options.Jarm, "jarm", false, "display jarm fingerprint hash"),
 		flagSet.BoolVarP(&options.OutputResponseTime, "response-time", "rt", false, "display response time"),
@@ -259,6 +352,7 @@ func ParseOptions() *Options {
 		flagSet.BoolVar(&options.ExtractTitle, "title", false, "display page title"),
 		flagSet.BoolVarP(&options.OutputServerHeader, "web-server", "server", false, "display server name"),
 		flagSet.BoolVarP(&options.TechDetect, "tech-detect", "td", false, "display technology in use based on wappalyzer dataset"),
+		flagSet.BoolVarP(&options.JSAnalyze, "js-analyze", "ja", false, "display api paths, urls, graphql endpoints, source maps and secrets found in the page scripts"),
 		flagSet.BoolVar(&options.OutputMethod, "method", false, "display http request method"),
 		flagSet.BoolVar(&options.OutputWebSocket, "websocket", false, "display server using websocket"),
 		flagSet.BoolVar(&options.OutputIP, "ip", false, "display host ip"),
@@ -268,7 +362,9 @@ func ParseOptions() *Options {
 		flagSet.BoolVar(&options.Probe, "probe", false, "display probe status"),
 	)
 	createGroup(flagSet, "Domainsfinder", "Domainsfinder",
-		flagSet.BoolVar(&options.Domainsfinder, "find domains", false, "Domainsfinder is a subdomain discovery tool"))
+		flagSet.BoolVarP(&options.Domainsfinder, "find-domains", "fd", false, "discover the subdomains of the input domains in the responses and probe them"),
+		flagSet.StringVarP(&options.DiscoveryWordlist, "discovery-wordlist", "dw", "", "wordlist of subdomains to resolve under the input domains (-fd only)"),
+	)
 
 	createGroup(flagSet, "matchers", "Matchers",
 		flagSet.StringVarP(&options.OutputMatchStatusCode, "match-code", "mc", "", "match response with specified status code (-mc 200,302)"),
@@ -278,10 +374,13 @@ func ParseOptions() *Options {
 		flagSet.NormalizedStringSliceVarP(&options.OutputMatchFavicon, "match-favicon", "mfc", []string{}, "match response with specified favicon hash (-mfc 1494302000)"),
 		flagSet.StringVarP(&options.OutputMatchString, "match-string", "ms", "", "match response with specified string (-ms admin)"),
 		flagSet.StringVarP(&options.OutputMatchRegex, "match-regex", "mr", "", "match response with specified regex (-mr admin)"),
+		flagSet.IntVarP(&options.OutputMatchCertExpiring, "match-cert-expiring", "mce", 0, "match response with certificate expiring within specified days (-mce 30)"),
+		flagSet.StringVarP(&options.OutputMatchCondition, "match-condition", "mdc", "", "match response with dsl expression condition (-mdc 'status_code == 200 && !cdn')"),
 	)
 
 	createGroup(flagSet, "extractor", "Extractor",
 		flagSet.StringVarP(&options.OutputExtractRegex, "extract-regex", "er", "", "display response content for specified regex"),
+		flagSet.StringSliceVarP(&options.Extractors, "extract", "ex", nil, "named extractor to display and match on, repeatable (name:type:expr, types: regex, css, xpath, jsonpath, header, cookie)"),
 	)
 
 	createGroup(flagSet, "filters", "Filters",
@@ -292,12 +391,18 @@ func ParseOptions() *Options {
 		flagSet.NormalizedStringSliceVarP(&options.OutputFilterFavicon, "filter-favicon", "ffc", []string{}, "filter response with specified favicon hash (-mfc 1494302000)"),
 		flagSet.StringVarP(&options.OutputFilterString, "filter-string", "fs", "", "filter response with specified string (-fs admin)"),
 		flagSet.StringVarP(&options.OutputFilterRegex, "filter-regex", "fe", "", "filter response with specified regex (-fe admin)"),
+		flagSet.StringVarP(&options.OutputFilterCondition, "filter-condition", "fdc", "", "filter response with dsl expression condition (-fdc 'contains(title, \"Default\")')"),
 	)
 
 	createGroup(flagSet, "rate-limit", "Rate-Limit",
-		flagSet.IntVarP(&options.Threads, "threads", "t", 50, "number of threads to use"),
-		flagSet.IntVarP(&options.RateLimit, "rate-limit", "rl", 150, "maximum requests to send per second"),
+		flagSet.IntVarP(&options.Threads, "threads", "t", DefaultOptions.Threads, "number of threads to use"),
+		flagSet.IntVarP(&options.RateLimit, "rate-limit", "rl", DefaultOptions.RateLimit, "maximum requests to send per second"),
 		flagSet.IntVarP(&options.RateLimitMinute, "rate-limit-minute", "rlm", 0, "maximum number of requests to send per minute"),
+		flagSet.IntVarP(&options.RateLimitHost, "rate-limit-host", "rlh", 0, "maximum requests to send per second to a single host"),
+		flagSet.BoolVarP(&options.RateLimitIP, "rate-limit-ip", "rli", false, "apply the per host limits to the resolved ip instead of the host name"),
+		flagSet.IntVarP(&options.MaxHostConns, "max-host-conns", "mhc", 0, "maximum number of concurrent requests to a single host"),
+		flagSet.IntVarP(&options.ThrottleRetries, "throttle-retries", "thr", DefaultOptions.ThrottleRetries, "number of retries on a throttling host (429/503) before skipping it"),
+		flagSet.IntVarP(&options.MaxBackoff, "max-backoff", "mbo", DefaultOptions.MaxBackoff, "maximum seconds to back off a throttling host"),
 	)
 
 	createGroup(flagSet, "Misc", "Miscellaneous",
@@ -307,33 +412,53 @@ func ParseOptions() *Options {
 		flagSet.BoolVar(&options.TLSProbe, "tls-probe", false, "send http probes on the extracted TLS domains (dns_name)"),
 		flagSet.BoolVar(&options.CSPProbe, "csp-probe", false, "send http probes on the extracted CSP domains"),
 		flagSet.BoolVar(&options.TLSGrab, "tls-grab", false, "perform TLS(SSL) data grabbing"),
+		flagSet.BoolVar(&options.TLSProfile, "tls-profile", false, "enumerate supported TLS versions, ciphers, ALPN, OCSP stapling and SNI requirement"),
+		flagSet.BoolVarP(&options.CertValidate, "cert-validate", "cv", false, "validate the certificate chain and report trust, hostname, expiry and strength issues"),
 		flagSet.BoolVar(&options.Pipeline, "pipeline", false, "probe and display server supporting HTTP1.1 pipeline"),
 		flagSet.BoolVar(&options.HTTP2Probe, "http2", false, "probe and display server supporting HTTP2"),
+		flagSet.BoolVar(&options.HTTP3Probe, "http3", false, "probe and display server supporting HTTP3 (QUIC) advertised with Alt-Svc"),
 		flagSet.BoolVar(&options.VHost, "vhost", false, "probe and display server supporting VHOST"),
+		flagSet.BoolVar(&options.Crawl, "crawl", false, "crawl the same origin pages linked from the responses"),
+		flagSet.IntVarP(&options.CrawlDepth, "crawl-depth", "cd", DefaultOptions.CrawlDepth, "maximum depth of the crawled links (-crawl only)"),
+		flagSet.IntVarP(&options.CrawlMaxPages, "crawl-max-pages", "cmp", DefaultOptions.CrawlMaxPages, "maximum number of pages crawled per origin (-crawl only)"),
 	)
 
 	createGroup(flagSet, "output", "Output",
 		flagSet.StringVarP(&options.Output, "output", "o", "", "file to write output results"),
 		flagSet.BoolVarP(&options.StoreResponse, "store-response", "sr", false, "store http response to output directory"),
 		flagSet.StringVarP(&options.StoreResponseDir, "store-response-dir", "srd", "", "store http response to custom directory"),
+		flagSet.StringVarP(&options.StoreFormat, "store-format", "sf", DefaultOptions.StoreFormat, "format of the stored responses (txt, warc, cas)"),
+		flagSet.IntVarP(&options.StoreMaxSize, "store-max-size", "sms", DefaultOptions.StoreMaxSize, "maximum size in MB of a warc file before rotating it (-sf warc only)"),
 		flagSet.BoolVar(&options.CSVOutput, "csv", false, "store output in csv format"),
 		flagSet.BoolVar(&options.JSONOutput, "json", false, "store output in JSONL(ines) format"),
 		flagSet.BoolVarP(&options.responseInStdout, "include-response", "irr", false, "include http request/response in JSON output (-json only)"),
 		flagSet.BoolVar(&options.chainInStdout, "include-chain", false, "include redirect http chain in JSON output (-json only)"),
 		flagSet.BoolVar(&options.StoreChain, "store-chain", false, "include http redirect chain in responses (-sr only)"),
+		flagSet.StringVar(&options.HAR, "har", "", "file to write the requests and redirect chains in HAR format"),
+		flagSet.StringVar(&options.Diff, "diff", "", "previous JSON output to compare with, only new, changed and removed endpoints are reported (implies -tls-grab)"),
+		flagSet.IntVar(&options.DiffThreshold, "diff-threshold", DefaultOptions.DiffThreshold, "maximum body simhash distance for an endpoint to be considered unchanged (-diff only)"),
 	)
 
 	createGroup(flagSet, "configs", "Configurations",
 		flagSet.NormalizedStringSliceVarP(&options.Resolvers, "resolvers", "r", []string{}, "list of custom resolver (file or comma separated)"),
 		flagSet.Var(&options.Allow, "allow", "allowed list of IP/CIDR's to process (file or comma separated)"),
 		flagSet.Var(&options.Deny, "deny", "denied list of IP/CIDR's to process (file or comma separated)"),
-		flagSet.BoolVar(&options.RandomAgent, "random-agent", true, "Enable Random User-Agent to use"),
+		flagSet.StringVar(&options.Scope, "scope", "", "file with the include and exclude rules of the hosts, urls, cidrs and ports in scope"),
+		flagSet.BoolVar(&options.RandomAgent, "random-agent", DefaultOptions.RandomAgent, "Enable Random User-Agent to use"),
 		flagSet.VarP(&options.CustomHeaders, "header", "H", "custom http headers to send with request"),
-		flagSet.StringVarP(&options.HTTPProxy, "proxy", "http-proxy", "", "http proxy to use (eg http://127.0.0.1:8080)"),
+		flagSet.StringVarP(&options.HTTPProxy, "proxy", "http-proxy", "", "http or socks5 proxy to use (eg http://127.0.0.1:8080, socks5h://127.0.0.1:1080)"),
+		flagSet.StringVar(&options.SocksProxy, "socks-proxy", "", "socks5 proxy to use (eg socks5://127.0.0.1:1080)"),
+		flagSet.StringVarP(&options.ProxyList, "proxy-list", "pl", "", "file containing a list of proxies to rotate (http, https, socks5, socks5h)"),
+		flagSet.StringVarP(&options.ProxyRotation, "proxy-rotation", "pr", DefaultOptions.ProxyRotation, "proxy rotation strategy (round-robin, random)"),
+		flagSet.StringVar(&options.CABundle, "ca-bundle", "", "pem file of CA certificates to validate the certificates against instead of the system roots"),
+		flagSet.StringVar(&options.Listen, "listen", "", "address to listen on with httpx serve (default 127.0.0.1:8080)"),
+		flagSet.StringVar(&options.Shard, "shard", "", "probe only the i-th of n shards of the targets (eg 1/10)"),
+		flagSet.StringVar(&options.Coordinator, "coordinator", "", "address to distribute the targets to the workers from and merge their results (eg :9000)"),
+		flagSet.StringVar(&options.Worker, "worker", "", "url of the coordinator to pull the targets from (eg http://10.0.0.1:9000)"),
 		flagSet.BoolVar(&options.Unsafe, "unsafe", false, "send raw requests skipping golang normalization"),
 		flagSet.BoolVar(&options.Resume, "resume", false, "resume scan using resume.cfg"),
 		flagSet.BoolVarP(&options.FollowRedirects, "follow-redirects", "fr", false, "follow http redirects"),
-		flagSet.IntVarP(&options.MaxRedirects, "max-redirects", "maxr", 10, "max number of redirects to follow per host"),
+		flagSet.IntVarP(&options.MaxRedirects, "max-redirects", "maxr", DefaultOptions.MaxRedirects, "max number of redirects to follow per host"),
 		flagSet.BoolVarP(&options.FollowHostRedirects, "follow-host-redirects", "fhr", false, "follow redirects on the same host"),
 		flagSet.BoolVar(&options.VHostInput, "vhost-input", false, "get a list of vhosts as input"),
 		flagSet.StringVar(&options.Methods, "x", "", "request methods to probe, use 'all' to probe all HTTP methods"),
@@ -352,18 +477,19 @@ func ParseOptions() *Options {
 		flagSet.BoolVar(&options.Silent, "silent", false, "silent mode"),
 		flagSet.BoolVarP(&options.Verbose, "verbose", "v", false, "verbose mode"),
 		flagSet.IntVarP(&options.StatsInterval, "stats-interval", "si", 0, "number of seconds to wait between showing a statistics update (default: 5)"),
+		flagSet.StringVar(&options.MetricsAddr, "metrics-addr", "", "address to expose the scan metrics in OpenMetrics format at /metrics (eg :9090)"),
 		flagSet.BoolVarP(&options.NoColor, "no-color", "nc", false, "disable colors in cli output"),
 	)
 
 	createGroup(flagSet, "Optimizations", "Optimizations",
 		flagSet.BoolVarP(&options.NoFallback, "no-fallback", "nf", false, "display both probed protocol (HTTPS and HTTP)"),
 		flagSet.BoolVarP(&options.NoFallbackScheme, "no-fallback-scheme", "nfs", false, "probe with protocol scheme specified in input "),
-		flagSet.IntVarP(&options.HostMaxErrors, "max-host-error", "maxhr", 30, "max error count per host before skipping remaining path/s"),
+		flagSet.IntVarP(&options.HostMaxErrors, "max-host-error", "maxhr", DefaultOptions.HostMaxErrors, "max error count per host before skipping remaining path/s"),
 		flagSet.BoolVarP(&options.ExcludeCDN, "exclude-cdn", "ec", false, "skip full port scans for CDNs (only checks for 80,443)"),
 		flagSet.IntVar(&options.Retries, "retries", 0, "number of retries"),
-		flagSet.IntVar(&options.Timeout, "timeout", 5, "timeout in seconds"),
-		flagSet.IntVarP(&options.MaxResponseBodySizeToSave, "response-size-to-save", "rsts", math.MaxInt32, "max response size to save in bytes"),
-		flagSet.IntVarP(&options.MaxResponseBodySizeToRead, "response-size-to-read", "rstr", math.MaxInt32, "max response size to read in bytes"),
+		flagSet.IntVar(&options.Timeout, "timeout", DefaultOptions.Timeout, "timeout in seconds"),
+		flagSet.IntVarP(&options.MaxResponseBodySizeToSave, "response-size-to-save", "rsts", DefaultOptions.MaxResponseBodySizeToSave, "max response size to save in bytes"),
+		flagSet.IntVarP(&options.MaxResponseBodySizeToRead, "response-size-to-read", "rstr", DefaultOptions.MaxResponseBodySizeToRead, "max response size to read in bytes"),
 	)
 
 	_ = flagSet.Parse()
@@ -375,10 +501,7 @@ func ParseOptions() *Options {
 	// Read the inputs and configure the logging
 	options.configureOutput()
 
-	err := options.configureResume()
-	if err != nil {
-		gologger.Fatal().Msgf("%s\n", err)
-	}
+	options.ResumeFile = DefaultResumeFile
 
 	showBanner()
 
@@ -387,59 +510,43 @@ func ParseOptions() *Options {
 		os.Exit(0)
 	}
 
-	options.validateOptions()
-
 	return options
 }
 
-func (options *Options) validateOptions() {
+// ValidateOptions verifies the options and prepares their derived values.
+// It's invoked by New so that options built programmatically are validated too
+func (options *Options) ValidateOptions() error {
 	if options.InputFile != "" && !fileutilz.FileNameIsGlob(options.InputFile) && !fileutil.FileExists(options.InputFile) {
-		gologger.Fatal().Msgf("File %s does not exist.\n", options.InputFile)
+		return fmt.Errorf("File %s does not exist", options.InputFile)
 	}
 
 	if options.InputRawRequest != "" && !fileutil.FileExists(options.InputRawRequest) {
-		gologger.Fatal().Msgf("File %s does not exist.\n", options.InputRawRequest)
+		return fmt.Errorf("File %s does not exist", options.InputRawRequest)
 	}
 
-	multiOutput := options.CSVOutput && options.JSONOutput
-	if multiOutput {
-		gologger.Fatal().Msg("Results can only be displayed in one format: 'JSON' or 'CSV'\n")
-	}
-
-	var err error
-	if options.matchStatusCode, err = stringz.StringToSliceInt(options.OutputMatchStatusCode); err != nil {
-		gologger.Fatal().Msgf("Invalid value for match status code option: %s\n", err)
-	}
-	if options.matchContentLength, err = stringz.StringToSliceInt(options.OutputMatchContentLength); err != nil {
-		gologger.Fatal().Msgf("Invalid value for match content length option: %s\n", err)
-	}
-	if options.filterStatusCode, err = stringz.StringToSliceInt(options.OutputFilterStatusCode); err != nil {
-		gologger.Fatal().Msgf("Invalid value for filter status code option: %s\n", err)
-	}
-	if options.filterContentLength, err = stringz.StringToSliceInt(options.OutputFilterContentLength); err != nil {
-		gologger.Fatal().Msgf("Invalid value for filter content length option: %s\n", err)
-	}
-	if options.OutputFilterRegex != "" {
-		if options.filterRegex, err = regexp.Compile(options.OutputFilterRegex); err != nil {
-			gologger.Fatal().Msgf("Invalid value for regex filter option: %s\n", err)
+	if options.InputFormat != "" {
+		if !slice.StringSliceContains(portscan.Formats, options.InputFormat) {
+			return fmt.Errorf("Invalid input format '%s', use %s", options.InputFormat, strings.Join(portscan.Formats, ", "))
 		}
-	}
-	if options.OutputMatchRegex != "" {
-		if options.matchRegex, err = regexp.Compile(options.OutputMatchRegex); err != nil {
-			gologger.Fatal().Msgf("Invalid value for match regex option: %s\n", err)
+		if len(customport.Ports) > 0 {
+			return errors.New("Ports are taken from the input with -input-format, -ports can't be used")
 		}
+		gologger.Debug().Msgf("Input format specified, probing the scheme of the identified services without fallback\n")
+		options.NoFallbackScheme = true
 	}
-	if options.matchLinesCount, err = stringz.StringToSliceInt(options.OutputMatchLinesCount); err != nil {
-		gologger.Fatal().Msgf("Invalid value for match lines count option: %s\n", err)
-	}
-	if options.matchWordsCount, err = stringz.StringToSliceInt(options.OutputMatchWordsCount); err != nil {
-		gologger.Fatal().Msgf("Invalid value for match words count option: %s\n", err)
+
+	multiOutput := options.CSVOutput && options.JSONOutput
+	if multiOutput {
+		return errors.New("Results can only be displayed in one format: 'JSON' or 'CSV'")
 	}
-	if options.filterLinesCount, err = stringz.StringToSliceInt(options.OutputFilterLinesCount); err != nil {
-		gologger.Fatal().Msgf("Invalid value for filter lines count option: %s\n", err)
+
+	if err := options.compileConditions(); err != nil {
+		return err
 	}
-	if options.filterWordsCount, err = stringz.StringToSliceInt(options.OutputFilterWordsCount); err != nil {
-		gologger.Fatal().Msgf("Invalid value for filter words count option: %s\n", err)
+
+	// targets coming from a channel can't be sorted before being processed
+	if options.InputTargetsChan != nil {
+		options.Stream = true
 	}
 
 	var resolvers []string
@@ -447,7 +554,7 @@ func (options *Options) validateOptions() {
 		if fileutil.FileExists(resolver) {
 			chFile, err := fileutil.ReadFile(resolver)
 			if err != nil {
-				gologger.Fatal().Msgf("Couldn't process resolver file \"%s\": %s\n", resolver, err)
+				return fmt.Errorf("Couldn't process resolver file \"%s\": %s", resolver, err)
 			}
 			for line := range chFile {
 				resolvers = append(resolvers, line)
@@ -461,6 +568,16 @@ func (options *Options) validateOptions() {
 		gologger.Debug().Msgf("Using resolvers: %s\n", strings.Join(options.Resolvers, ","))
 	}
 
+	switch options.StoreFormat {
+	case "", StoreFormatText:
+	case StoreFormatWARC, StoreFormatCAS:
+		options.StoreResponse = true
+	default:
+		return fmt.Errorf("Invalid store format '%s', use %s, %s or %s", options.StoreFormat, StoreFormatText, StoreFormatWARC, StoreFormatCAS)
+	}
+	if options.StoreMaxSize < 0 {
+		return errors.New("Store max size can't be negative")
+	}
 	if options.StoreResponse && options.StoreResponseDir == "" {
 		gologger.Debug().Msgf("Store response directory not specified, using \"%s\"\n", DefaultOutputDirectory)
 		options.StoreResponseDir = DefaultOutputDirectory
@@ -470,9 +587,59 @@ func (options *Options) validateOptions() {
 		options.StoreResponse = true
 	}
 
-	if options.Favicon {
-		gologger.Debug().Msgf("Setting single path to \"favicon.ico\" and ignoring multiple paths settings\n")
-		options.RequestURIs = "/favicon.ico"
+	if options.RateLimitHost < 0 || options.MaxHostConns < 0 {
+		return errors.New("Per host rate limit and concurrency can't be negative")
+	}
+	if options.ProxyList != "" && !fileutil.FileExists(options.ProxyList) {
+		return fmt.Errorf("File %s does not exist", options.ProxyList)
+	}
+	switch options.ProxyRotation {
+	case "", httpx.ProxyRoundRobin, httpx.ProxyRandom:
+	default:
+		return fmt.Errorf("Invalid proxy rotation '%s', use %s or %s", options.ProxyRotation, httpx.ProxyRoundRobin, httpx.ProxyRandom)
+	}
+
+	if options.ThrottleRetries < 0 || options.MaxBackoff < 0 {
+		return errors.New("Throttle retries and backoff can't be negative")
+	}
+	if options.CABundle != "" && !fileutil.FileExists(options.CABundle) {
+		return fmt.Errorf("File %s does not exist", options.CABundle)
+	}
+	if options.Crawl && (options.CrawlDepth < 1 || options.CrawlMaxPages < 1) {
+		return errors.New("Crawl depth and max pages must be positive")
+	}
+	if options.DiscoveryWordlist != "" && !fileutil.FileExists(options.DiscoveryWordlist) {
+		return fmt.Errorf("File %s does not exist", options.DiscoveryWordlist)
+	}
+	if options.Scope != "" && !fileutil.FileExists(options.Scope) {
+		return fmt.Errorf("File %s does not exist", options.Scope)
+	}
+	if options.Diff != "" && !fileutil.FileExists(options.Diff) {
+		return fmt.Errorf("File %s does not exist", options.Diff)
+	}
+	if options.DiffThreshold < 0 || options.DiffThreshold > 64 {
+		return errors.New("Diff threshold must be between 0 and 64")
+	}
+	if options.Shard != "" {
+		var err error
+		if options.shardIndex, options.shardCount, err = parseShard(options.Shard); err != nil {
+			return err
+		}
+	}
+	if options.Coordinator != "" && options.Worker != "" {
+		return errors.New("Coordinator and worker modes can't be used together")
+	}
+	if options.Worker != "" && !strings.Contains(options.Worker, "://") {
+		options.Worker = "http://" + options.Worker
+	}
+	if options.OutputMatchCertExpiring < 0 {
+		return errors.New("Certificate expiry days can't be negative")
+	}
+	if options.OutputMatchCertExpiring > 0 || options.CABundle != "" {
+		options.CertValidate = true
+	}
+	if options.RateLimitIP && options.RateLimitHost == 0 && options.MaxHostConns == 0 {
+		gologger.Debug().Msgf("Per ip limits requested without \"rlh\" or \"mhc\", ignoring\n")
 	}
 
 	if options.Hashes != "" {
@@ -482,6 +649,8 @@ func (options *Options) validateOptions() {
 			}
 		}
 	}
+
+	return nil
 }
 
 // configureOutput configures the output on the screen
@@ -501,23 +670,14 @@ func (options *Options) configureOutput() {
 	}
 }
 
-func (options *Options) configureResume() error {
-	options.resumeCfg = &ResumeCfg{}
-	if options.Resume && fileutil.FileExists(DefaultResumeFile) {
-		return goconfig.Load(&options.resumeCfg, DefaultResumeFile)
-
-	}
-	return nil
-}
-
 // ShouldLoadResume resume file
 func (options *Options) ShouldLoadResume() bool {
-	return options.Resume && fileutil.FileExists(DefaultResumeFile)
+	return options.Resume && options.ShouldSaveResume() && fileutil.FileExists(options.ResumeFile)
 }
 
-// ShouldSaveResume file
+// ShouldSaveResume file. The workers get their units from the coordinator, which keeps track of them
 func (options *Options) ShouldSaveResume() bool {
-	return true
+	return options.ResumeFile != "" && options.Worker == ""
 }
 
 func createGroup(flagSet *goflags.FlagSet, groupName, description string, flags ...*goflags.FlagData) {
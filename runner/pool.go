@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"context"
+	"sync"
+
+	"github.com/remeh/sizedwaitgroup"
+	"github.com/sviivyao/httpx/common/httpx"
+)
+
+// probePool runs the probes of a scan on a bounded number of goroutines. The targets found while
+// probing (tls and csp names, discovered domains, crawled pages) are queued and processed by the loop feeding the
+// input, as the probes hold a slot of the pool and would deadlock waiting for another one.
+type probePool struct {
+	sizedwaitgroup.SizedWaitGroup
+
+	mu     sync.Mutex
+	queued []queuedTarget
+}
+
+// queuedTarget is a target found while probing along with the options of the probe it was found by.
+// The crawled pages are probed as they are.
+type queuedTarget struct {
+	target   string
+	page     *crawlPage
+	hp       *httpx.HTTPX
+	protocol string
+	scanopts *scanOptions
+}
+
+func newProbePool(limit int) *probePool {
+	return &probePool{SizedWaitGroup: sizedwaitgroup.New(limit)}
+}
+
+// queue adds a target found while probing, it never blocks
+func (p *probePool) queue(target string, hp *httpx.HTTPX, protocol string, scanopts *scanOptions) {
+	p.mu.Lock()
+	p.queued = append(p.queued, queuedTarget{target: target, hp: hp, protocol: protocol, scanopts: scanopts})
+	p.mu.Unlock()
+}
+
+// queueCrawl adds a crawled page, it never blocks
+func (p *probePool) queueCrawl(page crawlPage, hp *httpx.HTTPX, scanopts *scanOptions) {
+	p.mu.Lock()
+	p.queued = append(p.queued, queuedTarget{page: &page, hp: hp, scanopts: scanopts})
+	p.mu.Unlock()
+}
+
+// take returns the targets queued so far and empties the queue
+func (p *probePool) take() []queuedTarget {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	queued := p.queued
+	p.queued = nil
+	return queued
+}
+
+// processQueued processes the targets queued so far. It must only be called by the loop feeding
+// the input, which doesn't hold a slot of the pool
+func (r *Runner) processQueued(ctx context.Context, pool *probePool, output chan Result) {
+	for _, item := range pool.take() {
+		if r.inputStopped(ctx) {
+			return
+		}
+		if item.page != nil {
+			r.processCrawlPage(ctx, pool, *item.page, item.hp, item.scanopts, output)
+			continue
+		}
+		r.process(ctx, item.target, pool, item.hp, item.protocol, item.scanopts, output)
+	}
+}
+
+// wait processes the queued targets until all the probes are done and no target is left
+func (r *Runner) wait(ctx context.Context, pool *probePool, output chan Result) {
+	for {
+		r.processQueued(ctx, pool, output)
+		pool.Wait()
+		pool.mu.Lock()
+		empty := len(pool.queued) == 0
+		pool.mu.Unlock()
+		if empty || r.inputStopped(ctx) {
+			return
+		}
+	}
+}
@@ -1,8 +1,190 @@
 package runner
 
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/projectdiscovery/fileutil"
+	"github.com/projectdiscovery/hmap/store/hybrid"
+)
+
+// resumeFlushInterval is the interval between two flushes of the resume journal to disk
+const resumeFlushInterval = 5 * time.Second
+
+// ResumeCfg is a journal of the work units (input, method, protocol, port and path)
+// completed so far. Each completed unit is appended to the resume file, which is flushed
+// periodically so that a scan can be resumed even after a crash, and removed once the
+// scan completes.
 type ResumeCfg struct {
-	ResumeFrom   string
-	Index        int
-	current      string
-	currentIndex int
+	path      string
+	completed *hybrid.HybridMap
+	resumed   int
+	// crawlPages are the pages queued by the crawls of the previous runs
+	crawlPages []crawlPage
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// newResumeCfg creates the journal for the resume file at path. If resume is true the
+// previously completed units are loaded and appended to, otherwise the file is recreated.
+func newResumeCfg(path string, resume bool) (*ResumeCfg, error) {
+	completed, err := hybrid.New(hybrid.DefaultDiskOptions)
+	if err != nil {
+		return nil, err
+	}
+	resumeCfg := &ResumeCfg{path: path, completed: completed, stop: make(chan struct{})}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume && fileutil.FileExists(path) {
+		if err := resumeCfg.load(); err != nil {
+			return nil, errors.Wrapf(err, "could not load resume file '%s'", path)
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	if err := resumeCfg.open(flags); err != nil {
+		completed.Close() //nolint
+		return nil, err
+	}
+	return resumeCfg, nil
+}
+
+// open opens the resume file and starts flushing it periodically
+func (c *ResumeCfg) open(flags int) error {
+	file, err := os.OpenFile(c.path, flags, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "could not create resume file '%s'", c.path)
+	}
+	c.file, c.writer = file, bufio.NewWriter(file)
+
+	c.wg.Add(1)
+	go c.flushLoop()
+	return nil
+}
+
+func (c *ResumeCfg) load() error {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1024*1024)
+	for scanner.Scan() {
+		// a truncated last line can only belong to a unit that wasn't fully recorded
+		unit := scanner.Text()
+		if unit == "" {
+			continue
+		}
+		if strings.HasPrefix(unit, crawlJournalPrefix) {
+			if page, ok := parseCrawlPage(unit); ok {
+				c.crawlPages = append(c.crawlPages, page)
+			}
+			continue
+		}
+		if _, ok := c.completed.Get(unit); !ok {
+			_ = c.completed.Set(unit, nil)
+			c.resumed++
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *ResumeCfg) flushLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(resumeFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = c.Flush()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Completed returns true if the unit was completed by a previous run
+func (c *ResumeCfg) Completed(unit string) bool {
+	_, ok := c.completed.Get(unit)
+	return ok
+}
+
+// MarkCompleted records the unit as completed
+func (c *ResumeCfg) MarkCompleted(unit string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writer == nil {
+		return
+	}
+	_, _ = c.writer.WriteString(unit + "\n")
+}
+
+// MarkQueued records a crawled page as queued
+func (c *ResumeCfg) MarkQueued(page crawlPage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writer == nil {
+		return
+	}
+	_, _ = c.writer.WriteString(page.String() + "\n")
+}
+
+// Flush writes the pending units to disk
+func (c *ResumeCfg) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writer == nil {
+		return nil
+	}
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+	return c.file.Sync()
+}
+
+// Close flushes and closes the journal, removing the resume file if the scan has been completed
+func (c *ResumeCfg) Close(remove bool) error {
+	close(c.stop)
+	c.wg.Wait()
+
+	err := c.Flush()
+	c.mu.Lock()
+	opened := c.file != nil
+	if opened {
+		if closeErr := c.file.Close(); err == nil {
+			err = closeErr
+		}
+		c.file, c.writer = nil, nil
+	}
+	c.mu.Unlock()
+	c.completed.Close() //nolint
+	if remove && opened {
+		_ = os.Remove(c.path)
+	}
+	return err
+}
+
+// probeFinished returns false for the results of the requests that were interrupted by
+// the scan being aborted or skipped, which are probed again when the scan is resumed.
+// The requests which timed out are finished.
+func probeFinished(ctx context.Context, resp Result) bool {
+	if resp.Err == nil {
+		return true
+	}
+	return ctx.Err() == nil && !errors.Is(resp.Err, errSkippedMaxErrors)
+}
+
+// resumeUnit returns the key identifying a single request within the scan
+func resumeUnit(target, method, protocol, path string) string {
+	return strings.Join([]string{method, protocol, target, path}, " ")
 }
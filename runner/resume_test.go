@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sviivyao/httpx/common/httpx"
+)
+
+func TestProbeFinishedTimeout(t *testing.T) {
+	// the listener accepts the connections and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	options := httpx.DefaultOptions
+	options.Timeout = 500 * time.Millisecond
+	options.RetryMax = 0
+	options.CdnCheck = false
+	hp, err := httpx.New(&options)
+	if err != nil {
+		t.Fatalf("could not create client: %s", err)
+	}
+	defer hp.Dialer.Close()
+
+	ctx := context.Background()
+	req, err := hp.NewRequestWithContext(ctx, http.MethodGet, "http://"+listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not create request: %s", err)
+	}
+	_, err = hp.Do(req, httpx.UnsafeOptions{})
+	if err == nil {
+		t.Fatalf("request to a listener that never answers succeeded")
+	}
+	if !probeFinished(ctx, Result{Err: err}) {
+		t.Errorf("probeFinished = false for the timeout %q, want true", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if probeFinished(canceled, Result{Err: canceled.Err()}) {
+		t.Errorf("probeFinished = true for a request interrupted by the scan, want false")
+	}
+	if probeFinished(ctx, Result{Err: errSkippedMaxErrors}) {
+		t.Errorf("probeFinished = true for a skipped request, want false")
+	}
+	if !probeFinished(canceled, Result{StatusCode: http.StatusOK}) {
+		t.Errorf("probeFinished = false for a successful request, want true")
+	}
+}
+
+func TestResumeJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.cfg")
+
+	// the units are on disk once flushed, without waiting for the scan to be interrupted
+	journal, err := newResumeCfg(path, false)
+	if err != nil {
+		t.Fatalf("could not create journal: %s", err)
+	}
+	journal.MarkCompleted(resumeUnit("example.com", http.MethodGet, httpx.HTTPS, "/"))
+	journal.MarkCompleted(resumeUnit("example.com", http.MethodGet, httpx.HTTP, "/"))
+	page := crawlPage{url: "https://example.com/a?b=c", source: "https://example.com", depth: 1, input: "example.com"}
+	journal.MarkQueued(page)
+	if err := journal.Flush(); err != nil {
+		t.Fatalf("could not flush journal: %s", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || len(data) == 0 {
+		t.Fatalf("journal not written after flush: %q %v", data, err)
+	}
+	// a crash leaves the file behind
+	if err := journal.Close(false); err != nil {
+		t.Fatalf("could not close journal: %s", err)
+	}
+
+	resumed, err := newResumeCfg(path, true)
+	if err != nil {
+		t.Fatalf("could not load journal: %s", err)
+	}
+	if resumed.resumed != 2 {
+		t.Errorf("resumed %d units, want 2", resumed.resumed)
+	}
+	if !resumed.Completed(resumeUnit("example.com", http.MethodGet, httpx.HTTPS, "/")) {
+		t.Errorf("completed unit not loaded")
+	}
+	if resumed.Completed(resumeUnit("example.com", http.MethodHead, httpx.HTTPS, "/")) {
+		t.Errorf("unknown unit reported as completed")
+	}
+	if len(resumed.crawlPages) != 1 || resumed.crawlPages[0] != page {
+		t.Errorf("loaded crawl pages %+v, want %+v", resumed.crawlPages, page)
+	}
+	if unit := page.unit(); unit != resumeUnit("example.com", http.MethodGet, httpx.HTTPS, "/a?b=c") {
+		t.Errorf("crawl page unit = %q", unit)
+	}
+	if err := resumed.Close(true); err != nil {
+		t.Fatalf("could not close journal: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal not removed after the scan completed: %v", err)
+	}
+}
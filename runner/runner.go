@@ -7,6 +7,7 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -20,6 +21,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ammario/ipisp/v2"
@@ -28,10 +30,11 @@ import (
 	"github.com/pkg/errors"
 	"github.com/projectdiscovery/clistats"
 	"github.com/projectdiscovery/cryptoutil"
-	"github.com/projectdiscovery/goconfig"
 	"github.com/projectdiscovery/retryablehttp-go"
 	"github.com/projectdiscovery/stringsutil"
 	"github.com/projectdiscovery/urlutil"
+	"github.com/sviivyao/httpx/common/extractor"
+	"github.com/sviivyao/httpx/common/har"
 	"github.com/sviivyao/httpx/common/hashes"
 
 	// automatic fd max increase if running as root
@@ -47,11 +50,15 @@ import (
 	"github.com/remeh/sizedwaitgroup"
 	customport "github.com/sviivyao/httpx/common/customports"
 	fileutilz "github.com/sviivyao/httpx/common/fileutil"
+	"github.com/sviivyao/httpx/common/hostlimit"
 	"github.com/sviivyao/httpx/common/httputilz"
 	"github.com/sviivyao/httpx/common/httpx"
-	"github.com/sviivyao/httpx/common/slice"
+	"github.com/sviivyao/httpx/common/jsanalyze"
+	"github.com/sviivyao/httpx/common/portscan"
+	"github.com/sviivyao/httpx/common/scope"
+	"github.com/sviivyao/httpx/common/store"
 	"github.com/sviivyao/httpx/common/stringz"
-	"go.uber.org/ratelimit"
+	"github.com/sviivyao/httpx/common/warc"
 )
 
 // Runner is a client for running the enumeration process.
@@ -62,12 +69,30 @@ type Runner struct {
 	scanopts        scanOptions
 	hm              *hybrid.HybridMap
 	stats           clistats.StatisticsClient
-	ratelimiter     ratelimit.Limiter
+	ratelimiter     *hostlimit.Rate
+	hostlimiter     *hostlimit.Limiter
 	HostErrorsCache gcache.Cache
+	resume          *ResumeCfg
+	warc            *warc.Writer
+	har             *har.Writer
+	store           *store.Store
+	diff            *scanDiff
+	metrics         *scanMetrics
+	coordinator     *coordinator
+	scope           *scope.Scope
+	discovery       *domainDiscovery
+	crawler         *crawler
+	tlsProfiles     *tlsProfiles
+	icons           *iconCache
+	// inputCtx is canceled to stop taking new targets while the requests in flight complete
+	inputCtx context.Context
 }
 
 // New creates a new client for running enumeration process.
 func New(options *Options) (*Runner, error) {
+	if err := options.ValidateOptions(); err != nil {
+		return nil, err
+	}
 	runner := &Runner{
 		options: options,
 	}
@@ -81,13 +106,27 @@ func New(options *Options) (*Runner, error) {
 
 	httpxOptions := httpx.DefaultOptions
 	// Enables automatically tlsgrab if tlsprobe is requested
-	httpxOptions.TLSGrab = options.TLSGrab || options.TLSProbe
+	httpxOptions.TLSGrab = options.TLSGrab || options.TLSProbe || options.Diff != "" || options.Domainsfinder
+	httpxOptions.CertValidate = options.CertValidate
+	httpxOptions.CABundle = options.CABundle
+	httpxOptions.Trace = options.HAR != ""
 	httpxOptions.Timeout = time.Duration(options.Timeout) * time.Second
 	httpxOptions.RetryMax = options.Retries
 	httpxOptions.FollowRedirects = options.FollowRedirects
 	httpxOptions.FollowHostRedirects = options.FollowHostRedirects
 	httpxOptions.MaxRedirects = options.MaxRedirects
 	httpxOptions.HTTPProxy = options.HTTPProxy
+	httpxOptions.SocksProxy = options.SocksProxy
+	httpxOptions.ProxyRotation = options.ProxyRotation
+	if options.ProxyList != "" {
+		proxies, err := fileutil.ReadFile(options.ProxyList)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read proxy list '%s'", options.ProxyList)
+		}
+		for proxy := range proxies {
+			httpxOptions.Proxies = append(httpxOptions.Proxies, proxy)
+		}
+	}
 	httpxOptions.Unsafe = options.Unsafe
 	httpxOptions.UnsafeURI = options.RequestURI
 	httpxOptions.CdnCheck = options.OutputCDN
@@ -99,6 +138,15 @@ func New(options *Options) (*Runner, error) {
 	}
 	httpxOptions.Deny = options.Deny
 	httpxOptions.Allow = options.Allow
+	if options.Scope != "" {
+		runner.scope, err = scope.Load(options.Scope)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load scope file '%s'", options.Scope)
+		}
+		// the hosts in scope can't be dialed on the excluded networks either
+		httpxOptions.Deny = append(append([]string{}, options.Deny...), runner.scope.ExcludedNetworks()...)
+		httpxOptions.RedirectFilter = runner.scope.Allowed
+	}
 	httpxOptions.MaxResponseBodySizeToSave = int64(options.MaxResponseBodySizeToSave)
 	httpxOptions.MaxResponseBodySizeToRead = int64(options.MaxResponseBodySizeToRead)
 	// adjust response size saved according to the max one read by the server
@@ -128,7 +176,7 @@ func New(options *Options) (*Runner, error) {
 
 	runner.hp, err = httpx.New(&httpxOptions)
 	if err != nil {
-		gologger.Fatal().Msgf("Could not create httpx instance: %s\n", err)
+		return nil, errors.Wrap(err, "could not create httpx instance")
 	}
 
 	var scanopts scanOptions
@@ -137,12 +185,12 @@ func New(options *Options) (*Runner, error) {
 		var rawRequest []byte
 		rawRequest, err = ioutil.ReadFile(options.InputRawRequest)
 		if err != nil {
-			gologger.Fatal().Msgf("Could not read raw request from path '%s': %s\n", options.InputRawRequest, err)
+			return nil, errors.Wrapf(err, "could not read raw request from path '%s'", options.InputRawRequest)
 		}
 
 		rrMethod, rrPath, rrHeaders, rrBody, errParse := httputilz.ParseRequest(string(rawRequest), options.Unsafe)
 		if errParse != nil {
-			gologger.Fatal().Msgf("Could not parse raw request: %s\n", err)
+			return nil, errors.Wrap(errParse, "could not parse raw request")
 		}
 		scanopts.Methods = append(scanopts.Methods, rrMethod)
 		scanopts.RequestURI = rrPath
@@ -200,6 +248,7 @@ func New(options *Options) (*Runner, error) {
 	scanopts.Unsafe = options.Unsafe
 	scanopts.Pipeline = options.Pipeline
 	scanopts.HTTP2Probe = options.HTTP2Probe
+	scanopts.HTTP3Probe = options.HTTP3Probe
 	scanopts.OutputMethod = options.OutputMethod
 	scanopts.OutputIP = options.OutputIP
 	scanopts.OutputCName = options.OutputCName
@@ -208,6 +257,7 @@ func New(options *Options) (*Runner, error) {
 	scanopts.NoFallback = options.NoFallback
 	scanopts.NoFallbackScheme = options.NoFallbackScheme
 	scanopts.TechDetect = options.TechDetect
+	scanopts.JSAnalyze = options.JSAnalyze
 	scanopts.StoreChain = options.StoreChain
 	scanopts.MaxResponseBodySizeToSave = options.MaxResponseBodySizeToSave
 	scanopts.MaxResponseBodySizeToRead = options.MaxResponseBodySizeToRead
@@ -216,6 +266,10 @@ func New(options *Options) (*Runner, error) {
 			return nil, err
 		}
 	}
+	scanopts.Extractors = options.Extractors
+	if scanopts.extractors, err = parseExtractors(options.Extractors); err != nil {
+		return nil, err
+	}
 
 	// output verb if more than one is specified
 	if len(scanopts.Methods) > 1 && !options.Silent {
@@ -251,12 +305,21 @@ func New(options *Options) (*Runner, error) {
 	runner.hm = hm
 
 	if options.RateLimitMinute > 0 {
-		runner.ratelimiter = ratelimit.New(options.RateLimitMinute, ratelimit.Per(60*time.Second))
-	} else if options.RateLimit > 0 {
-		runner.ratelimiter = ratelimit.New(options.RateLimit)
+		runner.ratelimiter = hostlimit.NewRate(options.RateLimitMinute, time.Minute)
 	} else {
-		runner.ratelimiter = ratelimit.NewUnlimited()
+		runner.ratelimiter = hostlimit.NewRate(options.RateLimit, time.Second)
+	}
+	runner.hostlimiter = hostlimit.New(hostlimit.Options{
+		RateLimit:     options.RateLimitHost,
+		MaxConcurrent: options.MaxHostConns,
+		MaxBackoff:    time.Duration(options.MaxBackoff) * time.Second,
+	})
+
+	if options.TLSProfile {
+		runner.tlsProfiles = newTLSProfiles()
 	}
+	// the jobs of the server can enable -favicon
+	runner.icons = newIconCache()
 
 	if options.HostMaxErrors >= 0 {
 		gc := gcache.New(1000).
@@ -265,6 +328,39 @@ func New(options *Options) (*Runner, error) {
 		runner.HostErrorsCache = gc
 	}
 
+	if options.ShouldSaveResume() {
+		runner.resume, err = newResumeCfg(options.ResumeFile, options.Resume)
+		if err != nil {
+			return nil, err
+		}
+		if runner.resume.resumed > 0 {
+			gologger.Info().Msgf("Resuming scan: skipping %d completed requests\n", runner.resume.resumed)
+		}
+	}
+
+	if options.Diff != "" {
+		runner.diff, err = newScanDiff(options.Diff, options.DiffThreshold, options.TechDetect)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load previous output '%s'", options.Diff)
+		}
+	}
+
+	if options.Crawl {
+		runner.crawler = newCrawler(options.CrawlDepth, options.CrawlMaxPages)
+	}
+
+	if options.Domainsfinder {
+		var wordlist []string
+		if options.DiscoveryWordlist != "" {
+			wordlist = fileutilz.LoadFile(options.DiscoveryWordlist)
+		}
+		runner.discovery = newDomainDiscovery(wordlist)
+	}
+
+	if options.MetricsAddr != "" {
+		runner.metrics = newScanMetrics(options.MetricsAddr)
+	}
+
 	return runner, nil
 }
 
@@ -279,54 +375,69 @@ func (r *Runner) prepareInputPaths() {
 	}
 }
 
-func (r *Runner) prepareInput() {
+func (r *Runner) prepareInput() error {
 	// check if file has been provided
 	var numHosts int
 	if fileutil.FileExists(r.options.InputFile) {
 		finput, err := os.Open(r.options.InputFile)
 		if err != nil {
-			gologger.Fatal().Msgf("Could not read input file '%s': %s\n", r.options.InputFile, err)
+			return errors.Wrapf(err, "could not read input file '%s'", r.options.InputFile)
 		}
 		numHosts, err = r.loadAndCloseFile(finput)
 		if err != nil {
-			gologger.Fatal().Msgf("Could not read input file '%s': %s\n", r.options.InputFile, err)
+			return errors.Wrapf(err, "could not read input file '%s'", r.options.InputFile)
 		}
 	} else if r.options.InputFile != "" {
 		files, err := fileutilz.ListFilesWithPattern(r.options.InputFile)
 		if err != nil {
-			gologger.Fatal().Msgf("No input provided: %s", err)
+			return errors.Wrap(err, "no input provided")
 		}
 		for _, file := range files {
 			finput, err := os.Open(file)
 			if err != nil {
-				gologger.Fatal().Msgf("Could not read input file '%s': %s\n", r.options.InputFile, err)
+				return errors.Wrapf(err, "could not read input file '%s'", r.options.InputFile)
 			}
 			numTargetsFile, err := r.loadAndCloseFile(finput)
 			if err != nil {
-				gologger.Fatal().Msgf("Could not read input file '%s': %s\n", r.options.InputFile, err)
+				return errors.Wrapf(err, "could not read input file '%s'", r.options.InputFile)
 			}
 			numHosts += numTargetsFile
 		}
 	}
-	if fileutil.HasStdin() {
+	for _, target := range r.options.InputTargets {
+		numHosts += r.countAndSetTarget(target)
+	}
+	if r.readStdin() {
 		numTargetsStdin, err := r.loadAndCloseFile(os.Stdin)
 		if err != nil {
-			gologger.Fatal().Msgf("Could not read input from stdin: %s\n", err)
+			return errors.Wrap(err, "could not read input from stdin")
 		}
 		numHosts += numTargetsStdin
 	}
 
+	r.metrics.setHosts(numHosts)
 	if r.options.ShowStatistics {
 		r.stats.AddStatic("totalHosts", numHosts)
 		r.stats.AddCounter("hosts", 0)
 		r.stats.AddStatic("startedAt", time.Now())
 		r.stats.AddCounter("requests", 0)
+		r.stats.AddCounter("throttled", 0)
+		for _, errType := range errorTypes {
+			r.stats.AddCounter("errors-"+errType, 0)
+		}
 
 		err := r.stats.Start(makePrintCallback(), time.Duration(r.options.StatsInterval)*time.Second)
 		if err != nil {
 			gologger.Warning().Msgf("Could not create statistics: %s\n", err)
 		}
 	}
+	return nil
+}
+
+// readStdin returns true if targets should be read from stdin, which is skipped
+// when targets are supplied programmatically
+func (r *Runner) readStdin() bool {
+	return len(r.options.InputTargets) == 0 && r.options.InputTargetsChan == nil && fileutil.HasStdin()
 }
 
 func (r *Runner) setSeen(k string) {
@@ -353,82 +464,184 @@ func (r *Runner) testAndSet(k string) bool {
 	return true
 }
 
-func (r *Runner) streamInput() (chan string, error) {
+// streamInput sends the deduplicated targets on the returned channel until the input
+// is exhausted or ctx is cancelled
+func (r *Runner) streamInput(ctx context.Context) (chan string, error) {
+	var files []string
+	if fileutil.FileExists(r.options.InputFile) {
+		files = append(files, r.options.InputFile)
+	} else if r.options.InputFile != "" {
+		var err error
+		files, err = fileutilz.ListFilesWithPattern(r.options.InputFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "no input provided")
+		}
+	}
+
 	out := make(chan string)
 	go func() {
 		defer close(out)
 
-		if fileutil.FileExists(r.options.InputFile) {
-			fchan, err := fileutil.ReadFile(r.options.InputFile)
-			if err != nil {
-				return
-			}
-			for item := range fchan {
-				if r.options.SkipDedupe || r.testAndSet(item) {
-					out <- item
+		for _, file := range files {
+			if r.options.InputFormat != "" {
+				if !r.streamFormattedInput(ctx, file, nil, out) {
+					return
 				}
+				continue
 			}
-		} else if r.options.InputFile != "" {
-			files, err := fileutilz.ListFilesWithPattern(r.options.InputFile)
+			f, err := os.Open(file)
 			if err != nil {
-				gologger.Fatal().Msgf("No input provided: %s", err)
+				return
 			}
-			for _, file := range files {
-				fchan, err := fileutil.ReadFile(file)
-				if err != nil {
-					return
-				}
-				for item := range fchan {
-					if r.options.SkipDedupe || r.testAndSet(item) {
-						out <- item
-					}
-				}
+			completed := r.streamReader(ctx, f, out)
+			f.Close() //nolint
+			if !completed {
+				return
 			}
 		}
-		if fileutil.HasStdin() {
-			fchan, err := fileutil.ReadFileWithReader(os.Stdin)
-			if err != nil {
+		for _, item := range r.options.InputTargets {
+			if !r.sendInput(ctx, item, out) {
 				return
 			}
-			for item := range fchan {
-				if r.options.SkipDedupe || r.testAndSet(item) {
-					out <- item
-				}
+		}
+		if r.options.InputTargetsChan != nil && !r.streamChannel(ctx, r.options.InputTargetsChan, out) {
+			return
+		}
+		if r.readStdin() {
+			if r.options.InputFormat != "" {
+				r.streamFormattedInput(ctx, "stdin", os.Stdin, out)
+				return
 			}
+			r.streamReader(ctx, os.Stdin, out)
 		}
 	}()
 	return out, nil
 }
 
-func (r *Runner) loadAndCloseFile(finput *os.File) (numTargets int, err error) {
-	scanner := bufio.NewScanner(finput)
+// streamReader sends the lines read from reader, it returns false if ctx was cancelled
+func (r *Runner) streamReader(ctx context.Context, reader io.Reader, out chan string) bool {
+	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
-		target := strings.TrimSpace(scanner.Text())
-		// Used just to get the exact number of targets
-		if target == "" {
-			continue
-		}
-		if _, ok := r.hm.Get(target); ok {
-			continue
+		if !r.sendInput(ctx, scanner.Text(), out) {
+			return false
 		}
+	}
+	return true
+}
 
-		// if the target is ip or host it counts as 1
-		expandedTarget := 1
-		// input can be a cidr
-		if iputil.IsCIDR(target) {
-			// so we need to count the ips
-			if ipsCount, err := mapcidr.AddressCount(target); err == nil && ipsCount > 0 {
-				expandedTarget = int(ipsCount)
+// streamChannel forwards the items received on in, it returns false if ctx was cancelled
+func (r *Runner) streamChannel(ctx context.Context, in <-chan string, out chan string) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case item, ok := <-in:
+			if !ok {
+				return true
 			}
+			if !r.sendInput(ctx, item, out) {
+				return false
+			}
+		}
+	}
+}
+
+// sendInput sends the item unless it was already seen, it returns false if ctx was cancelled
+func (r *Runner) sendInput(ctx context.Context, item string, out chan string) bool {
+	if !r.options.SkipDedupe && !r.testAndSet(item) {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case out <- item:
+		return true
+	}
+}
+
+// streamFormattedInput sends the targets of the port scan in the input format read from the file, or from reader if not nil
+func (r *Runner) streamFormattedInput(ctx context.Context, file string, reader io.Reader, out chan string) bool {
+	if reader == nil {
+		f, err := os.Open(file)
+		if err != nil {
+			gologger.Error().Msgf("Could not read input file '%s': %s\n", file, err)
+			return false
+		}
+		defer f.Close() //nolint
+		reader = f
+	}
+	targets, err := r.parseInputFormat(reader)
+	if err != nil {
+		gologger.Error().Msgf("Could not parse input '%s': %s\n", file, err)
+	}
+	for _, target := range targets {
+		if !r.sendInput(ctx, target.String(), out) {
+			return false
+		}
+	}
+	return err == nil
+}
+
+// parseInputFormat returns the open ports of the port scan, without the ones of the services
+// identified as something else than http unless requested
+func (r *Runner) parseInputFormat(reader io.Reader) ([]portscan.Target, error) {
+	targets, err := portscan.Parse(r.options.InputFormat, reader)
+	if r.options.InputAllServices {
+		return targets, err
+	}
+	filtered := targets[:0]
+	for _, target := range targets {
+		if !target.NonHTTP {
+			filtered = append(filtered, target)
 		}
+	}
+	return filtered, err
+}
 
-		numTargets += expandedTarget
-		r.hm.Set(target, nil) //nolint
+func (r *Runner) loadAndCloseFile(finput *os.File) (numTargets int, err error) {
+	if r.options.InputFormat != "" {
+		targets, err := r.parseInputFormat(finput)
+		for _, target := range targets {
+			numTargets += r.countAndSetTarget(target.String())
+		}
+		if closeErr := finput.Close(); err == nil {
+			err = closeErr
+		}
+		return numTargets, err
+	}
+	scanner := bufio.NewScanner(finput)
+	for scanner.Scan() {
+		numTargets += r.countAndSetTarget(scanner.Text())
 	}
 	err = finput.Close()
 	return numTargets, err
 }
 
+// countAndSetTarget adds a new target to the input map and returns the number of hosts it expands to
+func (r *Runner) countAndSetTarget(target string) int {
+	target = strings.TrimSpace(target)
+	// Used just to get the exact number of targets
+	if target == "" {
+		return 0
+	}
+	if _, ok := r.hm.Get(target); ok {
+		return 0
+	}
+
+	// if the target is ip or host it counts as 1
+	expandedTarget := 1
+	// input can be a cidr
+	if iputil.IsCIDR(target) {
+		// so we need to count the ips
+		if ipsCount, err := mapcidr.AddressCount(target); err == nil && ipsCount > 0 {
+			expandedTarget = int(ipsCount)
+		}
+	}
+
+	r.hm.Set(target, nil) //nolint
+	return expandedTarget
+}
+
 var (
 	lastRequestsCount float64
 )
@@ -455,6 +668,22 @@ func makePrintCallback() func(stats clistats.StatisticsClient) {
 		builder.WriteString(" | Requests: ")
 		builder.WriteString(fmt.Sprintf("%.0f", currentRequests))
 
+		if throttled, _ := stats.GetCounter("throttled"); throttled > 0 {
+			builder.WriteString(" | Throttled: ")
+			builder.WriteString(clistats.String(throttled))
+		}
+
+		separator := " | Errors: "
+		for _, errType := range errorTypes {
+			if count, _ := stats.GetCounter("errors-" + errType); count > 0 {
+				builder.WriteString(separator)
+				builder.WriteString(errType)
+				builder.WriteRune('=')
+				builder.WriteString(clistats.String(count))
+				separator = ", "
+			}
+		}
+
 		hosts, _ := stats.GetCounter("hosts")
 		totalHosts, _ := stats.GetStatic("totalHosts")
 
@@ -486,33 +715,125 @@ func (r *Runner) Close() {
 	if r.options.HostMaxErrors >= 0 {
 		r.HostErrorsCache.Purge()
 	}
+	if r.resume != nil {
+		// nolint:errcheck // ignore
+		r.resume.Close(false)
+	}
+	// nolint:errcheck // ignore
+	r.metrics.Close()
 }
 
 // RunEnumeration on targets for httpx client
 func (r *Runner) RunEnumeration() {
+	if err := r.RunEnumerationWithContext(context.Background()); err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+}
+
+// RunEnumerationWithContext runs the enumeration until the input is exhausted or the context is canceled
+func (r *Runner) RunEnumerationWithContext(ctx context.Context) error {
+	return r.RunEnumerationWithContexts(ctx, ctx)
+}
+
+// RunEnumerationWithContexts runs the enumeration until the input is exhausted or inputCtx is canceled.
+// The requests in flight when inputCtx is canceled complete unless ctx is canceled as well.
+func (r *Runner) RunEnumerationWithContexts(inputCtx, ctx context.Context) error {
+	// the metrics are served until the runner is closed
+	if err := r.metrics.serve(); err != nil {
+		return errors.Wrapf(err, "could not expose metrics on '%s'", r.options.MetricsAddr)
+	}
 	// Try to create output folder if it doesn't exist
 	if r.options.StoreResponse && !fileutil.FolderExists(r.options.StoreResponseDir) {
 		if err := os.MkdirAll(r.options.StoreResponseDir, os.ModePerm); err != nil {
-			gologger.Fatal().Msgf("Could not create output directory '%s': %s\n", r.options.StoreResponseDir, err)
+			return errors.Wrapf(err, "could not create output directory '%s'", r.options.StoreResponseDir)
 		}
 	}
+	if r.options.StoreResponse && r.options.StoreFormat == StoreFormatWARC {
+		var err error
+		r.warc, err = warc.New(r.options.StoreResponseDir, "httpx", "httpx/"+Version, int64(r.options.StoreMaxSize)*1024*1024)
+		if err != nil {
+			return errors.Wrapf(err, "could not create warc archive in '%s'", r.options.StoreResponseDir)
+		}
+		defer func() {
+			if err := r.warc.Close(); err != nil {
+				gologger.Warning().Msgf("Could not close warc archive: %s\n", err)
+			}
+			r.warc = nil
+		}()
+	}
+	if r.options.StoreResponse && r.options.StoreFormat == StoreFormatCAS {
+		var err error
+		r.store, err = store.Open(r.options.StoreResponseDir, false)
+		if err != nil {
+			return errors.Wrapf(err, "could not open response store in '%s'", r.options.StoreResponseDir)
+		}
+		defer func() {
+			if err := r.store.Close(); err != nil {
+				gologger.Warning().Msgf("Could not close response store: %s\n", err)
+			}
+			r.store = nil
+		}()
+	}
+	if r.options.HAR != "" {
+		var err error
+		r.har, err = har.New(r.options.HAR, har.Creator{Name: "httpx", Version: Version})
+		if err != nil {
+			return errors.Wrapf(err, "could not create har file '%s'", r.options.HAR)
+		}
+		defer func() {
+			if err := r.har.Close(); err != nil {
+				gologger.Warning().Msgf("Could not close har file: %s\n", err)
+			}
+			r.har = nil
+		}()
+	}
+
+	if r.options.Worker != "" {
+		return r.runWorker(inputCtx, ctx)
+	}
+
+	r.inputCtx = inputCtx
+	defer func() {
+		r.inputCtx = nil
+	}()
 
 	r.prepareInputPaths()
 
 	var streamChan chan string
+	// stopStream releases the input producer when the loop below stops early
+	streamCtx, stopStream := context.WithCancel(inputCtx)
+	defer stopStream()
 	if r.options.Stream {
 		var err error
-		streamChan, err = r.streamInput()
+		streamChan, err = r.streamInput(streamCtx)
 		if err != nil {
-			gologger.Fatal().Msgf("Could not stream input: %s\n", err)
+			return errors.Wrap(err, "could not stream input")
 		}
 	} else {
-		r.prepareInput()
+		if err := r.prepareInput(); err != nil {
+			return err
+		}
+	}
 
-		// if resume is enabled inform the user
-		if r.options.ShouldLoadResume() && r.options.resumeCfg.Index > 0 {
-			gologger.Debug().Msgf("Resuming at position %d: %s\n", r.options.resumeCfg.Index, r.options.resumeCfg.ResumeFrom)
+	var f *os.File
+	writeCSVHeader := r.options.CSVOutput
+	if r.options.Output != "" {
+		var err error
+		// a resumed scan appends to the results of the previous runs
+		if r.resume != nil && r.resume.resumed > 0 {
+			f, err = os.OpenFile(r.options.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err == nil {
+				if info, statErr := f.Stat(); statErr == nil && info.Size() > 0 {
+					writeCSVHeader = false
+				}
+			}
+		} else {
+			f, err = os.Create(r.options.Output)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "could not create output file '%s'", r.options.Output)
 		}
+		defer f.Close() //nolint
 	}
 
 	// output routine
@@ -522,126 +843,84 @@ func (r *Runner) RunEnumeration() {
 	go func(output chan Result) {
 		defer wgoutput.Done()
 
-		var f *os.File
-		if r.options.Output != "" {
-			var err error
-			f, err = os.Create(r.options.Output)
-			if err != nil {
-				gologger.Fatal().Msgf("Could not create output file '%s': %s\n", r.options.Output, err)
-			}
-			defer f.Close() //nolint
-		}
 		if r.options.CSVOutput {
 			header := Result{}.CSVHeader()
-			gologger.Silent().Msgf("%s\n", header)
-			if f != nil {
+			if r.options.OnResult == nil {
+				gologger.Silent().Msgf("%s\n", header)
+			}
+			if f != nil && writeCSVHeader {
 				//nolint:errcheck // this method needs a small refactor to reduce complexity
 				f.WriteString(header + "\n")
 			}
 		}
 
 		for resp := range output {
-			if resp.err != nil {
-				gologger.Debug().Msgf("Failed '%s': %s\n", resp.URL, resp.err)
-			}
-			if resp.str == "" {
-				continue
-			}
-
-			// apply matchers and filters
-			if len(r.options.filterStatusCode) > 0 && slice.IntSliceContains(r.options.filterStatusCode, resp.StatusCode) {
-				continue
-			}
-			if len(r.options.filterContentLength) > 0 && slice.IntSliceContains(r.options.filterContentLength, resp.ContentLength) {
-				continue
-			}
-			if len(r.options.filterLinesCount) > 0 && slice.IntSliceContains(r.options.filterLinesCount, resp.Lines) {
-				continue
-			}
-			if len(r.options.filterWordsCount) > 0 && slice.IntSliceContains(r.options.filterWordsCount, resp.Words) {
-				continue
-			}
-			if r.options.filterRegex != nil && r.options.filterRegex.MatchString(resp.raw) {
-				continue
-			}
-			if r.options.OutputFilterString != "" && strings.Contains(strings.ToLower(resp.raw), strings.ToLower(r.options.OutputFilterString)) {
-				continue
-			}
-			if len(r.options.OutputFilterFavicon) > 0 && stringsutil.EqualFoldAny(resp.FavIconMMH3, r.options.OutputFilterFavicon...) {
-				continue
-			}
-			if len(r.options.matchStatusCode) > 0 && !slice.IntSliceContains(r.options.matchStatusCode, resp.StatusCode) {
-				continue
-			}
-			if len(r.options.matchContentLength) > 0 && !slice.IntSliceContains(r.options.matchContentLength, resp.ContentLength) {
-				continue
-			}
-			if r.options.matchRegex != nil && !r.options.matchRegex.MatchString(resp.raw) {
-				continue
-			}
-			if r.options.OutputMatchString != "" && !strings.Contains(strings.ToLower(resp.raw), strings.ToLower(r.options.OutputMatchString)) {
-				continue
-			}
-			if len(r.options.OutputMatchFavicon) > 0 && !stringsutil.EqualFoldAny(resp.FavIconMMH3, r.options.OutputMatchFavicon...) {
-				continue
-			}
-			if len(r.options.matchLinesCount) > 0 && !slice.IntSliceContains(r.options.matchLinesCount, resp.Lines) {
-				continue
-			}
-			if len(r.options.matchWordsCount) > 0 && !slice.IntSliceContains(r.options.matchWordsCount, resp.Words) {
-				continue
-			}
-
-			row := resp.str
-			if r.options.JSONOutput {
-				row = resp.JSON(&r.scanopts)
-			} else if r.options.CSVOutput {
-				row = resp.CSVRow(&r.scanopts)
+			r.writeResult(f, resp)
+			r.metrics.queued(-1)
+			// the request is recorded only once its result has been handled
+			if r.resume != nil && resp.resumeUnit != "" && probeFinished(ctx, resp) {
+				r.resume.MarkCompleted(resp.resumeUnit)
 			}
+		}
 
-			gologger.Silent().Msgf("%s\n", row)
-			if f != nil {
-				//nolint:errcheck // this method needs a small refactor to reduce complexity
-				f.WriteString(row + "\n")
+		// an interrupted or resumed scan hasn't seen all the endpoints. The removed ones
+		// are reported only, the output file holds the results of this run
+		if r.diff != nil && inputCtx.Err() == nil && (r.resume == nil || r.resume.resumed == 0) {
+			for _, resp := range r.diff.removed() {
+				r.writeRow(nil, resp)
 			}
 		}
 	}(output)
 
-	wg := sizedwaitgroup.New(r.options.Threads)
+	if r.options.Coordinator != "" {
+		var err error
+		r.coordinator, err = newCoordinator(r.options.Coordinator, output, r.metrics)
+		if err != nil {
+			close(output)
+			wgoutput.Wait()
+			return errors.Wrapf(err, "could not listen for workers on '%s'", r.options.Coordinator)
+		}
+		defer func() {
+			r.coordinator.Close() //nolint
+			r.coordinator = nil
+		}()
+	}
+
+	wg := newProbePool(r.options.Threads)
+	r.resumeCrawl(wg)
 
 	processItem := func(k string) error {
-		if r.options.resumeCfg != nil {
-			r.options.resumeCfg.current = k
-			r.options.resumeCfg.currentIndex++
-			if r.options.resumeCfg.currentIndex <= r.options.resumeCfg.Index {
-				return nil
-			}
+		// stop taking new input once the context is canceled
+		if err := inputCtx.Err(); err != nil {
+			return err
 		}
-
-		protocol := r.options.protocol
-		// attempt to parse url as is
-		if u, err := url.Parse(k); err == nil {
-			if r.options.NoFallbackScheme && u.Scheme == httpx.HTTP || u.Scheme == httpx.HTTPS {
-				protocol = u.Scheme
-			}
+		// the targets are probed by the workers
+		if r.coordinator != nil {
+			return r.coordinator.add(inputCtx, k, r.options.requestURIs)
 		}
 
+		protocol := r.inputProtocol(k, r.options.NoFallbackScheme)
+
 		if len(r.options.requestURIs) > 0 {
 			for _, p := range r.options.requestURIs {
 				scanopts := r.scanopts.Clone()
 				scanopts.RequestURI = p
-				r.process(k, &wg, r.hp, protocol, scanopts, output)
+				r.process(ctx, k, wg, r.hp, protocol, scanopts, output)
 			}
 		} else {
-			r.process(k, &wg, r.hp, protocol, &r.scanopts, output)
+			r.process(ctx, k, wg, r.hp, protocol, &r.scanopts, output)
 		}
+		r.processQueued(ctx, wg, output)
 
 		return nil
 	}
 
 	if r.options.Stream {
 		for item := range streamChan {
-			_ = processItem(item)
+			if processItem(item) != nil {
+				stopStream()
+				break
+			}
 		}
 	} else {
 		r.hm.Scan(func(k, _ []byte) error {
@@ -649,42 +928,144 @@ func (r *Runner) RunEnumeration() {
 		})
 	}
 
-	wg.Wait()
+	if r.coordinator != nil {
+		r.coordinator.wait(inputCtx)
+	}
+
+	r.wait(ctx, wg, output)
 
 	close(output)
 
 	wgoutput.Wait()
+
+	// the journal is only needed until the scan completes
+	if inputCtx.Err() == nil && r.resume != nil {
+		err := r.resume.Close(true)
+		r.resume = nil
+		if err != nil {
+			return errors.Wrap(err, "could not close resume file")
+		}
+	}
+
+	return nil
+}
+
+// inputStopped returns true once no new targets should be probed
+func (r *Runner) inputStopped(ctx context.Context) bool {
+	return ctx.Err() != nil || (r.inputCtx != nil && r.inputCtx.Err() != nil)
 }
 
-func (r *Runner) process(t string, wg *sizedwaitgroup.SizedWaitGroup, hp *httpx.HTTPX, protocol string, scanopts *scanOptions, output chan Result) {
+// inputProtocol returns the protocol to probe the input with, which is the scheme of the input if any
+func (r *Runner) inputProtocol(input string, noFallbackScheme bool) string {
+	protocol := r.options.protocol
+	// attempt to parse url as is
+	if u, err := url.Parse(input); err == nil {
+		if noFallbackScheme && u.Scheme == httpx.HTTP || u.Scheme == httpx.HTTPS {
+			protocol = u.Scheme
+		}
+	}
+	return protocol
+}
+
+// writeResult applies the matchers and filters to the result and writes it
+func (r *Runner) writeResult(f *os.File, resp Result) {
+	if resp.Err != nil {
+		gologger.Debug().Msgf("Failed '%s': %s\n", resp.URL, resp.Err)
+	}
+	if resp.str == "" {
+		return
+	}
+
+	// apply matchers and filters
+	if !r.matchConditions(resp) {
+		return
+	}
+	// in diff mode unchanged endpoints are not reported, but still written to the
+	// output file so that it can be the baseline of the next run
+	if r.diff != nil && !r.diff.compare(&resp) {
+		if f != nil {
+			//nolint:errcheck // this method needs a small refactor to reduce complexity
+			f.WriteString(r.formatRow(resp) + "\n")
+		}
+		return
+	}
+
+	r.writeRow(f, resp)
+}
+
+// formatRow returns the result in the requested output format
+func (r *Runner) formatRow(resp Result) string {
+	row := resp.str
+	if r.options.JSONOutput {
+		row = resp.JSON(&r.scanopts)
+	} else if r.options.CSVOutput {
+		row = resp.CSVRow(&r.scanopts)
+	} else if resp.Change != "" {
+		row += changeString(resp, r.scanopts.OutputWithNoColor)
+	}
+	return row
+}
+
+// writeRow reports the result and writes it to the output file if any
+func (r *Runner) writeRow(f *os.File, resp Result) {
+	row := r.formatRow(resp)
+	if r.options.OnResult != nil {
+		r.options.OnResult(resp)
+	} else {
+		gologger.Silent().Msgf("%s\n", row)
+	}
+	if f != nil {
+		//nolint:errcheck // this method needs a small refactor to reduce complexity
+		f.WriteString(row + "\n")
+	}
+}
+
+func (r *Runner) process(ctx context.Context, t string, wg *probePool, hp *httpx.HTTPX, protocol string, scanopts *scanOptions, output chan Result) {
 	protocols := []string{protocol}
 	if scanopts.NoFallback || protocol == httpx.HTTPandHTTPS {
 		protocols = []string{httpx.HTTPS, httpx.HTTP}
 	}
 
-	for target := range r.targets(hp, stringz.TrimProtocol(t, scanopts.NoFallback || scanopts.NoFallbackScheme)) {
+	if r.discovery != nil {
+		r.bruteForce(ctx, t, wg, hp, protocol, scanopts)
+	}
+
+	for target := range r.targets(ctx, hp, stringz.TrimProtocol(t, scanopts.NoFallback || scanopts.NoFallbackScheme)) {
+		if r.inputStopped(ctx) {
+			break
+		}
+		// the input, its expansion and the names discovered by the tls and csp probes are all checked
+		if !r.inScope(target) {
+			continue
+		}
 		// if no custom ports specified then test the default ones
-		if len(customport.Ports) == 0 {
+		if len(customport.Ports) == 0 && r.inShard(target, scanopts.RequestURI) {
 			for _, method := range scanopts.Methods {
 				for _, prot := range protocols {
+					unit := resumeUnit(target, method, prot, scanopts.RequestURI)
+					if r.resume != nil && r.resume.Completed(unit) {
+						continue
+					}
+					r.metrics.queued(1)
 					wg.Add()
 					go func(target, method, protocol string) {
 						defer wg.Done()
-						result := r.analyze(hp, protocol, target, method, t, scanopts)
-						output <- result
+						result := r.analyze(ctx, hp, protocol, target, method, t, scanopts)
+						result.resumeUnit = unit
+						r.setErrorType(&result)
 						if scanopts.TLSProbe && result.TLSData != nil {
 							scanopts.TLSProbe = false
 							for _, tt := range result.TLSData.DNSNames {
 								if !r.testAndSet(tt) {
 									continue
 								}
-								r.process(tt, wg, hp, protocol, scanopts, output)
+								wg.queue(tt, hp, protocol, scanopts)
 							}
 							for _, tt := range result.TLSData.CommonName {
 								if !r.testAndSet(tt) {
 									continue
 								}
-								r.process(tt, wg, hp, protocol, scanopts, output)
+								wg.queue(tt, hp, protocol, scanopts)
 							}
 						}
 						if scanopts.CSPProbe && result.CSPData != nil {
@@ -693,46 +1074,69 @@ func (r *Runner) process(t string, wg *sizedwaitgroup.SizedWaitGroup, hp *httpx.
 								if !r.testAndSet(tt) {
 									continue
 								}
-								r.process(tt, wg, hp, protocol, scanopts, output)
+								wg.queue(tt, hp, protocol, scanopts)
 							}
 						}
+						r.discover(ctx, result, wg, hp, protocol, scanopts)
+						if r.crawler != nil {
+							r.crawl(result, wg, hp, scanopts)
+						}
+						output <- result
 					}(target, method, prot)
 				}
 			}
 		}
 
 		for port, wantedProtocolForPort := range customport.Ports {
+			if r.inputStopped(ctx) {
+				break
+			}
 			wantedProtocols := []string{wantedProtocolForPort}
 			if wantedProtocolForPort == httpx.HTTPandHTTPS {
 				wantedProtocols = []string{httpx.HTTPS, httpx.HTTP}
 			}
 			for _, wantedProtocol := range wantedProtocols {
 				for _, method := range scanopts.Methods {
+					h, _ := urlutil.ChangePort(target, fmt.Sprint(port))
+					if !r.inShard(h, scanopts.RequestURI) {
+						continue
+					}
+					unit := resumeUnit(h, method, wantedProtocol, scanopts.RequestURI)
+					if r.resume != nil && r.resume.Completed(unit) {
+						continue
+					}
+					r.metrics.queued(1)
 					wg.Add()
-					go func(port int, method, protocol string) {
+					go func(h, method, protocol string) {
 						defer wg.Done()
-						h, _ := urlutil.ChangePort(target, fmt.Sprint(port))
-						result := r.analyze(hp, protocol, h, method, t, scanopts)
-						output <- result
+						result := r.analyze(ctx, hp, protocol, h, method, t, scanopts)
+						result.resumeUnit = unit
+						r.setErrorType(&result)
 						if scanopts.TLSProbe && result.TLSData != nil {
 							scanopts.TLSProbe = false
 							for _, tt := range result.TLSData.DNSNames {
 								if !r.testAndSet(tt) {
 									continue
 								}
-								r.process(tt, wg, hp, protocol, scanopts, output)
+								wg.queue(tt, hp, protocol, scanopts)
 							}
 							for _, tt := range result.TLSData.CommonName {
 								if !r.testAndSet(tt) {
 									continue
 								}
-								r.process(tt, wg, hp, protocol, scanopts, output)
+								wg.queue(tt, hp, protocol, scanopts)
 							}
 						}
-					}(port, method, wantedProtocol)
+						r.discover(ctx, result, wg, hp, protocol, scanopts)
+						if r.crawler != nil {
+							r.crawl(result, wg, hp, scanopts)
+						}
+						output <- result
+					}(h, method, wantedProtocol)
 				}
 			}
 		}
+		r.metrics.hostProcessed()
 		if r.options.ShowStatistics {
 			r.stats.IncrementCounter("hosts", 1)
 		}
@@ -740,7 +1144,7 @@ func (r *Runner) process(t string, wg *sizedwaitgroup.SizedWaitGroup, hp *httpx.
 }
 
 // returns all the targets within a cidr range or the single target
-func (r *Runner) targets(hp *httpx.HTTPX, target string) chan string {
+func (r *Runner) targets(ctx context.Context, hp *httpx.HTTPX, target string) chan string {
 	results := make(chan string)
 	go func() {
 		defer close(results)
@@ -756,41 +1160,61 @@ func (r *Runner) targets(hp *httpx.HTTPX, target string) chan string {
 			}
 		}
 
+		// stop producing targets as soon as the context is canceled
+		send := func(item string) bool {
+			select {
+			case results <- item:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
 		// test if the target is a cidr
 		if iputil.IsCIDR(target) {
 			cidrIps, err := mapcidr.IPAddresses(target)
 			if err != nil {
+				gologger.Warning().Msgf("Could not expand cidr %s: %s\n", target, err)
 				return
 			}
 			for _, ip := range cidrIps {
-				results <- ip
+				if !send(ip) {
+					return
+				}
 			}
 		} else if r.options.ProbeAllIPS {
 			URL, err := urlutil.Parse(target)
 			if err != nil {
-				results <- target
+				send(target)
+				return
 			}
 			ips, _, err := getDNSData(hp, URL.Host)
 			if err != nil || len(ips) == 0 {
-				results <- target
+				send(target)
+				return
 			}
 			for _, ip := range ips {
-				results <- strings.Join([]string{ip, target}, ",")
+				if !send(strings.Join([]string{ip, target}, ",")) {
+					return
+				}
 			}
 		} else {
-			results <- target
+			send(target)
 		}
 	}()
 	return results
 }
 
-func (r *Runner) analyze(hp *httpx.HTTPX, protocol, domain, method, origInput string, scanopts *scanOptions) Result {
+func (r *Runner) analyze(ctx context.Context, hp *httpx.HTTPX, protocol, domain, method, origInput string, scanopts *scanOptions) Result {
 	origProtocol := protocol
 	if protocol == httpx.HTTPorHTTPS || protocol == httpx.HTTPandHTTPS {
 		protocol = httpx.HTTPS
 	}
 	retried := false
 retry:
+	if err := ctx.Err(); err != nil {
+		return Result{URL: domain, Input: origInput, Err: err}
+	}
 	var customHost, customIP string
 	if scanopts.ProbeAllIPS {
 		parts := strings.SplitN(domain, ",", 2)
@@ -810,7 +1234,7 @@ retry:
 	}
 	URL, err := urlutil.Parse(domain)
 	if err != nil {
-		return Result{URL: domain, Input: origInput, err: err}
+		return Result{URL: domain, Input: origInput, Err: err}
 	}
 
 	// check if we have to skip the host:port as a result of a previous failure
@@ -818,14 +1242,14 @@ retry:
 	if r.options.HostMaxErrors >= 0 && r.HostErrorsCache.Has(hostPort) {
 		numberOfErrors, err := r.HostErrorsCache.GetIFPresent(hostPort)
 		if err == nil && numberOfErrors.(int) >= r.options.HostMaxErrors {
-			return Result{URL: domain, err: errors.New("skipping as previously unresponsive")}
+			return Result{URL: domain, Err: errSkippedMaxErrors}
 		}
 	}
 
 	// check if the combination host:port should be skipped if belonging to a cdn
 	if r.skipCDNPort(URL.Host, URL.Port) {
 		gologger.Debug().Msgf("Skipping cdn target: %s:%s\n", URL.Host, URL.Port)
-		return Result{URL: domain, Input: origInput, err: errors.New("cdn target only allows ports 80 and 443")}
+		return Result{URL: domain, Input: origInput, Err: errCDNPortSkipped}
 	}
 
 	URL.Scheme = protocol
@@ -844,16 +1268,27 @@ retry:
 		// in case of standard requests append the new path to the existing one
 		URL.RequestURI += scanopts.RequestURI
 	}
+	// the scope may only allow one of the protocols
+	if !r.urlInScope(URL.String()) {
+		if !retried && origProtocol == httpx.HTTPorHTTPS {
+			protocol = httpx.HTTP
+			retried = true
+			goto retry
+		}
+		gologger.Debug().Msgf("Skipping out of scope url: %s\n", URL.String())
+		return Result{URL: URL.String(), Input: origInput, Err: errOutOfScope}
+	}
+
 	var req *retryablehttp.Request
 	if customIP != "" {
 		customHost = URL.Host
-		ctx := context.WithValue(context.Background(), "ip", customIP) //nolint
-		req, err = hp.NewRequestWithContext(ctx, method, URL.String())
+		ipCtx := context.WithValue(ctx, "ip", customIP) //nolint
+		req, err = hp.NewRequestWithContext(ipCtx, method, URL.String())
 	} else {
-		req, err = hp.NewRequest(method, URL.String())
+		req, err = hp.NewRequestWithContext(ctx, method, URL.String())
 	}
 	if err != nil {
-		return Result{URL: URL.String(), Input: origInput, err: err}
+		return Result{URL: URL.String(), Input: origInput, Err: err}
 	}
 
 	if customHost != "" {
@@ -879,22 +1314,60 @@ retry:
 		req.Body = nil
 	}
 
-	r.ratelimiter.Take()
-
 	// with rawhttp we should say to the server to close the connection, otherwise it will remain open
 	if scanopts.Unsafe {
 		req.Header.Add("Connection", "close")
 	}
-	resp, err := hp.Do(req, httpx.UnsafeOptions{URIPath: reqURI})
-	if r.options.ShowStatistics {
-		r.stats.IncrementCounter("requests", 1)
+
+	limitKey := r.hostLimitKey(hp, URL.Host, customIP)
+	var resp *httpx.Response
+	var throttled bool
+	var throttleRetries int
+	for {
+		release, errTake := r.take(ctx, limitKey)
+		if errTake != nil {
+			return Result{URL: URL.String(), Input: origInput, Timestamp: time.Now(), Err: errTake}
+		}
+		start := time.Now()
+		resp, err = hp.Do(req, httpx.UnsafeOptions{URIPath: reqURI})
+		r.metrics.request(protocol, resp, err, time.Since(start))
+		release()
+		if r.options.ShowStatistics {
+			r.stats.IncrementCounter("requests", 1)
+		}
+
+		retryAfter, isThrottled := r.isThrottled(limitKey, resp, err)
+		if !isThrottled {
+			break
+		}
+		throttled = true
+		delay := r.hostlimiter.Throttle(limitKey, retryAfter)
+		if r.options.ShowStatistics {
+			r.stats.IncrementCounter("throttled", 1)
+		}
+		if throttleRetries >= r.options.ThrottleRetries {
+			// the retry budget is spent, skip the remaining requests to the host:port
+			gologger.Debug().Msgf("Throttled by '%s', skipping host\n", URL.String())
+			if r.options.HostMaxErrors >= 0 {
+				_ = r.HostErrorsCache.Set(hostPort, r.options.HostMaxErrors)
+			}
+			break
+		}
+		throttleRetries++
+		gologger.Debug().Msgf("Throttled by '%s', retrying in %s\n", URL.String(), delay)
+
+		// the body has been consumed by the previous attempt
+		if scanopts.RequestBody != "" {
+			req.ContentLength = int64(len(scanopts.RequestBody))
+			req.Body = ioutil.NopCloser(strings.NewReader(scanopts.RequestBody))
+		}
 	}
 	var requestDump []byte
 	if scanopts.Unsafe {
 		var errDump error
 		requestDump, errDump = rawhttp.DumpRequestRaw(req.Method, req.URL.String(), reqURI, req.Header, req.Body, rawhttp.DefaultOptions)
 		if errDump != nil {
-			return Result{URL: URL.String(), Input: origInput, err: errDump}
+			return Result{URL: URL.String(), Input: origInput, Err: errDump}
 		}
 	} else {
 		// Create a copy on the fly of the request body
@@ -905,7 +1378,7 @@ retry:
 		var errDump error
 		requestDump, errDump = httputil.DumpRequestOut(req.Request, true)
 		if errDump != nil {
-			return Result{URL: URL.String(), Input: origInput, err: errDump}
+			return Result{URL: URL.String(), Input: origInput, Err: errDump}
 		}
 		// The original req.Body gets modified indirectly by httputil.DumpRequestOut so we set it again to nil if it was empty
 		// Otherwise redirects like 307/308 would fail (as they require the body to be sent along)
@@ -917,7 +1390,7 @@ retry:
 	// fix the final output url
 	fullURL := req.URL.String()
 	if parsedURL, errParse := urlutil.Parse(fullURL); errParse != nil {
-		return Result{URL: URL.String(), Input: origInput, err: errParse}
+		return Result{URL: URL.String(), Input: origInput, Err: errParse}
 	} else {
 		if r.options.Unsafe {
 			parsedURL.RequestURI = reqURI
@@ -964,12 +1437,19 @@ retry:
 		splitErr := strings.Split(errString, ":")
 		errString = strings.TrimSpace(splitErr[len(splitErr)-1])
 
+		// the request was interrupted, neither fallback nor count it as a host error
+		if ctx.Err() != nil {
+			return Result{URL: URL.String(), Input: origInput, Timestamp: time.Now(), Err: err}
+		}
+
 		if !retried && origProtocol == httpx.HTTPorHTTPS {
+			failedProtocol := protocol
 			if protocol == httpx.HTTPS {
 				protocol = httpx.HTTP
 			} else {
 				protocol = httpx.HTTPS
 			}
+			r.metrics.fallback(failedProtocol, protocol)
 			retried = true
 			goto retry
 		}
@@ -985,9 +1465,9 @@ retry:
 		}
 
 		if r.options.Probe {
-			return Result{URL: URL.String(), Input: origInput, Timestamp: time.Now(), err: err, Failed: err != nil, Error: errString, str: builder.String()}
+			return Result{URL: URL.String(), Input: origInput, Timestamp: time.Now(), Err: err, Failed: err != nil, Error: errString, str: builder.String(), Throttled: throttled, ThrottleRetries: throttleRetries}
 		} else {
-			return Result{URL: URL.String(), Input: origInput, Timestamp: time.Now(), err: err}
+			return Result{URL: URL.String(), Input: origInput, Timestamp: time.Now(), Err: err}
 		}
 	}
 
@@ -1090,8 +1570,10 @@ retry:
 	// check for virtual host
 	isvhost := false
 	if scanopts.VHost {
-		r.ratelimiter.Take()
-		isvhost, _ = hp.IsVirtualHost(req, httpx.UnsafeOptions{})
+		if release, err := r.take(ctx, limitKey); err == nil {
+			isvhost, _ = hp.IsVirtualHost(req, httpx.UnsafeOptions{})
+			release()
+		}
 		if isvhost {
 			builder.WriteString(" [vhost]")
 		}
@@ -1106,8 +1588,10 @@ retry:
 	pipeline := false
 	if scanopts.Pipeline {
 		port, _ := strconv.Atoi(URL.Port)
-		r.ratelimiter.Take()
-		pipeline = hp.SupportPipeline(protocol, method, URL.Host, port)
+		if release, err := r.take(ctx, limitKey); err == nil {
+			pipeline = hp.SupportPipeline(ctx, protocol, method, URL.Host, port)
+			release()
+		}
 		if pipeline {
 			builder.WriteString(" [pipeline]")
 		}
@@ -1119,8 +1603,10 @@ retry:
 	var http2 bool
 	// if requested probes for http2
 	if scanopts.HTTP2Probe {
-		r.ratelimiter.Take()
-		http2 = hp.SupportHTTP2(protocol, method, URL.String())
+		if release, err := r.take(ctx, limitKey); err == nil {
+			http2 = hp.SupportHTTP2(ctx, protocol, method, URL.String())
+			release()
+		}
 		if http2 {
 			builder.WriteString(" [http2]")
 		}
@@ -1128,10 +1614,59 @@ retry:
 			r.stats.IncrementCounter("requests", 1)
 		}
 	}
+
+	var http3ALPN []string
+	// if requested probes for http3 on the endpoints advertised with alt-svc
+	if scanopts.HTTP3Probe && len(resp.Headers["Alt-Svc"]) > 0 {
+		if release, err := r.take(ctx, limitKey); err == nil {
+			http3ALPN = hp.SupportHTTP3(ctx, URL.Host, resp)
+			release()
+		}
+		if len(http3ALPN) > 0 {
+			builder.WriteString(" [http3]")
+		}
+		if r.options.ShowStatistics {
+			r.stats.IncrementCounter("requests", 1)
+		}
+	}
+	var tlsProfile *httpx.TLSProfile
+	// if requested profiles the tls configurations with separate handshakes
+	if r.options.TLSProfile && protocol == httpx.HTTPS {
+		port := URL.Port
+		if port == "" {
+			port = "443"
+		}
+		tlsProfile = r.tlsProfile(ctx, hp, URL.Host, port, limitKey)
+		if tlsProfile != nil {
+			builder.WriteString(" [")
+			if !scanopts.OutputWithNoColor {
+				builder.WriteString(aurora.Magenta(strings.Join(tlsProfile.Versions, ",")).String())
+			} else {
+				builder.WriteString(strings.Join(tlsProfile.Versions, ","))
+			}
+			builder.WriteRune(']')
+		}
+	}
+
+	if resp.CertValidation != nil {
+		certIssues := strings.Join(resp.CertValidation.Issues(), ",")
+		builder.WriteString(" [")
+		if !scanopts.OutputWithNoColor {
+			if resp.CertValidation.Trusted && !resp.CertValidation.HostnameMismatch && !resp.CertValidation.Expired && !resp.CertValidation.NotYetValid {
+				builder.WriteString(aurora.Green(certIssues).String())
+			} else {
+				builder.WriteString(aurora.Red(certIssues).String())
+			}
+		} else {
+			builder.WriteString(certIssues)
+		}
+		builder.WriteRune(']')
+	}
+
 	ip := hp.Dialer.GetDialedIP(URL.Host)
 	var asnResponse interface{ String() string }
 	if r.options.Asn {
-		lookupResult, err := ipisp.LookupIP(context.Background(), net.ParseIP(ip))
+		lookupResult, err := ipisp.LookupIP(ctx, net.ParseIP(ip))
 		if err != nil {
 			gologger.Warning().Msg(err.Error())
 		}
@@ -1208,11 +1743,65 @@ retry:
 		}
 	}
 
+	var extracts map[string][]string
+	if len(scanopts.extractors) > 0 {
+		extracts = extractor.Extract(scanopts.extractors, resp.Headers, resp.Data)
+		names := make([]string, 0, len(extracts))
+		for name := range extracts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := name + ":" + strings.Join(extracts[name], ",")
+			builder.WriteString(" [")
+			if !scanopts.OutputWithNoColor {
+				builder.WriteString(aurora.Magenta(value).String())
+			} else {
+				builder.WriteString(value)
+			}
+			builder.WriteRune(']')
+		}
+	}
+
 	var finalURL string
 	if resp.HasChain() {
 		finalURL = resp.GetChainLastURL()
 	}
 
+	var jsFiles []string
+	var jsFindings jsanalyze.Findings
+	if scanopts.JSAnalyze {
+		pageURL := fullURL
+		if finalURL != "" {
+			pageURL = finalURL
+		}
+		jsFiles, jsFindings = r.analyzeScripts(ctx, hp, pageURL, resp)
+		if !jsFindings.Empty() {
+			var counts []string
+			for _, category := range []struct {
+				name     string
+				findings []jsanalyze.Finding
+			}{
+				{"paths", jsFindings.Paths},
+				{"urls", jsFindings.URLs},
+				{"graphql", jsFindings.GraphQL},
+				{"source-maps", jsFindings.SourceMaps},
+				{"secrets", jsFindings.Secrets},
+			} {
+				if len(category.findings) > 0 {
+					counts = append(counts, fmt.Sprintf("%s=%d", category.name, len(category.findings)))
+				}
+			}
+			builder.WriteString(" [")
+			if !scanopts.OutputWithNoColor {
+				builder.WriteString(aurora.Magenta(strings.Join(counts, ",")).String())
+			} else {
+				builder.WriteString(strings.Join(counts, ","))
+			}
+			builder.WriteRune(']')
+		}
+	}
+
 	if resp.HasChain() {
 		builder.WriteString(" [")
 		if !scanopts.OutputWithNoColor {
@@ -1224,15 +1813,27 @@ retry:
 	}
 
 	var faviconMMH3 string
+	var favicons []Favicon
 	if scanopts.Favicon {
-		faviconMMH3 = fmt.Sprintf("%d", stringz.FaviconHash(resp.Data))
-		builder.WriteString(" [")
-		if !scanopts.OutputWithNoColor {
-			builder.WriteString(aurora.Magenta(faviconMMH3).String())
-		} else {
-			builder.WriteString(faviconMMH3)
+		pageURL := fullURL
+		if finalURL != "" {
+			pageURL = finalURL
+		}
+		favicons = r.favicons(ctx, hp, pageURL, resp)
+		if len(favicons) > 0 {
+			faviconMMH3 = favicons[0].MMH3
+			var faviconHashes []string
+			for _, favicon := range favicons {
+				faviconHashes = append(faviconHashes, favicon.MMH3)
+			}
+			builder.WriteString(" [")
+			if !scanopts.OutputWithNoColor {
+				builder.WriteString(aurora.Magenta(strings.Join(faviconHashes, ",")).String())
+			} else {
+				builder.WriteString(strings.Join(faviconHashes, ","))
+			}
+			builder.WriteRune(']')
 		}
-		builder.WriteRune(']')
 	}
 	// adding default hashing for json output format
 	if r.options.JSONOutput && len(scanopts.Hashes) == 0 {
@@ -1282,6 +1883,10 @@ retry:
 		}
 		builder.WriteRune(']')
 	}
+	// the body simhash is compared in diff mode
+	if r.options.Diff != "" && hashesMap["body-simhash"] == "" {
+		hashesMap["body-simhash"] = hashes.Simhash(resp.Data)
+	}
 	if scanopts.OutputLinesCount {
 		builder.WriteString(" [")
 		if !scanopts.OutputWithNoColor {
@@ -1293,7 +1898,9 @@ retry:
 	}
 	jarmhash := ""
 	if r.options.Jarm {
-		jarmhash = hashes.Jarm(fullURL, r.options.Timeout)
+		jarmhash = hashes.Jarm(ctx, r.hp, fullURL, r.options.Timeout, func(ctx context.Context) (func(), error) {
+			return r.take(ctx, limitKey)
+		})
 		builder.WriteString(" [")
 		if !scanopts.OutputWithNoColor {
 			builder.WriteString(aurora.Magenta(jarmhash).String())
@@ -1312,8 +1919,16 @@ retry:
 		builder.WriteRune(']')
 	}
 
+	if r.har != nil {
+		r.storeHAR(hp, req, fullURL, requestDump, resp, scanopts)
+	}
+
 	// store responses or chain in directory
-	if scanopts.StoreResponse || scanopts.StoreChain {
+	if r.warc != nil {
+		r.storeWARC(hp, fullURL, origInput, requestDump, resp, scanopts)
+	} else if r.store != nil {
+		r.storeContent(fullURL, resp, hashesMap, scanopts)
+	} else if scanopts.StoreResponse || scanopts.StoreChain {
 		domainFile := strings.ReplaceAll(urlutil.TrimScheme(URL.String()), ":", ".")
 
 		// On various OS the file max file name length is 255 - https://serverfault.com/questions/9546/filename-length-limits-on-linux
@@ -1346,7 +1961,7 @@ retry:
 
 	parsed, err := urlutil.Parse(fullURL)
 	if err != nil {
-		return Result{URL: fullURL, Input: origInput, err: errors.Wrap(err, "could not parse url")}
+		return Result{URL: fullURL, Input: origInput, Err: errors.Wrap(err, "could not parse url")}
 	}
 
 	finalPort := parsed.Port
@@ -1370,14 +1985,14 @@ retry:
 		chainItems = append(chainItems, resp.GetChainAsSlice()...)
 	}
 
-	return Result{
+	result := Result{
 		Timestamp:        time.Now(),
 		Request:          request,
 		ResponseHeader:   responseHeader,
 		Scheme:           parsed.Scheme,
 		Port:             finalPort,
 		Path:             finalPath,
-		raw:              resp.Raw,
+		Raw:              resp.Raw,
 		URL:              fullURL,
 		Input:            origInput,
 		ContentLength:    resp.ContentLength,
@@ -1393,9 +2008,12 @@ retry:
 		ResponseBody:     serverResponseRaw,
 		WebSocket:        isWebSocket,
 		TLSData:          resp.TLSData,
+		TLSProfile:       tlsProfile,
 		CSPData:          resp.CSPData,
 		Pipeline:         pipeline,
 		HTTP2:            http2,
+		HTTP3:            len(http3ALPN) > 0,
+		HTTP3ALPN:        http3ALPN,
 		Method:           method,
 		Host:             ip,
 		A:                ips,
@@ -1404,22 +2022,122 @@ retry:
 		CDNName:          cdnName,
 		ResponseTime:     resp.Duration.String(),
 		Technologies:     technologies,
+		Extracts:         extracts,
+		JSFiles:          jsFiles,
+		JSPaths:          jsFindings.Paths,
+		JSURLs:           jsFindings.URLs,
+		JSGraphQL:        jsFindings.GraphQL,
+		JSSourceMaps:     jsFindings.SourceMaps,
+		JSSecrets:        jsFindings.Secrets,
 		FinalURL:         finalURL,
 		FavIconMMH3:      faviconMMH3,
+		Favicons:         favicons,
 		Hashes:           hashesMap,
 		Jarm:             jarmhash,
 		Lines:            resp.Lines,
 		Words:            resp.Words,
 		ASN:              asnResponse,
+		BodyTruncated:    resp.BodyTruncated,
+		Throttled:        throttled,
+		ThrottleRetries:  throttleRetries,
+	}
+	result.setCertValidation(resp.CertValidation)
+	if r.discovery != nil {
+		result.discovered = discoverDomains(URL.Host, resp)
+	}
+	if r.crawler != nil {
+		result.links = crawlLinks(fullURL, resp)
+	}
+	return result
+}
+
+// take waits for the per host and the global rate limits before sending a request to the host,
+// the returned function frees the host concurrency slot once the request completes
+func (r *Runner) take(ctx context.Context, limitKey string) (release func(), err error) {
+	start := time.Now()
+	release, err = r.hostlimiter.Take(ctx, limitKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ratelimiter.Take(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	r.metrics.rateLimited(time.Since(start))
+	return release, nil
+}
+
+// isThrottled checks if the host is asking to slow down, either explicitly or with a
+// burst of connection resets, and returns the delay requested by the server if any
+func (r *Runner) isThrottled(limitKey string, resp *httpx.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		if errors.Is(err, syscall.ECONNRESET) || strings.Contains(err.Error(), "connection reset by peer") {
+			return 0, r.hostlimiter.ConnectionReset(limitKey)
+		}
+		return 0, false
+	}
+	if resp.IsThrottled() {
+		return resp.RetryAfter(), true
+	}
+	r.hostlimiter.Recover(limitKey)
+	return 0, false
+}
+
+// hostLimitKey returns the key the per host limits apply to, which is the
+// resolved ip if the limits are per ip
+func (r *Runner) hostLimitKey(hp *httpx.HTTPX, host, customIP string) string {
+	if !r.options.RateLimitIP || !r.hostlimiter.Enabled() {
+		return host
+	}
+	if customIP != "" {
+		return customIP
+	}
+	if iputil.IsIP(host) {
+		return host
+	}
+	if dnsData, err := hp.Dialer.GetDNSData(host); err == nil {
+		if len(dnsData.A) > 0 {
+			return dnsData.A[0]
+		}
+		if len(dnsData.AAAA) > 0 {
+			return dnsData.AAAA[0]
+		}
+	}
+	return host
+}
+
+// fetchResource requests a resource referenced by a response, such as a script or an icon, within the rate limits of its host
+func (r *Runner) fetchResource(ctx context.Context, hp *httpx.HTTPX, rawURL string) (*httpx.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := hp.NewRequestWithContext(ctx, http.MethodGet, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	hp.SetCustomHeaders(req, hp.CustomHeaders)
+
+	release, err := r.take(ctx, r.hostLimitKey(hp, u.Host, ""))
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := hp.Do(req, httpx.UnsafeOptions{URIPath: u.RequestURI()})
+	r.metrics.request(u.Scheme, resp, err, time.Since(start))
+	release()
+	if r.options.ShowStatistics {
+		r.stats.IncrementCounter("requests", 1)
 	}
+	return resp, err
 }
 
-// SaveResumeConfig to file
+// SaveResumeConfig flushes the completed requests to the resume file
 func (r *Runner) SaveResumeConfig() error {
-	var resumeCfg ResumeCfg
-	resumeCfg.Index = r.options.resumeCfg.currentIndex
-	resumeCfg.ResumeFrom = r.options.resumeCfg.current
-	return goconfig.Save(resumeCfg, DefaultResumeFile)
+	if r.resume == nil {
+		return nil
+	}
+	return r.resume.Flush()
 }
 
 type AsnResponse struct {
@@ -1443,14 +2161,18 @@ type Result struct {
 	Path             string    `json:"path,omitempty" csv:"path"`
 	A                []string  `json:"a,omitempty" csv:"a"`
 	CNAMEs           []string  `json:"cnames,omitempty" csv:"cnames"`
-	raw              string
-	URL              string `json:"url,omitempty" csv:"url"`
-	Input            string `json:"input,omitempty" csv:"input"`
-	Location         string `json:"location,omitempty" csv:"location"`
-	Title            string `json:"title,omitempty" csv:"title"`
+	Raw              string    `json:"-"`
+	URL              string    `json:"url,omitempty" csv:"url"`
+	Input            string    `json:"input,omitempty" csv:"input"`
+	Location         string    `json:"location,omitempty" csv:"location"`
+	Title            string    `json:"title,omitempty" csv:"title"`
 	str              string
-	err              error
+	resumeUnit       string
+	discovered       []string
+	links            []string
+	Err              error               `json:"-"`
 	Error            string              `json:"error,omitempty" csv:"error"`
+	ErrorType        string              `json:"error-type,omitempty" csv:"error-type"`
 	WebServer        string              `json:"webserver,omitempty" csv:"webserver"`
 	ResponseBody     string              `json:"response-body,omitempty" csv:"response-body"`
 	ContentType      string              `json:"content-type,omitempty" csv:"content-type"`
@@ -1460,24 +2182,77 @@ type Result struct {
 	ChainStatusCodes []int               `json:"chain-status-codes,omitempty" csv:"chain-status-codes"`
 	StatusCode       int                 `json:"status-code,omitempty" csv:"status-code"`
 	TLSData          *cryptoutil.TLSData `json:"tls-grab,omitempty" csv:"tls-grab"`
+	TLSProfile       *httpx.TLSProfile   `json:"tls-profile,omitempty" csv:"tls-profile"`
 	CSPData          *httpx.CSPData      `json:"csp,omitempty" csv:"csp"`
 	VHost            bool                `json:"vhost,omitempty" csv:"vhost"`
 	WebSocket        bool                `json:"websocket,omitempty" csv:"websocket"`
 	Pipeline         bool                `json:"pipeline,omitempty" csv:"pipeline"`
 	HTTP2            bool                `json:"http2,omitempty" csv:"http2"`
+	HTTP3            bool                `json:"http3,omitempty" csv:"http3"`
+	HTTP3ALPN        []string            `json:"http3-alpn,omitempty" csv:"http3-alpn"`
 	CDN              bool                `json:"cdn,omitempty" csv:"cdn"`
 	CDNName          string              `json:"cdn-name,omitempty" csv:"cdn-name"`
 	ResponseTime     string              `json:"response-time,omitempty" csv:"response-time"`
 	Technologies     []string            `json:"technologies,omitempty" csv:"technologies"`
+	Extracts         map[string][]string `json:"extracts,omitempty" csv:"extracts"`
+	JSFiles          []string            `json:"js-files,omitempty" csv:"js-files"`
+	JSPaths          []jsanalyze.Finding `json:"js-paths,omitempty" csv:"js-paths"`
+	JSURLs           []jsanalyze.Finding `json:"js-urls,omitempty" csv:"js-urls"`
+	JSGraphQL        []jsanalyze.Finding `json:"js-graphql,omitempty" csv:"js-graphql"`
+	JSSourceMaps     []jsanalyze.Finding `json:"js-source-maps,omitempty" csv:"js-source-maps"`
+	JSSecrets        []jsanalyze.Finding `json:"js-secrets,omitempty" csv:"js-secrets"`
 	Chain            []httpx.ChainItem   `json:"chain,omitempty" csv:"chain"`
 	FinalURL         string              `json:"final-url,omitempty" csv:"final-url"`
 	Failed           bool                `json:"failed" csv:"failed"`
 	FavIconMMH3      string              `json:"favicon-mmh3,omitempty" csv:"favicon-mmh3"`
+	Favicons         []Favicon           `json:"favicons,omitempty" csv:"favicons"`
 	Hashes           map[string]string   `json:"hashes,omitempty" csv:"hashes"`
 	ASN              interface{}         `json:"asn,omitempty" csv:"asn"`
 	Lines            int                 `json:"lines" csv:"lines"`
 	Words            int                 `json:"words" csv:"words"`
 	Jarm             string              `json:"jarm,omitempty" csv:"jarm"`
+	BodyTruncated    bool                `json:"body-truncated,omitempty" csv:"body-truncated"`
+	Throttled        bool                `json:"throttled,omitempty" csv:"throttled"`
+	ThrottleRetries  int                 `json:"throttle-retries,omitempty" csv:"throttle-retries"`
+	Change           string              `json:"change,omitempty" csv:"change"`
+	Changes          []string            `json:"changes,omitempty" csv:"changes"`
+	CrawlDepth       int                 `json:"crawl-depth,omitempty" csv:"crawl-depth"`
+	CrawlSource      string              `json:"crawl-source,omitempty" csv:"crawl-source"`
+
+	CertTrusted            *bool  `json:"cert-trusted,omitempty" csv:"cert-trusted"`
+	CertError              string `json:"cert-error,omitempty" csv:"cert-error"`
+	CertHostnameMismatch   bool   `json:"cert-hostname-mismatch,omitempty" csv:"cert-hostname-mismatch"`
+	CertSelfSigned         bool   `json:"cert-self-signed,omitempty" csv:"cert-self-signed"`
+	CertExpired            bool   `json:"cert-expired,omitempty" csv:"cert-expired"`
+	CertNotYetValid        bool   `json:"cert-not-yet-valid,omitempty" csv:"cert-not-yet-valid"`
+	CertDaysToExpiry       *int   `json:"cert-days-to-expiry,omitempty" csv:"cert-days-to-expiry"`
+	CertSignatureAlgorithm string `json:"cert-signature-algorithm,omitempty" csv:"cert-signature-algorithm"`
+	CertWeakSignature      bool   `json:"cert-weak-signature,omitempty" csv:"cert-weak-signature"`
+	CertKeyAlgorithm       string `json:"cert-key-algorithm,omitempty" csv:"cert-key-algorithm"`
+	CertKeySize            int    `json:"cert-key-size,omitempty" csv:"cert-key-size"`
+	CertWeakKey            bool   `json:"cert-weak-key,omitempty" csv:"cert-weak-key"`
+}
+
+// setCertValidation copies the outcome of the certificate validation to the result
+func (r *Result) setCertValidation(validation *httpx.CertValidation) {
+	if validation == nil {
+		return
+	}
+	// set even when false, as an untrusted chain is what is reported most
+	trusted := validation.Trusted
+	daysToExpiry := validation.DaysToExpiry
+	r.CertTrusted = &trusted
+	r.CertError = validation.Error
+	r.CertHostnameMismatch = validation.HostnameMismatch
+	r.CertSelfSigned = validation.SelfSigned
+	r.CertExpired = validation.Expired
+	r.CertNotYetValid = validation.NotYetValid
+	r.CertDaysToExpiry = &daysToExpiry
+	r.CertSignatureAlgorithm = validation.SignatureAlgorithm
+	r.CertWeakSignature = validation.WeakSignature
+	r.CertKeyAlgorithm = validation.KeyAlgorithm
+	r.CertKeySize = validation.KeySize
+	r.CertWeakKey = validation.WeakKey
 }
 
 // JSON the result
@@ -1533,6 +2308,14 @@ func (r Result) CSVRow(scanopts *scanOptions) string { //nolint
 			continue
 		}
 
+		// pointers are written as the value they point to, nil ones as empty cells
+		if value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				cells = append(cells, "")
+				continue
+			}
+			value = value.Elem()
+		}
 		str := fmt.Sprintf("%v", value.Interface())
 
 		// defense against csv injection
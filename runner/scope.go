@@ -0,0 +1,37 @@
+package runner
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/urlutil"
+)
+
+// inScope returns false if the host of a target, as given in input or discovered, can't be in scope.
+// The targets of the probe all ips and vhost modes are made of the comma separated ip or vhost and host.
+func (r *Runner) inScope(target string) bool {
+	if r.scope == nil {
+		return true
+	}
+	for _, part := range strings.Split(target, ",") {
+		host := strings.TrimSpace(part)
+		if URL, err := urlutil.Parse(host); err == nil && URL.Host != "" {
+			host = URL.Host
+		}
+		if !r.scope.HostAllowed(host) {
+			gologger.Debug().Msgf("Skipping out of scope target: %s\n", target)
+			return false
+		}
+	}
+	return true
+}
+
+// urlInScope returns true if the url about to be probed is in scope
+func (r *Runner) urlInScope(rawURL string) bool {
+	if r.scope == nil {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	return err == nil && r.scope.Allowed(u)
+}
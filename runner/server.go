@@ -0,0 +1,478 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"github.com/projectdiscovery/gologger"
+	wappalyzer "github.com/projectdiscovery/wappalyzergo"
+)
+
+// DefaultListenAddress is the address httpx serve listens on if not specified
+const DefaultListenAddress = "127.0.0.1:8080"
+
+// maxJobSize is the maximum size of the body of a job submission
+const maxJobSize = 10 * 1024 * 1024
+
+// The finished jobs are kept along with their results for finishedJobTTL, and only
+// the maxFinishedJobs most recent ones
+const (
+	finishedJobTTL  = time.Hour
+	maxFinishedJobs = 100
+)
+
+// Status of the jobs
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobCanceled  = "canceled"
+)
+
+// Formats of the streamed results
+const (
+	streamNDJSON = "ndjson"
+	streamSSE    = "sse"
+)
+
+// jobRequest is a job submission, the config sets the scan options of the job
+// on top of the ones of the server
+type jobRequest struct {
+	Targets []string        `json:"targets"`
+	Config  json.RawMessage `json:"config,omitempty"`
+}
+
+// jobStatus is the status of a job returned by the api
+type jobStatus struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Targets    int        `json:"targets"`
+	Results    int        `json:"results"`
+	CreatedAt  time.Time  `json:"created-at"`
+	FinishedAt *time.Time `json:"finished-at,omitempty"`
+}
+
+// job probes a list of targets and keeps its results in memory until it's deleted
+type job struct {
+	id       string
+	targets  []string
+	scanopts *scanOptions
+	ctx      context.Context
+	cancel   context.CancelFunc
+	created  time.Time
+
+	mu       sync.Mutex
+	status   string
+	finished time.Time
+	results  [][]byte
+	// updated is closed and replaced each time a result is added or the job finishes
+	updated chan struct{}
+}
+
+// add appends a result to the job
+func (j *job) add(result []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.results = append(j.results, result)
+	close(j.updated)
+	j.updated = make(chan struct{})
+}
+
+// finish marks the job as completed, or canceled if it was interrupted
+func (j *job) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = JobCompleted
+	if j.ctx.Err() != nil {
+		j.status = JobCanceled
+	}
+	j.finished = time.Now()
+	j.cancel()
+	close(j.updated)
+	j.updated = make(chan struct{})
+}
+
+// next returns the results from index on, the channel closed on the next update
+// and whether the job is still running
+func (j *job) next(from int) ([][]byte, <-chan struct{}, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.results[from:], j.updated, j.status == JobRunning
+}
+
+func (j *job) jobStatus() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := jobStatus{ID: j.id, Status: j.status, Targets: len(j.targets), Results: len(j.results), CreatedAt: j.created}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		status.FinishedAt = &finished
+	}
+	return status
+}
+
+// server runs the jobs submitted over http on the client and rate limiters of a shared runner
+type server struct {
+	ctx    context.Context
+	runner *Runner
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// Serve runs httpx as an http api probing the targets of the submitted jobs until ctx is canceled.
+// The options are the defaults of the jobs and configure the client shared by all of them.
+func Serve(ctx context.Context, options *Options) error {
+	// the results are returned as json, the progress is exposed by the metrics
+	options.JSONOutput = true
+	options.ShowStatistics = false
+	// the jobs aren't journaled
+	options.ResumeFile = ""
+
+	r, err := New(options)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := r.metrics.serve(); err != nil {
+		return errors.Wrapf(err, "could not expose metrics on '%s'", options.MetricsAddr)
+	}
+	// the jobs can enable the technology detection
+	if r.wappalyzer == nil {
+		if r.wappalyzer, err = wappalyzer.New(); err != nil {
+			return errors.Wrap(err, "could not create wappalyzer client")
+		}
+	}
+
+	addr := options.Listen
+	if addr == "" {
+		addr = DefaultListenAddress
+	}
+	s := &server{ctx: ctx, runner: r, jobs: make(map[string]*job)}
+	httpServer := &http.Server{Addr: addr, Handler: s.router(), ReadHeaderTimeout: 10 * time.Second}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	gologger.Info().Msgf("Listening on %s\n", addr)
+
+	select {
+	case err := <-serveErr:
+		return errors.Wrapf(err, "could not listen on '%s'", addr)
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		j.cancel()
+	}
+	s.mu.Unlock()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+func (s *server) router() http.Handler {
+	router := httprouter.New()
+	router.POST("/jobs", s.createJob)
+	router.GET("/jobs", s.listJobs)
+	router.GET("/jobs/:id", s.getJob)
+	router.DELETE("/jobs/:id", s.deleteJob)
+	router.GET("/jobs/:id/results", s.jobResults)
+	return router
+}
+
+// createJob starts a job, its results are streamed back if requested with the stream
+// query parameter (ndjson or sse) or the Accept header
+func (s *server) createJob(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var jobReq jobRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxJobSize))
+	if err := decoder.Decode(&jobReq); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "could not decode job"))
+		return
+	}
+	var targets []string
+	for _, target := range jobReq.Targets {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no targets to probe"))
+		return
+	}
+	scanopts, err := s.jobOptions(jobReq.Config)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format := streamFormat(req)
+	parent := s.ctx
+	if format != "" {
+		// a streamed job is canceled as soon as the client goes away
+		parent = req.Context()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	j := &job{
+		id:       randomID(),
+		targets:  targets,
+		scanopts: scanopts,
+		ctx:      ctx,
+		cancel:   cancel,
+		created:  time.Now(),
+		status:   JobRunning,
+		updated:  make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.evictJobs()
+	s.jobs[j.id] = j
+	s.mu.Unlock()
+	go s.run(j)
+
+	if format == "" {
+		w.Header().Set("Location", "/jobs/"+j.id)
+		writeJSON(w, http.StatusAccepted, j.jobStatus())
+		return
+	}
+	s.stream(w, req, j, format, true)
+}
+
+// jobOptions returns the scan options of the server overridden by the config of a job
+func (s *server) jobOptions(config json.RawMessage) (*scanOptions, error) {
+	scanopts := s.runner.scanopts.Clone()
+	if len(config) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(config))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(scanopts); err != nil {
+			return nil, errors.Wrap(err, "invalid job config")
+		}
+	}
+	if len(scanopts.Methods) == 0 {
+		return nil, errors.New("invalid job config: no methods")
+	}
+	for i, method := range scanopts.Methods {
+		scanopts.Methods[i] = strings.ToUpper(method)
+	}
+	scanopts.extractRegex = nil
+	if scanopts.OutputExtractRegex != "" {
+		var err error
+		if scanopts.extractRegex, err = regexp.Compile(scanopts.OutputExtractRegex); err != nil {
+			return nil, errors.Wrap(err, "invalid job config: invalid extract regex")
+		}
+	}
+	var err error
+	if scanopts.extractors, err = parseExtractors(scanopts.Extractors); err != nil {
+		return nil, errors.Wrap(err, "invalid job config")
+	}
+	return scanopts, nil
+}
+
+// run probes the targets of the job
+func (s *server) run(j *job) {
+	r := s.runner
+	wg := newProbePool(r.options.Threads)
+	output := make(chan Result)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for result := range output {
+			r.metrics.queued(-1)
+			if result.str == "" || !r.matchConditions(result) {
+				continue
+			}
+			j.add([]byte(result.JSON(j.scanopts)))
+		}
+	}()
+
+	for _, target := range j.targets {
+		if j.ctx.Err() != nil {
+			break
+		}
+		protocol := r.inputProtocol(target, j.scanopts.NoFallbackScheme)
+		r.process(j.ctx, target, wg, r.hp, protocol, j.scanopts, output)
+	}
+	r.wait(j.ctx, wg, output)
+	close(output)
+	<-done
+	j.finish()
+}
+
+// stream writes the results of the job from the first one, and the following ones until it finishes if follow is set
+func (s *server) stream(w http.ResponseWriter, req *http.Request, j *job, format string, follow bool) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("X-Job-Id", j.id)
+	if format == streamSSE {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	if format == streamSSE {
+		writeEvent(w, "job", j.jobStatus())
+	}
+
+	for next := 0; ; {
+		results, updated, running := j.next(next)
+		for _, result := range results {
+			if format == streamSSE {
+				fmt.Fprintf(w, "event: result\ndata: %s\n\n", result)
+			} else {
+				fmt.Fprintf(w, "%s\n", result)
+			}
+		}
+		next += len(results)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !running || !follow {
+			break
+		}
+		select {
+		case <-updated:
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if format == streamSSE {
+		writeEvent(w, "done", j.jobStatus())
+	}
+}
+
+func (s *server) listJobs(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	s.mu.Lock()
+	s.evictJobs()
+	statuses := make([]jobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		statuses = append(statuses, j.jobStatus())
+	}
+	s.mu.Unlock()
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].CreatedAt.Before(statuses[k].CreatedAt)
+	})
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *server) getJob(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	j := s.job(ps.ByName("id"))
+	if j == nil {
+		writeError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, j.jobStatus())
+}
+
+// deleteJob cancels a running job, or deletes a finished one along with its results
+func (s *server) deleteJob(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	j := s.job(ps.ByName("id"))
+	if j == nil {
+		writeError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+	if status := j.jobStatus(); status.Status == JobRunning {
+		j.cancel()
+		writeJSON(w, http.StatusAccepted, status)
+		return
+	}
+	s.mu.Lock()
+	delete(s.jobs, j.id)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// jobResults returns the results of a job so far, or streams them until it finishes with follow=true or sse
+func (s *server) jobResults(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	j := s.job(ps.ByName("id"))
+	if j == nil {
+		writeError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+	format := streamFormat(req)
+	if format == "" {
+		format = streamNDJSON
+	}
+	follow := format == streamSSE || req.URL.Query().Get("follow") == "true"
+	s.stream(w, req, j, format, follow)
+}
+
+// evictJobs deletes the finished jobs expired or in excess, s.mu must be held
+func (s *server) evictJobs() {
+	type finishedJob struct {
+		id string
+		at time.Time
+	}
+	var finished []finishedJob
+	for id, j := range s.jobs {
+		status := j.jobStatus()
+		if status.FinishedAt == nil {
+			continue
+		}
+		if time.Since(*status.FinishedAt) > finishedJobTTL {
+			delete(s.jobs, id)
+			continue
+		}
+		finished = append(finished, finishedJob{id: id, at: *status.FinishedAt})
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].at.Before(finished[k].at)
+	})
+	for _, j := range finished[:len(finished)-maxFinishedJobs] {
+		delete(s.jobs, j.id)
+	}
+}
+
+func (s *server) job(id string) *job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictJobs()
+	return s.jobs[id]
+}
+
+// streamFormat returns the format the results are requested to be streamed with, if any
+func streamFormat(req *http.Request) string {
+	switch stream := req.URL.Query().Get("stream"); {
+	case stream == streamSSE, strings.Contains(req.Header.Get("Accept"), "text/event-stream"):
+		return streamSSE
+	case stream == streamNDJSON, strings.Contains(req.Header.Get("Accept"), "application/x-ndjson"):
+		return streamNDJSON
+	}
+	return ""
+}
+
+// randomID returns a random identifier of jobs and batches
+func randomID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	writeJSON(w, statusCode, map[string]string{"error": err.Error()})
+}
+
+func writeEvent(w http.ResponseWriter, event string, value interface{}) {
+	data, _ := json.Marshal(value)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// parseShard parses a shard in the i/n format, with i between 1 and n
+func parseShard(shard string) (index, count int, err error) {
+	parts := strings.Split(shard, "/")
+	if len(parts) == 2 {
+		index, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err == nil {
+			count, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		}
+	}
+	if len(parts) != 2 || err != nil || count < 1 || index < 1 || index > count {
+		return 0, 0, fmt.Errorf("Invalid shard '%s', use i/n with i between 1 and n (eg 1/10)", shard)
+	}
+	return index, count, nil
+}
+
+// inShard returns true if the endpoint, identified by its target (including the port) and path,
+// belongs to the shard of this instance. The same endpoint is always assigned to the same shard,
+// whatever the order of the input, so that n instances probe the whole target space without overlap.
+func (r *Runner) inShard(target, path string) bool {
+	if r.options.shardCount <= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(target))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(path))
+	return jumpHash(h.Sum64(), r.options.shardCount) == r.options.shardIndex-1
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach: it maps a key to one of n buckets
+// moving only 1/n of the keys when a bucket is added
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
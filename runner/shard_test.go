@@ -0,0 +1,92 @@
+package runner
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	tests := []struct {
+		shard        string
+		index, count int
+		valid        bool
+	}{
+		{"1/1", 1, 1, true},
+		{"3/10", 3, 10, true},
+		{" 2 / 4 ", 2, 4, true},
+		{"0/4", 0, 0, false},
+		{"5/4", 0, 0, false},
+		{"1/0", 0, 0, false},
+		{"1", 0, 0, false},
+		{"a/b", 0, 0, false},
+	}
+	for _, test := range tests {
+		index, count, err := parseShard(test.shard)
+		if (err == nil) != test.valid || index != test.index || count != test.count {
+			t.Errorf("parseShard(%q) = %d, %d, %v", test.shard, index, count, err)
+		}
+	}
+}
+
+func TestShardsPartitionKeys(t *testing.T) {
+	var targets []string
+	for i := 0; i < 200; i++ {
+		targets = append(targets, fmt.Sprintf("10.0.%d.%d:443", i/100, i%100), fmt.Sprintf("host%d.example.com", i))
+	}
+	paths := []string{"", "/admin", "/api/v1"}
+
+	for _, count := range []int{1, 2, 3, 7, 16} {
+		assignment := make(map[string]int)
+		sizes := make([]int, count)
+		for _, target := range targets {
+			for _, path := range paths {
+				owners := 0
+				for index := 1; index <= count; index++ {
+					r := &Runner{options: &Options{shardIndex: index, shardCount: count}}
+					if r.inShard(target, path) {
+						owners++
+						assignment[target+" "+path] = index
+						sizes[index-1]++
+					}
+				}
+				if owners != 1 {
+					t.Fatalf("%d shards: %s %s belongs to %d shards, want 1", count, target, path, owners)
+				}
+			}
+		}
+		// every shard gets a share of the keys
+		for index, size := range sizes {
+			if size == 0 {
+				t.Errorf("%d shards: shard %d is empty", count, index+1)
+			}
+		}
+
+		// the assignment doesn't depend on the order the keys are seen in
+		for i := len(targets) - 1; i >= 0; i-- {
+			for j := len(paths) - 1; j >= 0; j-- {
+				for index := count; index >= 1; index-- {
+					r := &Runner{options: &Options{shardIndex: index, shardCount: count}}
+					if r.inShard(targets[i], paths[j]) && assignment[targets[i]+" "+paths[j]] != index {
+						t.Fatalf("%d shards: %s %s moved from shard %d to %d", count, targets[i], paths[j], assignment[targets[i]+" "+paths[j]], index)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestJumpHashMovesNewBucketOnly(t *testing.T) {
+	for key := uint64(0); key < 10000; key++ {
+		hashed := key * 0x9e3779b97f4a7c15
+		for buckets := 1; buckets < 10; buckets++ {
+			before, after := jumpHash(hashed, buckets), jumpHash(hashed, buckets+1)
+			if before < 0 || before >= buckets {
+				t.Fatalf("jumpHash(%d, %d) = %d out of range", hashed, buckets, before)
+			}
+			// adding a bucket only moves keys to the new bucket
+			if after != before && after != buckets {
+				t.Fatalf("jumpHash(%d) moved from %d to %d when adding bucket %d", hashed, before, after, buckets)
+			}
+		}
+	}
+}
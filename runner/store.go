@@ -0,0 +1,174 @@
+package runner
+
+import (
+	"bytes"
+	"net/url"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/retryablehttp-go"
+	"github.com/sviivyao/httpx/common/har"
+	"github.com/sviivyao/httpx/common/httpx"
+	"github.com/sviivyao/httpx/common/warc"
+)
+
+// storeWARC archives the request and response of a probe, preceded by the redirect chain if any
+func (r *Runner) storeWARC(hp *httpx.HTTPX, fullURL, origInput string, requestDump []byte, resp *httpx.Response, scanopts *scanOptions) {
+	date := time.Now().Add(-resp.Duration)
+	var exchanges []warc.Exchange
+
+	targetURI := fullURL
+	if resp.HasChain() {
+		// the last item of the chain is the final response, stored with its body below
+		for _, item := range resp.Chain[:len(resp.Chain)-1] {
+			exchanges = append(exchanges, warc.Exchange{
+				TargetURI: item.RequestURL,
+				IP:        dialedIP(hp, item.RequestURL),
+				Date:      date,
+				Request:   fixRequestVersion(item.Request),
+				Response:  item.Response,
+			})
+		}
+		last := resp.Chain[len(resp.Chain)-1]
+		targetURI, requestDump = last.RequestURL, fixRequestVersion(last.Request)
+	}
+
+	// a cut response no longer matches its framing headers, so it is flagged as truncated
+	// by length as the replay tools expect
+	var truncated string
+	respRaw := resp.Raw
+	if len(respRaw) > scanopts.MaxResponseBodySizeToSave {
+		respRaw = respRaw[:scanopts.MaxResponseBodySizeToSave]
+		truncated = "length"
+	}
+	if resp.BodyTruncated {
+		truncated = "length"
+	}
+	exchanges = append(exchanges, warc.Exchange{
+		TargetURI: targetURI,
+		IP:        dialedIP(hp, targetURI),
+		Date:      date,
+		Request:   requestDump,
+		Response:  []byte(respRaw),
+		Truncated: truncated,
+		Metadata: map[string]string{
+			"input":         origInput,
+			"response-time": resp.Duration.String(),
+		},
+	})
+
+	if err := r.warc.Write(exchanges...); err != nil {
+		gologger.Warning().Msgf("Could not write response of '%s' to warc archive: %s", fullURL, err)
+	}
+}
+
+// storeContent adds the body to the content addressed store and indexes the probe
+func (r *Runner) storeContent(fullURL string, resp *httpx.Response, hashesMap map[string]string, scanopts *scanOptions) {
+	body := resp.Data
+	if len(body) > scanopts.MaxResponseBodySizeToSave {
+		body = body[:scanopts.MaxResponseBodySizeToSave]
+	}
+	if _, err := r.store.Put(fullURL, time.Now(), resp.StatusCode, body, hashesMap); err != nil {
+		gologger.Warning().Msgf("Could not store response of '%s': %s", fullURL, err)
+	}
+}
+
+// storeHAR adds an entry to the HAR log for each request of the probe, redirects included
+func (r *Runner) storeHAR(hp *httpx.HTTPX, req *retryablehttp.Request, fullURL string, requestDump []byte, resp *httpx.Response, scanopts *scanOptions) {
+	body := resp.Data
+	if len(body) > scanopts.MaxResponseBodySizeToSave {
+		body = body[:scanopts.MaxResponseBodySizeToSave]
+	}
+
+	type hop struct {
+		url               string
+		request, response []byte
+		body              []byte
+	}
+	// raw requests don't have a chain, the dump holds the whole response
+	hops := []hop{{url: fullURL, request: requestDump, response: []byte(resp.Raw)}}
+	if len(resp.Chain) > 0 {
+		hops = hops[:0]
+		for i, item := range resp.Chain {
+			current := hop{url: item.RequestURL, request: fixRequestVersion(item.Request), response: item.Response}
+			if i == 0 {
+				// the dump of the probe includes the request body
+				current.request = requestDump
+			}
+			if i == len(resp.Chain)-1 {
+				current.body = body
+			}
+			hops = append(hops, current)
+		}
+	}
+
+	var entries []har.Entry
+	for i, current := range hops {
+		request, err := har.NewRequest(current.url, current.request)
+		if err != nil {
+			if i > 0 {
+				gologger.Warning().Msgf("Could not parse request of '%s' for har log: %s", current.url, err)
+				return
+			}
+			// unsafe and raw requests can't always be parsed back from their dump
+			request = har.NewRequestFromHTTP(current.url, req.Request, []byte(scanopts.RequestBody))
+		}
+		response, err := har.NewResponse(current.url, current.response, current.body)
+		if err != nil {
+			gologger.Warning().Msgf("Could not parse response of '%s' for har log: %s", current.url, err)
+			return
+		}
+		started := time.Now().Add(-resp.Duration)
+		timings := har.Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+		if len(resp.Timings) == len(hops) {
+			traced := resp.Timings[i]
+			started = traced.Start
+			timings.DNS = har.Milliseconds(traced.DNS)
+			// the tls handshake is part of the connection time
+			connect := traced.Connect
+			if traced.TLS >= 0 {
+				timings.SSL = har.Milliseconds(traced.TLS)
+				if connect < 0 {
+					connect = 0
+				}
+				connect += traced.TLS
+			}
+			timings.Connect = har.Milliseconds(connect)
+			timings.Send = har.Milliseconds(traced.Send)
+			timings.Wait = har.Milliseconds(traced.Wait)
+			timings.Receive = har.Milliseconds(traced.Receive)
+		}
+		entries = append(entries, har.Entry{
+			StartedDateTime: har.FormatTime(started),
+			Time:            timings.Total(),
+			Request:         request,
+			Response:        response,
+			Timings:         timings,
+			ServerIPAddress: dialedIP(hp, current.url),
+		})
+	}
+
+	if err := r.har.Write(entries...); err != nil {
+		gologger.Warning().Msgf("Could not write '%s' to har log: %s", fullURL, err)
+	}
+}
+
+func dialedIP(hp *httpx.HTTPX, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return hp.Dialer.GetDialedIP(u.Hostname())
+}
+
+// fixRequestVersion sets the protocol version of the requests built by the client to follow
+// the redirects, which is left empty and dumped as HTTP/0.0
+func fixRequestVersion(request []byte) []byte {
+	end := bytes.Index(request, []byte("\r\n"))
+	if end < 0 || !bytes.HasSuffix(request[:end], []byte(" HTTP/0.0")) {
+		return request
+	}
+	fixed := append([]byte(nil), request[:end-len("0.0")]...)
+	fixed = append(fixed, "1.1"...)
+	return append(fixed, request[end:]...)
+}
@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/projectdiscovery/goflags"
+	"github.com/sviivyao/httpx/common/store"
+)
+
+const storeUsage = `Usage: httpx store query [flags]
+
+Looks up the responses saved with -store-format cas
+`
+
+// RunStoreCommand runs the store subcommand with its arguments
+func RunStoreCommand(args []string) error {
+	if len(args) == 0 || args[0] != "query" {
+		fmt.Fprint(os.Stderr, storeUsage)
+		return errors.New("unknown store command, use 'httpx store query'")
+	}
+
+	var (
+		dir        string
+		query      store.Query
+		jsonOutput bool
+	)
+	flagSet := goflags.NewFlagSet()
+	flagSet.SetDescription(`httpx store query looks up the responses saved with -store-format cas.`)
+	flagSet.StringVarP(&dir, "dir", "srd", DefaultOutputDirectory, "directory of the response store (-srd of the scan)")
+	flagSet.StringVar(&query.Hash, "hash", "", "body sha256 or any other hash recorded with -hash")
+	flagSet.StringVar(&query.URLPrefix, "url", "", "url prefix of the responses")
+	flagSet.IntVar(&query.StatusCode, "status", 0, "status code of the responses")
+	flagSet.IntVar(&query.Limit, "limit", 0, "maximum number of responses to show")
+	flagSet.BoolVar(&jsonOutput, "json", false, "display the responses in JSONL(ines) format")
+	// the flags of the subcommand follow its name
+	os.Args = append(os.Args[:1], args[1:]...)
+	_ = flagSet.Parse()
+
+	responseStore, err := store.Open(dir, true)
+	if err != nil {
+		return errors.Wrapf(err, "could not open response store in '%s'", dir)
+	}
+	defer responseStore.Close()
+
+	entries, err := responseStore.Query(query)
+	if err != nil {
+		return errors.Wrap(err, "could not query response store")
+	}
+	return writeStoreEntries(os.Stdout, responseStore, entries, jsonOutput)
+}
+
+func writeStoreEntries(w io.Writer, responseStore *store.Store, entries []store.Entry, jsonOutput bool) error {
+	for _, entry := range entries {
+		entry.Blob = responseStore.BlobPath(entry)
+		if jsonOutput {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, string(data))
+			continue
+		}
+		fmt.Fprintf(w, "%s %d %s %s %s\n", entry.Timestamp.Format(time.RFC3339), entry.StatusCode, entry.URL, entry.BodyHash, entry.Blob)
+	}
+	return nil
+}
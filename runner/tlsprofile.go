@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/bluele/gcache"
+	"github.com/projectdiscovery/gologger"
+	"github.com/sviivyao/httpx/common/httpx"
+)
+
+// maxTLSProfiles is the number of endpoints whose tls profile is kept in memory
+const maxTLSProfiles = 10000
+
+// tlsProfiles caches the tls profile of each host:port, which is the same for all
+// the paths and methods probed on the endpoint
+type tlsProfiles struct {
+	mu      sync.Mutex
+	entries gcache.Cache
+}
+
+type tlsProfileEntry struct {
+	done    chan struct{}
+	profile *httpx.TLSProfile
+}
+
+func newTLSProfiles() *tlsProfiles {
+	return &tlsProfiles{entries: gcache.New(maxTLSProfiles).LRU().Build()}
+}
+
+// tlsProfile returns the tls profile of host:port. The endpoint is profiled once, the
+// concurrent requests to it wait for the result. Each handshake goes through the rate limits.
+func (r *Runner) tlsProfile(ctx context.Context, hp *httpx.HTTPX, host, port, limitKey string) *httpx.TLSProfile {
+	key := net.JoinHostPort(host, port)
+	r.tlsProfiles.mu.Lock()
+	if value, err := r.tlsProfiles.entries.Get(key); err == nil {
+		r.tlsProfiles.mu.Unlock()
+		entry := value.(*tlsProfileEntry)
+		select {
+		case <-entry.done:
+			return entry.profile
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	entry := &tlsProfileEntry{done: make(chan struct{})}
+	_ = r.tlsProfiles.entries.Set(key, entry)
+	r.tlsProfiles.mu.Unlock()
+	defer close(entry.done)
+
+	profile, err := hp.TLSProfile(ctx, host, port, func(ctx context.Context) (func(), error) {
+		return r.take(ctx, limitKey)
+	})
+	// the profiles interrupted by the scan being stopped aren't cached, as the runner is
+	// shared by the jobs of the server
+	if ctx.Err() != nil {
+		r.tlsProfiles.mu.Lock()
+		r.tlsProfiles.entries.Remove(key)
+		r.tlsProfiles.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		gologger.Debug().Msgf("Could not profile tls of %s: %s\n", key, err)
+	}
+	entry.profile = profile
+	return profile
+}
@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/projectdiscovery/gologger"
+)
+
+// workerRetryInterval is the time a worker waits before pulling again when there is no batch available
+const workerRetryInterval = time.Second
+
+// runWorker probes the batches pulled from the coordinator and pushes back their results until
+// all the targets were probed or inputCtx is canceled. The results pass the matchers and filters of the worker.
+func (r *Runner) runWorker(inputCtx, ctx context.Context) error {
+	coordinatorURL := strings.TrimSuffix(r.options.Worker, "/")
+	client := &http.Client{Timeout: batchPollWait + time.Minute}
+	gologger.Info().Msgf("Pulling targets from %s\n", coordinatorURL)
+
+	for inputCtx.Err() == nil {
+		var batch workBatch
+		if err := workerRequest(inputCtx, client, coordinatorURL+"/batches", nil, &batch); err != nil {
+			if inputCtx.Err() != nil {
+				break
+			}
+			return errors.Wrap(err, "could not pull batch from coordinator")
+		}
+		if batch.Done {
+			return nil
+		}
+		if len(batch.Units) == 0 {
+			select {
+			case <-time.After(workerRetryInterval):
+			case <-inputCtx.Done():
+			}
+			continue
+		}
+
+		gologger.Verbose().Msgf("Probing batch %s of %d targets\n", batch.ID, len(batch.Units))
+		results := r.probeBatch(ctx, batch)
+		// the batch of an interrupted worker is handed out again once its lease expires
+		if ctx.Err() != nil {
+			break
+		}
+		var body bytes.Buffer
+		encoder := json.NewEncoder(&body)
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return errors.Wrap(err, "could not encode result")
+			}
+		}
+		if err := workerRequest(ctx, client, coordinatorURL+"/batches/"+batch.ID, &body, nil); err != nil {
+			return errors.Wrapf(err, "could not push results of batch %s to coordinator", batch.ID)
+		}
+	}
+	return nil
+}
+
+// probeBatch probes the units of the batch and returns the results passing the matchers and filters
+func (r *Runner) probeBatch(ctx context.Context, batch workBatch) []workResult {
+	wg := newProbePool(r.options.Threads)
+	output := make(chan Result)
+	done := make(chan struct{})
+	var results []workResult
+	go func() {
+		defer close(done)
+		for result := range output {
+			r.metrics.queued(-1)
+			if result.Err != nil {
+				gologger.Debug().Msgf("Failed '%s': %s\n", result.URL, result.Err)
+			}
+			if result.str == "" || !r.matchConditions(result) {
+				continue
+			}
+			if js := result.JSON(&r.scanopts); js != "" {
+				results = append(results, workResult{Str: result.str, Result: json.RawMessage(js)})
+			}
+		}
+	}()
+
+	for _, unit := range batch.Units {
+		if ctx.Err() != nil {
+			break
+		}
+		scanopts := &r.scanopts
+		if unit.Path != "" {
+			scanopts = r.scanopts.Clone()
+			scanopts.RequestURI = unit.Path
+		}
+		r.process(ctx, unit.Target, wg, r.hp, r.inputProtocol(unit.Target, r.options.NoFallbackScheme), scanopts, output)
+	}
+	r.wait(ctx, wg, output)
+	close(output)
+	<-done
+	return results
+}
+
+// workerRequest posts body to the coordinator and decodes its json response into response, if any
+func workerRequest(ctx context.Context, client *http.Client, url string, body io.Reader, response interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}